@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Remote hosts are scanned by running "filebase agent" there and feeding
+// its output to "filebase ingest" here, for example over ssh.  The agent
+// stream starts with a hello message carrying the remote clock, which is
+// used to shift the remote sample times onto the local clock.
+
+type agentMsg struct {
+	Type  string `json:"type"`
+	Host  string `json:"host,omitempty"`
+	Root  string `json:"root,omitempty"`
+	Clock int64  `json:"clock,omitempty"`
+	Path  string `json:"path,omitempty"`
+	Time  int64  `json:"time,omitempty"`
+	Mode  uint32 `json:"mode,omitempty"`
+	Size  int64  `json:"size,omitempty"`
+	Mtime int64  `json:"mtime,omitempty"`
+}
+
+func init() {
+	addCommand(&command{
+		name:     "agent",
+		synopsis: "<dir>",
+		help:     "Scan dir and write the samples to stdout for \"filebase ingest\" on another host.",
+		run:      runAgent,
+		noDB:     true,
+	})
+	addCommand(&command{
+		name:     "ingest",
+		synopsis: "",
+		help:     "Record samples read from stdin, as written by \"filebase agent\" on a remote host.",
+		run:      runIngest,
+	})
+}
+
+func runAgent(args []string) {
+	fs := commandFlags("agent")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	host, err := os.Hostname()
+	fatal(err)
+	root := canonical(fs.Arg(0))
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	enc := json.NewEncoder(w)
+	fatal(enc.Encode(&agentMsg{Type: "hello", Host: host, Root: root, Clock: time.Now().Unix()}))
+
+	walk := &walker{
+		file: func(path string, info os.FileInfo) {
+			fatal(enc.Encode(&agentMsg{
+				Type:  "sample",
+				Path:  path,
+				Time:  time.Now().Unix(),
+				Mode:  uint32(info.Mode()),
+				Size:  info.Size(),
+				Mtime: info.ModTime().Unix(),
+			}))
+		},
+		failed: func(path string, err error) {
+			log.Print(err)
+		},
+	}
+	fatal(walk.walk(root))
+}
+
+func runIngest(args []string) {
+	fs := commandFlags("ingest")
+	parseFlags(fs, args)
+	needArgs(fs, 0)
+
+	dirid, err := cache.ingest(os.Stdin)
+	fatal(err)
+	fatal(cache.checkAlerts(dirid))
+}
+
+// ingest records an agent stream under the directory "host:root".  A bad
+// stream, or an error recording it, is returned after waiting for the
+// samples being inserted, and the lock is released either way.
+func (fdb *fileDB) ingest(r io.Reader) (dirid int64, err error) {
+	defer catch(&err, "ingesting")
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	var hello agentMsg
+	fatal(dec.Decode(&hello))
+	if hello.Type != "hello" {
+		return 0, fmt.Errorf("agent stream starts with %q, not hello", hello.Type)
+	}
+
+	start := time.Now()
+	offset := start.Unix() - hello.Clock
+	_, err = fdb.db.Exec("INSERT OR REPLACE INTO clockoffset (host, sampletime, offset) VALUES (?,?,?)",
+		hello.Host, start.Unix(), offset)
+	fatal(err)
+	if offset != 0 {
+		fmt.Fprintf(stdout, "%s clock is off by %v\n", hello.Host, time.Duration(-offset)*time.Second)
+	}
+
+	dirid = fdb.getDirIDFor(hello.Host, hello.Host+":"+hello.Root, hello.Host+":"+hello.Root)
+	_, err = fdb.db.Exec("UPDATE dir SET agent = 1 WHERE dirid = ?", dirid)
+	fatal(err)
+	fdb.insertErr = nil
+	progress.begin(hello.Host + ":" + hello.Root)
+	defer progress.end()
+	scanid := fdb.beginScan(dirid, start)
+	defer fdb.unlockScan(dirid)
+
+	infos := fdb.startInserts(dirid, scanid)
+	err = sendSamples(dec, infos, hello.Host, offset)
+	fdb.wg.Wait()
+	if err != nil {
+		return dirid, err
+	}
+	if fdb.insertErr != nil {
+		return dirid, fdb.insertErr
+	}
+
+	fdb.finishScan(dirid, scanid, start, 0, nil)
+	return dirid, nil
+}
+
+// sendSamples passes the samples left in an agent stream from host on to
+// infos, shifted by offset onto the local clock, and closes it.
+func sendSamples(dec *json.Decoder, infos chan<- *insertJob, host string, offset int64) error {
+	defer close(infos)
+	for {
+		var msg agentMsg
+		err := dec.Decode(&msg)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if msg.Type != "sample" {
+			continue
+		}
+		infos <- &insertJob{
+			now:    time.Unix(msg.Time+offset, 0),
+			i:      &remoteInfo{msg},
+			p:      host + ":" + msg.Path,
+			source: sourceAgent,
+		}
+	}
+}
+
+// agentDirs marks the directories recorded by ingest, which the daemon
+// leaves to their agents.  Those ingested before were named host:/root.
+func agentDirs(tx *sql.Tx) {
+	addColumn(tx, "dir", "agent", "integer NOT NULL DEFAULT 0")
+	_, err := tx.Exec("UPDATE dir SET agent = 1 WHERE host IS NOT NULL AND substr(dirpath, 1, length(host) + 2) = host || ':/'")
+	fatal(err)
+}
+
+// remoteInfo presents a sample from an agent as an os.FileInfo.
+type remoteInfo struct {
+	msg agentMsg
+}
+
+func (r *remoteInfo) Name() string       { return filepath.Base(r.msg.Path) }
+func (r *remoteInfo) Size() int64        { return r.msg.Size }
+func (r *remoteInfo) Mode() os.FileMode  { return os.FileMode(r.msg.Mode) }
+func (r *remoteInfo) ModTime() time.Time { return time.Unix(r.msg.Mtime, 0) }
+func (r *remoteInfo) IsDir() bool        { return false }
+func (r *remoteInfo) Sys() interface{}   { return nil }
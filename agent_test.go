@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestIngest feeds agent streams, whole and broken, to ingest, and checks
+// what was recorded, and that the lock was released every time.
+func TestIngest(t *testing.T) {
+	tmp := t.TempDir()
+	defer func(path string, cfg *config) { configPath, loadedConfig = path, cfg }(configPath, loadedConfig)
+	configPath, loadedConfig = filepath.Join(tmp, "none.json"), nil
+
+	fdb, err := newFileDB(filepath.Join(tmp, "test.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fdb.close()
+
+	stream := func(host string, msgs ...agentMsg) string {
+		var b strings.Builder
+		enc := json.NewEncoder(&b)
+		now := time.Now().Unix()
+		enc.Encode(&agentMsg{Type: "hello", Host: host, Root: "/data", Clock: now})
+		for _, msg := range msgs {
+			msg.Time = now
+			enc.Encode(&msg)
+		}
+		return b.String()
+	}
+	ingest := func(s string) (dirid int64, err error) {
+		t.Helper()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			dirid, err = fdb.ingest(strings.NewReader(s))
+		}()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("ingest hung")
+		}
+		return
+	}
+	locks := func() (n int) {
+		t.Helper()
+		if err := fdb.db.QueryRow("SELECT count(*) FROM scanlock").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	dirid, err := ingest(stream("remote",
+		agentMsg{Type: "sample", Path: "/data/a", Size: 10},
+		agentMsg{Type: "sample", Path: "/data/sub/b", Size: 20}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := make(map[string]int64)
+	for p, f := range fdb.latestFiles(dirid, "remote:/data") {
+		sizes[p] = f.size
+	}
+	if want := map[string]int64{"a": 10, "sub/b": 20}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("ingested %v, want %v", sizes, want)
+	}
+
+	// The daemon leaves it to the agent, even one on this host.
+	defer func(host string) { localHost = host }(localHost)
+	localHost = "remote"
+	for _, d := range fdb.dirSummaries() {
+		if d.DirID == dirid && d.local() {
+			t.Errorf("%s is scanned by the daemon here", d.Dir)
+		}
+	}
+
+	whole := stream("other", agentMsg{Type: "sample", Path: "/data/a", Size: 10})
+	for _, tt := range []struct {
+		name, stream string
+	}{
+		{"truncated", whole[:len(whole)-10]},
+		{"garbled", whole + "{]\n"},
+		{"without hello", `{"type":"sample","path":"/data/a"}` + "\n"},
+	} {
+		if _, err := ingest(tt.stream); err == nil {
+			t.Errorf("ingesting a %s stream succeeded", tt.name)
+		}
+		if n := locks(); n != 0 {
+			t.Errorf("ingesting a %s stream left %d scan locks", tt.name, n)
+		}
+	}
+}
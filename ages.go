@@ -0,0 +1,132 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "ages",
+		synopsis: "[-bands age,...] <dir>",
+		help:     "Show how much each owner holds in files last modified within each age band, by default under 30 days, 30 to 365 days and older, as storage reviews of shared filesystems ask for.",
+		run:      runAges,
+		readOnly: true,
+	})
+}
+
+// An ownerAges is how much an owner holds in each age band, youngest
+// first, with files left out of the bands being older than all of them.
+type ownerAges struct {
+	owner string
+	bands []int64
+	total int64
+}
+
+func runAges(args []string) {
+	fs := commandFlags("ages")
+	bandList := fs.String("bands", "30d,365d", "Comma separated ages dividing the bands, youngest first.")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	var bands []time.Duration
+	for _, s := range strings.Split(*bandList, ",") {
+		age, err := parseAge(strings.TrimSpace(s))
+		if err != nil || (len(bands) > 0 && age <= bands[len(bands)-1]) {
+			usagef("invalid -bands %q", *bandList)
+		}
+		bands = append(bands, age)
+	}
+
+	dirid, _ := cache.findDir(fs.Arg(0))
+	result := cache.getOwnerAges(dirid, bands, opts)
+
+	names := []string{"owner"}
+	prev := "0"
+	for _, s := range strings.Split(*bandList, ",") {
+		names = append(names, prev+"-"+strings.TrimSpace(s))
+		prev = strings.TrimSpace(s)
+	}
+	names = append(names, "over "+prev, "total")
+
+	if outputFormat != "csv" && outputFormat != "json" {
+		printTitle("AGE BY OWNER")
+	}
+	w := newRowWriter(stdout)
+	w.Header(names)
+	row := make([]interface{}, len(names))
+	size := func(n int64) interface{} {
+		if outputFormat == "text" || outputFormat == "markdown" || outputFormat == "html" {
+			return strings.TrimSpace(niceSize(n))
+		}
+		return n
+	}
+	for _, u := range result {
+		row[0] = u.owner
+		for i, n := range u.bands {
+			row[i+1] = size(n)
+		}
+		row[len(row)-1] = size(u.total)
+		w.Row(row)
+	}
+	w.Flush()
+}
+
+// getOwnerAges totals the latest size of every file in dirid by owner and
+// by how long before now it was last modified, in bands divided by ages.
+// Owners are listed biggest first.
+func (fdb *fileDB) getOwnerAges(dirid int64, ages []time.Duration, o reportOptions) []*ownerAges {
+	now := time.Now()
+	var band strings.Builder
+	var args []interface{}
+	band.WriteString("case")
+	for i, age := range ages {
+		fmt.Fprintf(&band, " when sample.mtime >= ? then %d", i)
+		args = append(args, now.Add(-age).Unix())
+	}
+	fmt.Fprintf(&band, " else %d end", len(ages))
+
+	rows, err := fdb.ro.Query(
+		`select file.uid, `+band.String()+` as band, sum(size) from filepaths as file, sample
+		where file.fileid=sample.fileid and
+			file.dirid = ?`+nameFilter+` and
+			sample.sampletime =	(
+				select max(sampletime) from sample where file.fileid=sample.fileid and invalid is null
+				)
+		group by file.uid, band`, append(args, o.filterArgs(dirid)...)...)
+	fatal(err)
+	defer rows.Close()
+
+	owners := make(map[string]*ownerAges)
+	var result []*ownerAges
+	for rows.Next() {
+		var uid sql.NullInt64
+		var b int
+		var size int64
+		fatal(rows.Scan(&uid, &b, &size))
+		name := "unknown"
+		if uid.Valid {
+			name = ownerName(uid.Int64)
+		}
+		u := owners[name]
+		if u == nil {
+			u = &ownerAges{owner: name, bands: make([]int64, len(ages)+1)}
+			owners[name] = u
+			result = append(result, u)
+		}
+		u.bands[b] += size
+		u.total += size
+	}
+	fatal(rows.Err())
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].total != result[j].total {
+			return result[i].total > result[j].total
+		}
+		return result[i].owner < result[j].owner
+	})
+	return result
+}
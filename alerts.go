@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Alert rules in the configuration file are checked after every scan.  A
+// rule names a glob for the paths it covers and the combined growth rate
+// or size that's too much for them.  When a rule fires, the files doing
+// the most damage are posted to its webhook, and a summary of all the
+// rules that fired is mailed to its addresses and sent to its Slack
+// channel.  A rule with limit set also fires when the directory is over
+// its soft limit (see the limit command).
+
+type alertRule struct {
+	Name    string   `json:"name"`
+	Match   string   `json:"match"`
+	Rate    byteRate `json:"rate"`
+	Total   byteSize `json:"total"`
+	Limit   bool     `json:"limit"`
+	Webhook string   `json:"webhook"`
+	Email   []string `json:"email"`
+	Slack   string   `json:"slack"`
+}
+
+// alertFiles is how many files are sent with an alert.
+const alertFiles = 10
+
+// webhookTimeout limits how long a scan waits for a webhook to answer.
+const webhookTimeout = 30 * time.Second
+
+// alert is what's posted to a webhook when a rule fires.
+type alert struct {
+	Rule      string      `json:"rule"`
+	Root      string      `json:"root"`
+	Match     string      `json:"match"`
+	Condition string      `json:"condition"`
+	Value     float64     `json:"value"`
+	Threshold float64     `json:"threshold"`
+	Message   string      `json:"message"`
+	Files     []alertFile `json:"files"`
+	Time      time.Time   `json:"time"`
+}
+
+type alertFile struct {
+	Path string  `json:"path"`
+	Size int64   `json:"size"`
+	Rate float64 `json:"rate"`
+}
+
+// checkAlerts reports whether dirid is over its limit, and checks the
+// alert rules against it and fires those that are broken.  It warns about
+// the database itself too.
+func (fdb *fileDB) checkAlerts(dirid int64) (err error) {
+	defer catch(&err, "checking alerts for "+fdb.getDirPath(dirid))
+
+	fdb.checkDBSize()
+
+	limit := fdb.getLimit(dirid)
+	if limit != nil && limit.over() {
+		fmt.Fprintln(stdout, "OVER LIMIT", limit.message())
+	} else {
+		limit = nil
+	}
+
+	mail := make(map[string][]*alert)
+	slack := make(map[string][]*alert)
+	for _, rule := range getConfig().Alerts {
+		for _, a := range fdb.evalAlert(dirid, rule, limit) {
+			fmt.Fprintln(stdout, "ALERT", a.Message)
+			if rule.Webhook != "" {
+				if err := postWebhook(rule.Webhook, a); err != nil {
+					log.Printf("alert %s: %v", rule.Name, err)
+				}
+			}
+			for _, addr := range rule.Email {
+				mail[addr] = append(mail[addr], a)
+			}
+			if rule.Slack != "" {
+				slack[rule.Slack] = append(slack[rule.Slack], a)
+			}
+		}
+	}
+
+	for addr, alerts := range mail {
+		if err := mailAlerts(addr, alerts); err != nil {
+			log.Printf("mailing alerts to %s: %v", addr, err)
+		}
+	}
+	for url, alerts := range slack {
+		if err := postSlack(url, alerts); err != nil {
+			log.Printf("sending alerts to Slack: %v", err)
+		}
+	}
+	return nil
+}
+
+// evalAlert returns an alert for each of the rule's conditions that the
+// files in dirid break.  limit is how far dirid is over its limit, or nil
+// if it isn't.
+func (fdb *fileDB) evalAlert(dirid int64, rule *alertRule, limit *limitEnt) (alerts []*alert) {
+	o := reportOptions{NoCache: true}
+	if rule.Match != "" {
+		o.Matches = []string{rule.Match}
+	}
+
+	var total int64
+	var rate float64
+	err := fdb.ro.QueryRow(`select coalesce(sum(size), 0), coalesce(sum(rate), 0) from (`+o.reportQuery()+`)`,
+		o.reportArgs(dirid)...).Scan(&total, &rate)
+	fatal(err)
+	rate *= secondsPerDay
+
+	root := fdb.getDirPath(dirid)
+	newAlert := func(condition string, value, threshold float64, kind *reportKind) *alert {
+		a := &alert{
+			Rule:      rule.Name,
+			Root:      root,
+			Match:     rule.Match,
+			Condition: condition,
+			Value:     value,
+			Threshold: threshold,
+			Time:      time.Now(),
+		}
+		files := fdb.getReport(dirid, kind, alertFiles, o)
+		for files.Next() {
+			f := files.File()
+			a.Files = append(a.Files, alertFile{f.path, f.size, f.rate * secondsPerDay})
+		}
+		return a
+	}
+
+	if rule.Rate > 0 && rate > float64(rule.Rate) {
+		a := newAlert("rate", rate, float64(rule.Rate), fastestReport)
+		a.Message = fmt.Sprintf("%s: %s is growing %sB/day, over %sB/day",
+			rule.Name, alertScope(root, rule), niceSizef(rate), niceSizef(float64(rule.Rate)))
+		alerts = append(alerts, a)
+	}
+	if rule.Total > 0 && total > int64(rule.Total) {
+		a := newAlert("total", float64(total), float64(rule.Total), biggestReport)
+		a.Message = fmt.Sprintf("%s: %s holds %sB, over %sB",
+			rule.Name, alertScope(root, rule), niceSize(total), niceSize(int64(rule.Total)))
+		alerts = append(alerts, a)
+	}
+	if rule.Limit && limit != nil {
+		a := newAlert("limit", float64(limit.used), float64(limit.limit), biggestReport)
+		a.Message = fmt.Sprintf("%s: %s", rule.Name, limit.message())
+		alerts = append(alerts, a)
+	}
+	return
+}
+
+func alertScope(root string, rule *alertRule) string {
+	if rule.Match != "" {
+		return rule.Match
+	}
+	return root
+}
+
+// postWebhook posts an alert as JSON.
+func postWebhook(url string, a *alert) error {
+	body, err := json.Marshal(a)
+	fatal(err)
+	return post(url, body)
+}
+
+func post(url string, body []byte) error {
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+// alertSummary renders alerts as text for mail and chat.
+var alertSummary = template.Must(template.New("summary").Funcs(template.FuncMap{
+	"size": niceSize,
+	"rate": func(r float64) string { return niceSizef(r) + "B/day" },
+}).Parse(`{{range .}}{{.Message}}
+{{range .Files}}	{{size .Size}}	{{rate .Rate}}	{{.Path}}
+{{end}}
+{{end}}`))
+
+func summarize(alerts []*alert) string {
+	var b strings.Builder
+	fatal(alertSummary.Execute(&b, alerts))
+	return b.String()
+}
+
+// mailAlerts sends a summary of alerts to addr through the SMTP server in
+// the configuration file.
+func mailAlerts(addr string, alerts []*alert) error {
+	cfg := getConfig().Mail
+	subject := alerts[0].Message
+	if len(alerts) > 1 {
+		subject = fmt.Sprintf("%d filebase alerts for %s", len(alerts), alerts[0].Root)
+	}
+	msg := fmt.Sprintf("To: %s\r\nFrom: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s",
+		addr, cfg.From, subject, strings.ReplaceAll(summarize(alerts), "\n", "\r\n"))
+	return sendMail([]string{addr}, []byte(msg))
+}
+
+// sendMail sends msg to addrs through the smtp server in the
+// configuration file.
+func sendMail(addrs []string, msg []byte) error {
+	cfg := getConfig().Mail
+	if cfg.SMTP == "" {
+		return fmt.Errorf("no smtp server in %s", configPath)
+	}
+
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		host, _, err := net.SplitHostPort(cfg.SMTP)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+	return smtp.SendMail(cfg.SMTP, auth, cfg.From, addrs, msg)
+}
+
+// postSlack sends a summary of alerts to a Slack incoming webhook.
+func postSlack(url string, alerts []*alert) error {
+	body, err := json.Marshal(map[string]string{"text": "```\n" + summarize(alerts) + "```"})
+	fatal(err)
+	return post(url, body)
+}
@@ -0,0 +1,69 @@
+package main
+
+import "strings"
+
+// With -all-dirs, the file reports rank the files of every recorded
+// directory together.  Each directory's report is ranked as usual, and
+// cached, and their tops are merged.
+
+// printAllDirs prints the file reports asked for across all directories.
+func printAllDirs() {
+	if outputFormat == "markdown" {
+		stdout.Write([]byte("# All directories\n\n"))
+	}
+	for _, r := range []struct {
+		do   bool
+		kind *reportKind
+	}{
+		{doBiggest, biggestReport},
+		{doOldest, oldestReport},
+		{doNewest, newestReport},
+		{doFastest, fastestReport},
+	} {
+		if r.do {
+			printFiles(r.kind, cache.getAllDirsReport(r.kind, listSize, opts))
+		}
+	}
+}
+
+// getAllDirsReport ranks the files in every directory on the -host for a
+// report and returns the top n.
+func (fdb *fileDB) getAllDirsReport(kind *reportKind, n int, o reportOptions) *fileIter {
+	// Each directory's top n+offset holds all it could put in the top n
+	// past the offset.
+	each := n
+	if n >= 0 {
+		each = n + o.Offset
+	}
+	offset := o.Offset
+	o.Offset = 0
+
+	var files []fileEnt
+	for _, dirid := range fdb.allDirIDs() {
+		root := fdb.getDirPath(dirid)
+		it := fdb.getReport(dirid, kind, each, o)
+		for it.Next() {
+			f := *it.File()
+			f.dir = root
+			files = append(files, f)
+		}
+		it.Close()
+	}
+
+	order, err := parseSort(strings.ToLower(strings.Replace(kind.order, " ", ":", 1)))
+	fatal(err)
+	order.sort(files)
+
+	if offset > len(files) {
+		offset = len(files)
+	}
+	files = files[offset:]
+	if n >= 0 && n < len(files) {
+		end := n
+		for o.Ties && n > 0 && end < len(files) && kind.tie(&files[n-1], &files[end]) {
+			end++
+		}
+		files = files[:end]
+	}
+	return &fileIter{files: files}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Analyzers are programs named in the configuration file that record
+// more about files than a scan does, such as the duration of a video or
+// the number of files in an archive.  Each is started once and kept
+// running.  For every new or changed file it matches, it's sent a line of
+// JSON with the file's path, size, mtime and mode, and answers with a line
+// holding a JSON object of attributes, which are kept in the extension
+// table.  An analyzer that fails is left out for the rest of the run.
+type analyzer struct {
+	// Command is the program and its arguments.
+	Command []string `json:"command"`
+	// Match are globs for the names of the files to analyze, or all of
+	// them if there are none.
+	Match []string `json:"match"`
+
+	cmd    *exec.Cmd
+	in     io.WriteCloser
+	out    *bufio.Reader
+	failed bool
+}
+
+// extensions adds the table of attributes from analyzers, and records of
+// the size and mtime files had when they were analyzed.
+func extensions(tx *sql.Tx) {
+	_, err := tx.Exec(`
+CREATE TABLE IF NOT EXISTS extension (
+        fileid integer,
+        name text,
+        value text,
+        PRIMARY KEY (fileid, name),
+        FOREIGN KEY (fileid) REFERENCES file(fileid) ON UPDATE RESTRICT ON DELETE CASCADE
+);`)
+	fatal(err)
+	addColumn(tx, "file", "analyzedsize", "integer")
+	addColumn(tx, "file", "analyzedmtime", "integer")
+}
+
+func (a *analyzer) matches(name string) bool {
+	if len(a.Match) == 0 {
+		return true
+	}
+	for _, m := range a.Match {
+		if ok, _ := filepath.Match(m, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *analyzer) start() error {
+	if len(a.Command) == 0 {
+		return errors.New("no command")
+	}
+	a.cmd = exec.Command(a.Command[0], a.Command[1:]...)
+	a.cmd.Stderr = os.Stderr
+	in, err := a.cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	out, err := a.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	a.in, a.out = in, bufio.NewReader(out)
+	return a.cmd.Start()
+}
+
+type analyzerRequest struct {
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	Mtime int64  `json:"mtime"`
+	Mode  string `json:"mode"`
+}
+
+// analyze asks the analyzer about a file, starting it if need be.
+func (a *analyzer) analyze(path string, info os.FileInfo) (map[string]string, error) {
+	if a.cmd == nil {
+		if err := a.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := json.Marshal(&analyzerRequest{path, info.Size(), info.ModTime().Unix(), info.Mode().String()})
+	fatal(err)
+	if _, err := a.in.Write(append(req, '\n')); err != nil {
+		return nil, err
+	}
+	line, err := a.out.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return nil, fmt.Errorf("bad answer about %s: %v", path, err)
+	}
+	attrs := make(map[string]string, len(values))
+	for k, v := range values {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			attrs[k] = v
+		case json.Number, bool:
+			attrs[k] = fmt.Sprint(v)
+		default:
+			b, _ := json.Marshal(v)
+			attrs[k] = string(b)
+		}
+	}
+	return attrs, nil
+}
+
+func (a *analyzer) stop() {
+	if a.cmd != nil && a.cmd.Process != nil {
+		a.in.Close()
+		a.cmd.Process.Kill()
+		a.cmd.Wait()
+	}
+}
+
+// analyzersFor returns the working analyzers matching a file name.
+func analyzersFor(name string) (result []*analyzer) {
+	for _, a := range getConfig().Analyzers {
+		if !a.failed && a.matches(name) {
+			result = append(result, a)
+		}
+	}
+	return
+}
+
+// analyzeFile collects the attributes of a file from analyzers.  If any
+// fail, it returns nil, so the file is analyzed again by the next scan.
+func analyzeFile(analyzers []*analyzer, path string, info os.FileInfo) map[string]string {
+	attrs := make(map[string]string)
+	for _, a := range analyzers {
+		values, err := a.analyze(path, info)
+		if err != nil {
+			log.Printf("analyzer %v failed, and won't be used again this run: %v", a.Command, err)
+			a.failed = true
+			a.stop()
+			attrs = nil
+			continue
+		}
+		for k, v := range values {
+			if attrs != nil {
+				attrs[k] = v
+			}
+		}
+	}
+	return attrs
+}
+
+// needsAnalysis tells whether a file has changed since it was last
+// analyzed.
+func (fdb *fileDB) needsAnalysis(dirid int64, root, path string, info os.FileInfo) bool {
+	var size, mtime sql.NullInt64
+	err := fdb.getAnalyzed.QueryRow(dirid, treePath(root, filepath.Dir(path)), filepath.Base(path)).Scan(&size, &mtime)
+	if err == sql.ErrNoRows {
+		return true
+	}
+	fatal(err)
+	return !size.Valid || size.Int64 != info.Size() || mtime.Int64 != info.ModTime().Unix()
+}
+
+// setExtensions replaces the attributes of fileid with those of a job.
+func (fdb *fileDB) setExtensions(tx *sql.Tx, fileid int64, job *insertJob) {
+	_, err := tx.Exec("DELETE FROM extension WHERE fileid = ?", fileid)
+	fatal(err)
+	for k, v := range job.attrs {
+		_, err = tx.Exec("INSERT INTO extension (fileid, name, value) VALUES (?,?,?)", fileid, k, v)
+		fatal(err)
+	}
+	_, err = tx.Exec("UPDATE file SET analyzedsize = ?, analyzedmtime = ? WHERE fileid = ?",
+		job.i.Size(), job.i.ModTime().Unix(), fileid)
+	fatal(err)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// Directories scanned with -anchor are also recorded by the UUID of their
+// filesystem and their path within it.  When that filesystem turns up
+// mounted somewhere else, the directory's history is moved to the new
+// mount point.
+
+// anchorDir looks up the filesystem anchor of a directory being scanned,
+// and moves the history of the directory it anchors to canonicalPath, given
+// as origPath, if the volume has moved.
+func (fdb *fileDB) anchorDir(dir, origPath, canonicalPath string) (uuid, relPath string) {
+	var anchored int
+	err := fdb.db.QueryRow("SELECT count(*) FROM dir WHERE fsuuid IS NOT NULL").Scan(&anchored)
+	fatal(err)
+	if !anchorRoots && anchored == 0 {
+		return "", ""
+	}
+
+	uuid, relPath, err = volumeAnchor(canonicalPath)
+	if err != nil {
+		if anchorRoots {
+			log.Printf("%s: not anchoring: %v", dir, err)
+		}
+		return "", ""
+	}
+
+	var dirid int64
+	var oldPath string
+	err = fdb.db.QueryRow(
+		`SELECT dirid, dirpath FROM dir WHERE fsuuid = ? AND relpath = ? AND `+onHost+` AND
+		NOT EXISTS (SELECT 1 FROM dir WHERE dirpath = ? AND `+onHost+`)`,
+		uuid, relPath, localHost, canonicalPath, localHost).Scan(&dirid, &oldPath)
+	if err == sql.ErrNoRows {
+		return
+	}
+	fatal(err)
+
+	fmt.Fprintf(stdout, "%s was mounted at %s.  Moving its history to %s\n", dir, oldPath, canonicalPath)
+	fdb.moveDir(dirid, canonicalPath, origPath)
+	return
+}
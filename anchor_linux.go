@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const byUUID = "/dev/disk/by-uuid"
+
+// volumeAnchor finds the UUID of the filesystem holding path, and path
+// relative to where that filesystem is mounted.
+func volumeAnchor(path string) (uuid, relPath string, err error) {
+	var st syscall.Stat_t
+	if err = syscall.Stat(path, &st); err != nil {
+		return
+	}
+
+	links, err := os.ReadDir(byUUID)
+	if err != nil {
+		return
+	}
+	for _, link := range links {
+		var dev syscall.Stat_t
+		if syscall.Stat(filepath.Join(byUUID, link.Name()), &dev) == nil && dev.Rdev == st.Dev {
+			uuid = link.Name()
+			break
+		}
+	}
+	if uuid == "" {
+		return "", "", errors.New("no filesystem UUID found")
+	}
+
+	mount := path
+	for mount != "/" {
+		var parent syscall.Stat_t
+		if err = syscall.Stat(filepath.Dir(mount), &parent); err != nil {
+			return
+		}
+		if parent.Dev != st.Dev {
+			break
+		}
+		mount = filepath.Dir(mount)
+	}
+
+	relPath, err = filepath.Rel(mount, path)
+	return
+}
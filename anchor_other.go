@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func volumeAnchor(path string) (uuid, relPath string, err error) {
+	return "", "", errors.New("filesystem UUIDs are only supported on Linux")
+}
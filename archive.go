@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// A directory archive holds the history of one directory, to hand to
+// another database.  It's a gzipped stream of JSON objects, one a line: a
+// header, then the directory's scans, then its files, each with all its
+// samples.  Paths are relative to the directory.  The header records the
+// schema version of the database it came from, and databases older than
+// that refuse it.
+
+func init() {
+	addCommand(&command{
+		name:     "export-dir",
+		synopsis: "[-o file] <dir>",
+		help:     "Write the history of dir, its scans and its files with all their samples, as an archive that import-dir can read into another database.",
+		run:      runExportDir,
+		readOnly: true,
+	})
+	addCommand(&command{
+		name:     "import-dir",
+		synopsis: "[-as dir] <file>",
+		help:     "Record the history in an archive written by export-dir, as a new directory under the path it came from, or under -as on this host.",
+		run:      runImportDir,
+	})
+}
+
+const archiveFormat = "filebase-dir"
+
+type archiveHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	Path    string `json:"path"`
+	Host    string `json:"host,omitempty"`
+	GivenAs string `json:"given_as,omitempty"`
+}
+
+type archiveRecord struct {
+	Scan *archiveScan `json:"scan,omitempty"`
+	File *archiveFile `json:"file,omitempty"`
+}
+
+type archiveScan struct {
+	Started  int64    `json:"started"`
+	Finished *int64   `json:"finished,omitempty"`
+	Duration *float64 `json:"duration,omitempty"`
+	Files    *int64   `json:"files,omitempty"`
+	Bytes    *int64   `json:"bytes,omitempty"`
+	Added    *int64   `json:"added,omitempty"`
+	Removed  *int64   `json:"removed,omitempty"`
+	Changed  *int64   `json:"changed,omitempty"`
+	Errors   *int64   `json:"errors,omitempty"`
+	Fraction *float64 `json:"fraction,omitempty"`
+}
+
+type archiveFile struct {
+	Path       string            `json:"path"`
+	MimeType   *string           `json:"mimetype,omitempty"`
+	UID        *int64            `json:"uid,omitempty"`
+	Hash       *string           `json:"hash,omitempty"`
+	HashSize   *int64            `json:"hashsize,omitempty"`
+	HashMtime  *int64            `json:"hashmtime,omitempty"`
+	LinkTarget *string           `json:"linktarget,omitempty"`
+	Extensions map[string]string `json:"extensions,omitempty"`
+	Samples    []archiveSample   `json:"samples"`
+}
+
+type archiveSample struct {
+	Time    int64   `json:"time"`
+	Mode    int64   `json:"mode"`
+	Size    int64   `json:"size"`
+	Mtime   int64   `json:"mtime"`
+	Source  string  `json:"source"`
+	Invalid *string `json:"invalid,omitempty"`
+	Atime   *int64  `json:"atime,omitempty"`
+	Broken  *bool   `json:"broken,omitempty"`
+	Disk    *int64  `json:"disk,omitempty"`
+}
+
+func runExportDir(args []string) {
+	fs := commandFlags("export-dir")
+	out := fs.String("o", "", "Write the archive to this file instead of stdout.")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	dirid, _ := cache.findDir(fs.Arg(0))
+	w := stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		fatal(err)
+		defer func() { fatal(f.Close()) }()
+		w = f
+	}
+	files := cache.exportDir(dirid, w)
+	if *out != "" {
+		fmt.Fprintf(stdout, "Exported %s, %d files, to %s\n", cache.getDirPath(dirid), files, *out)
+	}
+}
+
+// exportDir writes the archive of dirid to w, and returns how many files
+// it holds.
+func (fdb *fileDB) exportDir(dirid int64, w io.Writer) (files int64) {
+	bw := bufio.NewWriter(w)
+	zw := gzip.NewWriter(bw)
+	enc := json.NewEncoder(zw)
+
+	h := archiveHeader{Format: archiveFormat, Version: len(migrations)}
+	var host, givenAs sql.NullString
+	fatal(fdb.ro.QueryRow("SELECT dirpath, host, origpath FROM dir WHERE dirid = ?", dirid).Scan(&h.Path, &host, &givenAs))
+	h.Host, h.GivenAs = host.String, givenAs.String
+	fatal(enc.Encode(&h))
+
+	rows, err := fdb.ro.Query(
+		`SELECT started, finished, duration, files, bytes, added, removed, changed, errors, fraction
+		FROM scan WHERE dirid = ? ORDER BY started`, dirid)
+	fatal(err)
+	for rows.Next() {
+		var s archiveScan
+		fatal(rows.Scan(&s.Started, &s.Finished, &s.Duration, &s.Files, &s.Bytes,
+			&s.Added, &s.Removed, &s.Changed, &s.Errors, &s.Fraction))
+		fatal(enc.Encode(&archiveRecord{Scan: &s}))
+	}
+	fatal(rows.Err())
+	rows.Close()
+
+	// The files and their samples are read side by side, in fileid order.
+	rows, err = fdb.ro.Query(
+		`SELECT fileid, dirtree.path, name, mimetype, uid, hash, hashsize, hashmtime, linktarget
+		FROM file, dirtree WHERE file.dirid = ? AND dirtree.treeid = file.treeid
+		ORDER BY fileid`, dirid)
+	fatal(err)
+	defer rows.Close()
+	samples, err := fdb.ro.Query(
+		`SELECT sample.fileid, sampletime, mode, size, mtime, source, invalid, atime, broken, disk
+		FROM sample, file WHERE file.dirid = ? AND sample.fileid = file.fileid
+		ORDER BY sample.fileid, sampletime`, dirid)
+	fatal(err)
+	defer samples.Close()
+	exts, err := fdb.ro.Query(
+		`SELECT extension.fileid, extension.name, value
+		FROM extension, file WHERE file.dirid = ? AND extension.fileid = file.fileid
+		ORDER BY extension.fileid`, dirid)
+	fatal(err)
+	defer exts.Close()
+
+	var sampleID, extID int64
+	var s archiveSample
+	var extName, extValue string
+	moreSamples, moreExts := samples.Next(), exts.Next()
+	for rows.Next() {
+		var fileid int64
+		var dir, name string
+		var f archiveFile
+		fatal(rows.Scan(&fileid, &dir, &name, &f.MimeType, &f.UID, &f.Hash, &f.HashSize, &f.HashMtime, &f.LinkTarget))
+		f.Path = path.Join(dir, name)
+
+		for ; moreSamples; moreSamples = samples.Next() {
+			fatal(samples.Scan(&sampleID, &s.Time, &s.Mode, &s.Size, &s.Mtime, &s.Source, &s.Invalid, &s.Atime, &s.Broken, &s.Disk))
+			if sampleID > fileid {
+				break
+			}
+			if sampleID == fileid {
+				f.Samples = append(f.Samples, s)
+			}
+		}
+		for ; moreExts; moreExts = exts.Next() {
+			fatal(exts.Scan(&extID, &extName, &extValue))
+			if extID > fileid {
+				break
+			}
+			if extID == fileid {
+				if f.Extensions == nil {
+					f.Extensions = make(map[string]string)
+				}
+				f.Extensions[extName] = extValue
+			}
+		}
+
+		fatal(enc.Encode(&archiveRecord{File: &f}))
+		files++
+	}
+	fatal(rows.Err())
+	fatal(samples.Err())
+	fatal(exts.Err())
+
+	fatal(zw.Close())
+	fatal(bw.Flush())
+	return
+}
+
+func runImportDir(args []string) {
+	fs := commandFlags("import-dir")
+	as := fs.String("as", "", "Record the history under this directory on this host, instead of where it came from.")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	f, err := os.Open(fs.Arg(0))
+	fatal(err)
+	defer f.Close()
+	zr, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		fatal(fmt.Errorf("%s: not a directory archive: %w", fs.Arg(0), err))
+	}
+
+	root, files, err := cache.importDir(zr, *as)
+	if err != nil {
+		fatal(fmt.Errorf("%s: %w", fs.Arg(0), err))
+	}
+	fmt.Fprintf(stdout, "Imported %s, %d files\n", root, files)
+}
+
+// importDir records the archive read from r as a new directory, at as on
+// this host if it's given, and returns its path and how many files it
+// holds.  Archives that aren't, or that are from a newer schema, are
+// errors.
+func (fdb *fileDB) importDir(r io.Reader, as string) (root string, files int64, err error) {
+	dec := json.NewDecoder(r)
+	var h archiveHeader
+	if err = dec.Decode(&h); err != nil || h.Format != archiveFormat {
+		return "", 0, fmt.Errorf("not a directory archive")
+	}
+	if h.Version > len(migrations) {
+		return "", 0, fmt.Errorf("archive is from a newer filebase, at schema version %d, and this one is at %d",
+			h.Version, len(migrations))
+	}
+
+	root, host, givenAs := h.Path, h.Host, h.GivenAs
+	if as != "" {
+		if givenAs, err = filepath.Abs(as); err != nil {
+			return "", 0, err
+		}
+		root, host = givenAs, localHost
+		if resolved, err := filepath.EvalSymlinks(root); err == nil {
+			root = resolved
+		}
+	}
+	var dirid int64
+	switch err = fdb.db.QueryRow("SELECT dirid FROM dir WHERE dirpath = ? AND "+onHost, root, host).Scan(&dirid); err {
+	case sql.ErrNoRows:
+	case nil:
+		return "", 0, fmt.Errorf("%s is already recorded; use -as to import it under another path", root)
+	default:
+		fatal(err)
+	}
+
+	tx, err := fdb.db.Begin()
+	fatal(err)
+	defer tx.Rollback()
+	res, err := tx.Exec("INSERT INTO dir (dirpath, origpath, host) VALUES (?,?,?)", root, givenAs, host)
+	fatal(err)
+	dirid, err = res.LastInsertId()
+	fatal(err)
+
+	var lastScan interface{}
+	for {
+		var rec archiveRecord
+		if err = dec.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return "", 0, err
+		}
+
+		if s := rec.Scan; s != nil {
+			res, err := tx.Exec(
+				`INSERT INTO scan (dirid, started, finished, duration, files, bytes, added, removed, changed, errors, fraction)
+				VALUES (?,?,?,?,?,?,?,?,?,?,?)`,
+				dirid, s.Started, s.Finished, s.Duration, s.Files, s.Bytes, s.Added, s.Removed, s.Changed, s.Errors, s.Fraction)
+			fatal(err)
+			lastScan, err = res.LastInsertId()
+			fatal(err)
+		}
+
+		if f := rec.File; f != nil {
+			var fileid int64
+			dir := path.Dir(f.Path)
+			if dir == "." {
+				dir = ""
+			}
+			treeid := fdb.treeID(tx, dirid, dir)
+			fatal(tx.Stmt(fdb.upsertFile).QueryRow(dirid, treeid, path.Base(f.Path)).Scan(&fileid))
+			_, err = tx.Exec(
+				`UPDATE file SET mimetype = ?, uid = ?, hash = ?, hashsize = ?, hashmtime = ?, linktarget = ?, lastscan = ?
+				WHERE fileid = ?`,
+				f.MimeType, f.UID, f.Hash, f.HashSize, f.HashMtime, f.LinkTarget, lastScan, fileid)
+			fatal(err)
+			for _, s := range f.Samples {
+				_, err = tx.Exec(
+					`INSERT OR IGNORE INTO sample (fileid, sampletime, mode, size, mtime, source, invalid, atime, broken, disk)
+					VALUES (?,?,?,?,?,?,?,?,?,?)`,
+					fileid, s.Time, s.Mode, s.Size, s.Mtime, s.Source, s.Invalid, s.Atime, s.Broken, s.Disk)
+				fatal(err)
+			}
+			for k, v := range f.Extensions {
+				_, err = tx.Exec("INSERT OR REPLACE INTO extension (fileid, name, value) VALUES (?,?,?)", fileid, k, v)
+				fatal(err)
+			}
+			files++
+		}
+	}
+	fatal(tx.Commit())
+
+	fdb.indexNew(dirid)
+	return root, files, nil
+}
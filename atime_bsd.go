@@ -0,0 +1,21 @@
+//go:build darwin || freebsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileAtime returns when a file was last read, if the system reports it.
+func fileAtime(info os.FileInfo) (int64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int64(st.Atimespec.Sec), true
+}
+
+func noatimeMount(path string) bool {
+	return false
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// fileAtime returns when a file was last read, if the system reports it.
+func fileAtime(info os.FileInfo) (int64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int64(st.Atim.Sec), true
+}
+
+// noatimeMount tells whether path is on a filesystem mounted noatime, so
+// that reading files doesn't change their atime.
+func noatimeMount(path string) bool {
+	f, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	var mount string
+	noatime := false
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		mp := unescapeMount(fields[1])
+		if len(mp) >= len(mount) && (mp == "/" || path == mp || strings.HasPrefix(path, mp+"/")) {
+			mount = mp
+			noatime = false
+			for _, o := range strings.Split(fields[3], ",") {
+				if o == "noatime" {
+					noatime = true
+				}
+			}
+		}
+	}
+	return noatime
+}
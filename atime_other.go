@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+import "os"
+
+func fileAtime(info os.FileInfo) (int64, bool) {
+	return 0, false
+}
+
+func noatimeMount(path string) bool {
+	return false
+}
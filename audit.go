@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// An audit rereads files that haven't changed since they were hashed and
+// hashes them again.  A file whose contents changed while its size and
+// mtime didn't has been silently corrupted, by a failing disk or the like.
+
+// auditEnt is a file hashed with its size and mtime as they still are.
+type auditEnt struct {
+	path        string
+	size, mtime int64
+	hash        string
+}
+
+// auditFiles returns the files below path with a current hash.
+func (fdb *fileDB) auditFiles(dirid int64, path string) (result []auditEnt) {
+	args := append([]interface{}{dirid}, underPathArgs(path)...)
+	rows, err := fdb.ro.Query(
+		`select path, hashsize, hashmtime, hash from filepaths as file, sample
+		where file.fileid=sample.fileid and
+			file.dirid = ? and `+underPath+` and hash is not null and
+			sample.sampletime =	(
+				select max(sampletime) from sample where file.fileid=sample.fileid and invalid is null
+				) and
+			hashsize = size and hashmtime = mtime
+		order by path`, args...)
+	fatal(err)
+	defer rows.Close()
+	for rows.Next() {
+		var a auditEnt
+		fatal(rows.Scan(&a.path, &a.size, &a.mtime, &a.hash))
+		result = append(result, a)
+	}
+	fatal(rows.Err())
+	return
+}
+
+// A pacer keeps reading down to a number of bytes, or files, a second, or
+// doesn't if that's 0.
+type pacer struct {
+	rate  int64
+	start time.Time
+	bytes int64
+}
+
+func newPacer(rate int64) *pacer {
+	return &pacer{rate: rate, start: time.Now()}
+}
+
+// done counts n more bytes or files read, and sleeps until they're within
+// the rate.
+func (p *pacer) done(n int64) {
+	if p.rate <= 0 {
+		return
+	}
+	p.bytes += n
+	due := p.start.Add(time.Duration(float64(p.bytes) / float64(p.rate) * float64(time.Second)))
+	time.Sleep(time.Until(due))
+}
+
+// runAudit is verify with just a dir.
+func runAudit(dir string, limit int64) {
+	dirid, path := cache.findDir(dir)
+	if hostFilter != "" && hostFilter != localHost {
+		usagef("files on %s can't be read from %s", hostFilter, localHost)
+	}
+
+	var checked, bytes, changed, missing int64
+	var corrupt []auditEnt
+	p := newPacer(limit)
+	for _, a := range cache.auditFiles(dirid, path) {
+		info, err := os.Lstat(a.path)
+		switch {
+		case os.IsNotExist(err):
+			missing++
+			continue
+		case err != nil:
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		case info.Size() != a.size || info.ModTime().Unix() != a.mtime:
+			changed++
+			continue
+		}
+
+		hash := hashFile(a.path)
+		p.done(a.size)
+		if hash == "" {
+			continue
+		}
+		checked++
+		bytes += a.size
+		if hash != a.hash {
+			corrupt = append(corrupt, a)
+		}
+	}
+
+	printTitle(fmt.Sprintf("CORRUPTED FILES: %d", len(corrupt)))
+	t := newTableWriter()
+	for _, a := range corrupt {
+		t.File(a.path, fmt.Sprintf("%v\t%v\t%s", time.Unix(a.mtime, 0), sizeColumns(a.size), a.path), "")
+	}
+	t.Flush()
+	endReport()
+	fmt.Fprintf(stdout, "Checked %d files, %sB; skipped %d changed and %d missing since they were hashed\n",
+		checked, niceSize(bytes), changed, missing)
+
+	if len(corrupt) > 0 {
+		fatal(exitStatus(1))
+	}
+}
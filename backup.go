@@ -0,0 +1,188 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A backup's baseline is a copy of what its last scan found, kept as it
+// was, so that later scans of the original can be checked against it
+// whatever has happened to the backup's history since.
+
+func init() {
+	addCommand(&command{
+		name:     "baseline",
+		synopsis: "<dir>",
+		help:     "Keep what the last scan of dir found as its baseline: to verify the original against, if dir is a backup, or to approve it as it is, for drift.",
+		run:      runBaseline,
+	})
+	addCommand(&command{
+		name:     "verify",
+		synopsis: "[-limit rate] <dir> | verify [-hash] <dir> <backup>",
+		help:     "Hash the files under dir again that haven't changed since they were hashed (see -hash), and list those whose contents have changed anyway.  With a backup, check the files last recorded under dir against its baseline instead, and list those missing from it or with a different size or mtime.  Either way, exits with status 1 if any are found.",
+		run:      runVerify,
+		readOnly: true,
+	})
+}
+
+// baselines adds the table holding each directory's baseline.  Paths are
+// relative to the directory, like dirtree paths.
+func baselines(tx *sql.Tx) {
+	_, err := tx.Exec(`
+CREATE TABLE IF NOT EXISTS baseline (
+        dirid integer,
+        scanid integer,
+        path text,
+        size integer,
+        mtime integer,
+        hash text,
+        FOREIGN KEY (dirid) REFERENCES dir(dirid) ON UPDATE RESTRICT ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS baselinedir ON baseline(dirid);`)
+	fatal(err)
+}
+
+func runBaseline(args []string) {
+	fs := commandFlags("baseline")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	dirid, _ := cache.findDir(fs.Arg(0))
+	started, files := cache.setBaseline(dirid)
+	fmt.Fprintf(stdout, "Baseline of %s is %d files, from the scan at %s\n",
+		cache.getDirPath(dirid), files, started.Format("2006-01-02 15:04"))
+}
+
+// setBaseline replaces dirid's baseline with the latest state of its
+// files, and returns when the scan that found them started.
+func (fdb *fileDB) setBaseline(dirid int64) (started time.Time, files int64) {
+	var scanid, start int64
+	err := fdb.db.QueryRow(
+		`SELECT rowid, started FROM scan WHERE dirid = ? AND finished IS NOT NULL
+		ORDER BY started DESC LIMIT 1`, dirid).Scan(&scanid, &start)
+	if err == sql.ErrNoRows {
+		fatal(fmt.Errorf("%s has never been scanned", fdb.getDirPath(dirid)))
+	}
+	fatal(err)
+
+	tx, err := fdb.db.Begin()
+	fatal(err)
+	defer tx.Rollback()
+	_, err = tx.Exec("DELETE FROM baseline WHERE dirid = ?", dirid)
+	fatal(err)
+	res, err := tx.Exec(
+		`INSERT INTO baseline (dirid, scanid, path, size, mtime, hash)
+		SELECT file.dirid, ?, ltrim(dirtree.path || '/' || file.name, '/'), size, mtime,
+			CASE WHEN hashsize = size AND hashmtime = mtime THEN hash END
+		FROM file, dirtree, sample
+		WHERE file.dirid = ? AND dirtree.treeid = file.treeid AND sample.fileid = file.fileid AND
+			sample.sampletime = (
+				SELECT max(sampletime) FROM sample WHERE file.fileid = sample.fileid AND invalid IS NULL
+				)`, scanid, dirid)
+	fatal(err)
+	files, err = res.RowsAffected()
+	fatal(err)
+	fatal(tx.Commit())
+	return time.Unix(start, 0), files
+}
+
+// getBaseline returns dirid's baseline for the files below path, by their
+// path relative to path.
+func (fdb *fileDB) getBaseline(dirid int64, path string) (map[string]fileState, bool) {
+	prefix := treePath(fdb.getDirPath(dirid), path)
+	if prefix != "" {
+		prefix += "/"
+	}
+	rows, err := fdb.ro.Query(
+		`SELECT path, size, mtime, hash FROM baseline
+		WHERE dirid = ? AND substr(path, 1, length(?)) = ?`, dirid, prefix, prefix)
+	fatal(err)
+	defer rows.Close()
+
+	result := make(map[string]fileState)
+	for rows.Next() {
+		var p string
+		var f fileState
+		var hash sql.NullString
+		fatal(rows.Scan(&p, &f.size, &f.mtime, &hash))
+		f.hash = hash.String
+		result[strings.TrimPrefix(p, prefix)] = f
+	}
+	fatal(rows.Err())
+
+	if len(result) == 0 {
+		var n int
+		fatal(fdb.ro.QueryRow("SELECT count(*) FROM baseline WHERE dirid = ?", dirid).Scan(&n))
+		return result, n > 0
+	}
+	return result, true
+}
+
+func runVerify(args []string) {
+	fs := commandFlags("verify")
+	byHash := fs.Bool("hash", false, "Also check the contents of files hashed in both.")
+	var limit byteSize
+	fs.Var(&limit, "limit", "Read no more than this many bytes a second, such as 10M, so as to trickle along in the background.")
+	parseFlags(fs, args)
+	if fs.NArg() == 1 {
+		runAudit(fs.Arg(0), int64(limit))
+		return
+	}
+	needArgs(fs, 2)
+
+	dirid, path := cache.findDir(fs.Arg(0))
+	backupid, backupPath := cache.findDir(fs.Arg(1))
+	files := cache.latestFiles(dirid, path)
+	backup, ok := cache.getBaseline(backupid, backupPath)
+	if !ok {
+		fatal(fmt.Errorf("%s has no baseline; see the baseline command", fs.Arg(1)))
+	}
+
+	var missing, differ []string
+	reasons := make(map[string]string)
+	for p, f := range files {
+		b, ok := backup[p]
+		switch {
+		case !ok:
+			missing = append(missing, p)
+		case f.size != b.size:
+			reasons[p] = "size"
+		case f.mtime != b.mtime:
+			reasons[p] = "mtime"
+		case *byHash && f.hash != "" && b.hash != "" && f.hash != b.hash:
+			reasons[p] = "contents"
+		}
+	}
+	for p := range reasons {
+		differ = append(differ, p)
+	}
+
+	printCompared("MISSING FROM "+backupPath, path, missing, files)
+	printTitle(fmt.Sprintf("DIFFERENT IN %s: %d FILES", backupPath, len(differ)))
+	sort.Strings(differ)
+	t := newTableWriter()
+	for i, p := range differ {
+		if listSize >= 0 && i >= listSize {
+			break
+		}
+		fileBoth(t, path, backupPath, p, fmt.Sprintf("%v\t%v\t%s differs\t%s", sizeColumns(files[p].size), sizeColumns(backup[p].size), reasons[p], p))
+	}
+	t.Flush()
+	endReport()
+
+	// The verdict isn't a path, so keeps out of the way of -format paths.
+	var out io.Writer = stdout
+	if pathsOnly() {
+		out = os.Stderr
+	}
+	if len(missing)+len(differ) > 0 {
+		fmt.Fprintf(out, "%s does not match %s\n", backupPath, path)
+		fatal(exitStatus(1))
+	}
+	fmt.Fprintf(out, "%s matches %s\n", backupPath, path)
+}
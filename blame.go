@@ -0,0 +1,145 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "blame",
+		synopsis: "[-since age] <dir>",
+		help:     "Explain what used the space added under dir recently: new directories, new files and grown files, biggest first.",
+		run:      runBlame,
+		readOnly: true,
+	})
+}
+
+// A blameEnt is one cause of recent growth.
+type blameEnt struct {
+	delta int64
+	kind  string
+	files int
+	path  string
+}
+
+func runBlame(args []string) {
+	fs := commandFlags("blame")
+	since := fs.String("since", "24h", "How far back to look, such as 12h or 7d.")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	age, err := parseAge(*since)
+	if err != nil {
+		usagef("invalid -since %q", *since)
+	}
+
+	dirid, path := cache.findDir(fs.Arg(0))
+	blame := cache.getBlame(dirid, path, time.Now().Add(-age))
+
+	var total int64
+	for _, b := range blame {
+		total += b.delta
+	}
+	printTitle(fmt.Sprintf("GROWTH SINCE %s: %sB", time.Now().Add(-age).Format("2006-01-02 15:04"), niceSize(total)))
+	t := newTableWriter()
+	for i, b := range blame {
+		if listSize >= 0 && i >= listSize {
+			break
+		}
+		files := ""
+		if b.kind == "new dir" {
+			files = fmt.Sprintf(" (%d files)", b.files)
+		}
+		t.File(b.path, fmt.Sprintf("+%v\t%s\t%s%s", sizeColumns(b.delta), b.kind, b.path, files), "")
+	}
+	t.Flush()
+	endReport()
+}
+
+// parseAge parses a duration, also allowing a number of days like "7d".
+func parseAge(s string) (time.Duration, error) {
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		n, err := strconv.ParseFloat(days, 64)
+		return time.Duration(n * 24 * float64(time.Hour)), err
+	}
+	return time.ParseDuration(s)
+}
+
+// getBlame compares the latest sample of each file below path with its
+// last one before cutoff.  New files are gathered into the highest new
+// directory holding them, a directory being new if none of the files
+// below it were there before cutoff.
+func (fdb *fileDB) getBlame(dirid int64, path string, cutoff time.Time) []blameEnt {
+	args := append([]interface{}{cutoff.Unix(), dirid}, underPathArgs(path)...)
+	rows, err := fdb.ro.Query(
+		`select path, size,
+			(select size from sample as old where old.fileid = file.fileid and
+				old.invalid is null and old.sampletime <= ?
+				order by old.sampletime desc limit 1)
+		from filepaths as file, sample
+		where file.fileid=sample.fileid and
+			file.dirid = ? and `+underPath+` and
+			sample.sampletime =	(
+				select max(sampletime) from sample where file.fileid=sample.fileid and invalid is null
+				)`, args...)
+	fatal(err)
+	defer rows.Close()
+
+	root := strings.TrimSuffix(path, "/")
+	oldDirs := map[string]bool{}
+	var result, newFiles []blameEnt
+	for rows.Next() {
+		var p string
+		var size int64
+		var before sql.NullInt64
+		fatal(rows.Scan(&p, &size, &before))
+
+		if !before.Valid {
+			newFiles = append(newFiles, blameEnt{size, "new file", 1, p})
+			continue
+		}
+		for dir := filepath.Dir(p); len(dir) >= len(root) && !oldDirs[dir]; dir = filepath.Dir(dir) {
+			oldDirs[dir] = true
+		}
+		if size > before.Int64 {
+			result = append(result, blameEnt{size - before.Int64, "grown", 1, p})
+		}
+	}
+	fatal(rows.Err())
+
+	newDirs := map[string]*blameEnt{}
+	for _, f := range newFiles {
+		top := ""
+		for dir := filepath.Dir(f.path); len(dir) > len(root) && !oldDirs[dir]; dir = filepath.Dir(dir) {
+			top = dir
+		}
+		if top == "" {
+			result = append(result, f)
+			continue
+		}
+		d := newDirs[top]
+		if d == nil {
+			d = &blameEnt{kind: "new dir", path: top}
+			newDirs[top] = d
+		}
+		d.delta += f.delta
+		d.files++
+	}
+	for _, d := range newDirs {
+		result = append(result, *d)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].delta != result[j].delta {
+			return result[i].delta > result[j].delta
+		}
+		return result[i].path < result[j].path
+	})
+	return result
+}
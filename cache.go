@@ -0,0 +1,97 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Report results are kept in the database, so asking for the same report
+// again doesn't repeat the work.  They're keyed by the latest scan as well
+// as what was asked for, so a scan makes new ones without anything being
+// thrown away, and old ones age out.
+const maxCachedReports = 64
+
+type reportCacheKey struct {
+	Report string
+	Dirid  int64
+	N      int
+	// Scan is the latest scan's rowid, and Finished when the latest
+	// finished, so a report made during a scan isn't kept after it.
+	Scan, Finished int64
+	// Since is where the -window starts, rather than its length.
+	Since int64
+	reportOptions
+}
+
+type cachedFile struct {
+	Path    string
+	When    int64
+	Mode    int
+	Size    int64
+	Mtime   int64
+	Rate    float64
+	Samples int64
+}
+
+func (fdb *fileDB) reportKey(kind *reportKind, dirid int64, n int, o reportOptions) string {
+	var scan, finished sql.NullInt64
+	fatal(fdb.db.QueryRow("SELECT max(rowid), max(finished) FROM scan").Scan(&scan, &finished))
+	since := o.since()
+	o.Window = 0
+	key, err := json.Marshal(&reportCacheKey{kind.title, dirid, n, scan.Int64, finished.Int64, since, o})
+	fatal(err)
+	return string(key)
+}
+
+// cachedReport returns the files saved for a report, if there are any.
+func (fdb *fileDB) cachedReport(key string) (files []fileEnt, ok bool) {
+	var result []byte
+	err := fdb.db.QueryRow("SELECT result FROM reportcache WHERE key = ?", key).Scan(&result)
+	if err == sql.ErrNoRows {
+		return nil, false
+	}
+	fatal(err)
+
+	var cached []cachedFile
+	fatal(json.Unmarshal(result, &cached))
+	files = make([]fileEnt, len(cached))
+	for i, c := range cached {
+		files[i] = fileEnt{
+			path:    c.Path,
+			when:    time.Unix(c.When, 0),
+			mode:    c.Mode,
+			size:    c.Size,
+			mtime:   time.Unix(c.Mtime, 0),
+			rate:    c.Rate,
+			samples: c.Samples,
+		}
+	}
+	return files, true
+}
+
+func (fdb *fileDB) cacheReport(key string, files []fileEnt) {
+	if fdb.readOnly {
+		return
+	}
+	cached := make([]cachedFile, len(files))
+	for i, f := range files {
+		cached[i] = cachedFile{f.path, f.when.Unix(), f.mode, f.size, f.mtime.Unix(), f.rate, f.samples}
+	}
+	result, err := json.Marshal(cached)
+	fatal(err)
+
+	_, err = fdb.db.Exec("INSERT OR REPLACE INTO reportcache (key, result) VALUES (?,?)", key, result)
+	fatal(err)
+	_, err = fdb.db.Exec(
+		`DELETE FROM reportcache WHERE rowid NOT IN
+		(SELECT rowid FROM reportcache ORDER BY rowid DESC LIMIT ?)`, maxCachedReports)
+	fatal(err)
+}
+
+// changed empties the report cache.  It must be called whenever files,
+// samples or what filters them are modified other than by a scan.
+func (fdb *fileDB) changed() {
+	_, err := fdb.db.Exec("DELETE FROM reportcache")
+	fatal(err)
+}
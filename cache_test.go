@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestReportCache checks that a cached report is used until the next
+// scan, even one that never finishes, and no longer.
+func TestReportCache(t *testing.T) {
+	tmp := t.TempDir()
+	defer func(path string, cfg *config) { configPath, loadedConfig = path, cfg }(configPath, loadedConfig)
+	configPath, loadedConfig = filepath.Join(tmp, "none.json"), nil
+
+	root := filepath.Join(tmp, "tree")
+	write := func(size int) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(root, "a"), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write(10)
+
+	fdb, err := newFileDB(filepath.Join(tmp, "test.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fdb.close()
+	dirid := fdb.getDirID(root)
+
+	scan := func() {
+		t.Helper()
+		// Samples are keyed by the second they're taken in.
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+		if err := fdb.scanDir(dirid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	biggest := func() (size int64, cached bool) {
+		t.Helper()
+		_, cached = fdb.cachedReport(fdb.reportKey(biggestReport, dirid, 10, reportOptions{}))
+		it := fdb.getReport(dirid, biggestReport, 10, reportOptions{})
+		if !it.Next() {
+			t.Fatal("biggest report is empty")
+		}
+		return it.File().size, cached
+	}
+
+	scan()
+	if size, cached := biggest(); size != 10 || cached {
+		t.Errorf("first report gave %d bytes, cached %v; want 10, not cached", size, cached)
+	}
+	if size, cached := biggest(); size != 10 || !cached {
+		t.Errorf("second report gave %d bytes, cached %v; want 10, cached", size, cached)
+	}
+
+	write(20)
+	scan()
+	if size, cached := biggest(); size != 20 || cached {
+		t.Errorf("report after a scan gave %d bytes, cached %v; want 20, not cached", size, cached)
+	}
+
+	// A scan that fails part way still makes a new key.
+	fdb.beginScan(dirid, time.Now().Add(time.Second))
+	fdb.unlockScan(dirid)
+	if _, cached := biggest(); cached {
+		t.Error("report after an unfinished scan was cached")
+	}
+}
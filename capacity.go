@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Each scan records the size and free space of the filesystem holding the
+// directory, so that its growth can be weighed against the room left for
+// it.
+
+// capacity is the size of a filesystem and the room left on it.
+type capacity struct {
+	total      int64
+	free       int64
+	inodes     int64
+	freeInodes int64
+}
+
+// recordCapacity notes the capacity of the filesystem holding path at the
+// time of a scan.  Not knowing it isn't worth failing the scan over.
+func (fdb *fileDB) recordCapacity(dirid, scanid int64, path string) {
+	c, err := fsCapacity(path)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	_, err = fdb.db.Exec(
+		"INSERT INTO fscapacity (dirid, scanid, total, free, inodes, freeinodes) VALUES (?,?,?,?,?,?)",
+		dirid, scanid, c.total, c.free, c.inodes, c.freeInodes)
+	fatal(err)
+}
+
+// capacityEnt is the capacity recorded by a directory's last scan, with
+// the bytes it then held and how fast its files are growing.
+type capacityEnt struct {
+	capacity
+	when  time.Time
+	bytes int64
+	rate  float64
+}
+
+// daysLeft is how long it will take the directory's growth to fill the
+// filesystem, or -1 if it isn't growing.
+func (c *capacityEnt) daysLeft() float64 {
+	if c.rate <= 0 {
+		return -1
+	}
+	return float64(c.free) / (c.rate * secondsPerDay)
+}
+
+// getCapacity returns the capacity recorded by the last scan of dirid, or
+// nil if there's none.
+func (fdb *fileDB) getCapacity(dirid int64, o reportOptions) *capacityEnt {
+	c := &capacityEnt{}
+	var started int64
+	err := fdb.ro.QueryRow(
+		`select c.total, c.free, c.inodes, c.freeinodes, s.started, s.bytes
+		from fscapacity as c, scan as s
+		where c.dirid = ? and s.rowid = c.scanid and s.finished is not null
+		order by s.started desc limit 1`, dirid).Scan(
+		&c.total, &c.free, &c.inodes, &c.freeInodes, &started, &c.bytes)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	fatal(err)
+	c.when = time.Unix(started, 0)
+
+	err = fdb.ro.QueryRow(`select coalesce(sum(rate), 0) from (`+o.reportQuery()+`)`,
+		o.reportArgs(dirid)...).Scan(&c.rate)
+	fatal(err)
+	return c
+}
+
+// printCapacity prints the -capacity report.
+func printCapacity(dirid int64) {
+	printTitle("FILESYSTEM CAPACITY")
+	c := cache.getCapacity(dirid, opts)
+	if c == nil {
+		fmt.Fprintln(stdout, "No capacity recorded yet.")
+		endReport()
+		return
+	}
+
+	size := func(n int64) string { return strings.TrimSpace(niceSize(n)) + "B" }
+	t := newTableWriter()
+	t.Line("Filesystem\t"+size(c.total), "")
+	t.Line(fmt.Sprintf("Free\t%s\t%.1f%%", size(c.free), percent(c.free, c.total)), "")
+	t.Line(fmt.Sprintf("Tracked\t%s\t%.1f%%", size(c.bytes), percent(c.bytes, c.total)), "")
+	t.Line(fmt.Sprintf("Free inodes\t%d\t%.1f%%", c.freeInodes, percent(c.freeInodes, c.inodes)), "")
+	if c.rate != 0 {
+		perDay := c.rate * secondsPerDay
+		t.Line(fmt.Sprintf("Growth\t%sB/day\t%.2f%% of free", strings.TrimSpace(niceSizef(perDay)), 100*perDay/float64(c.free)), "")
+	}
+	if days := c.daysLeft(); days >= 0 && days < 100*365 {
+		t.Line(fmt.Sprintf("Full in\t%.0f days\t%s", days, c.when.AddDate(0, 0, int(days)).Format("2006-01-02")), "")
+	}
+	t.Line("Recorded\t"+c.when.Format(time.RFC3339), "")
+	t.Flush()
+	endReport()
+}
+
+func percent(n, of int64) float64 {
+	if of == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(of)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// categoryRule puts files in a category, such as "media" or "builds", by a
+// glob matched against their whole path, or against their content type
+// (see -mime).  Each file is in the category of the first rule it
+// matches, or "other".
+type categoryRule struct {
+	Category string `json:"category"`
+	Glob     string `json:"glob,omitempty"`
+	Mime     string `json:"mime,omitempty"`
+}
+
+// categoryRules are the built-in rules for the -categories report.  Rules
+// under "categories" in the configuration file come before them, so they
+// can override them.
+var categoryRules = []categoryRule{
+	{Category: "builds", Glob: "*/node_modules/*"},
+	{Category: "builds", Glob: "*/target/*"},
+	{Category: "builds", Glob: "*/build/*"},
+	{Category: "builds", Glob: "*/dist/*"},
+	{Category: "builds", Glob: "*/.gradle/*"},
+	{Category: "builds", Glob: "*.o"},
+	{Category: "builds", Glob: "*.a"},
+	{Category: "builds", Glob: "*.class"},
+	{Category: "builds", Glob: "*.pyc"},
+	{Category: "backups", Glob: "*/backup/*"},
+	{Category: "backups", Glob: "*/backups/*"},
+	{Category: "backups", Glob: "*.bak"},
+	{Category: "backups", Glob: "*.old"},
+	{Category: "backups", Glob: "*.orig"},
+	{Category: "backups", Glob: "*~"},
+	{Category: "databases", Glob: "*.sqlite"},
+	{Category: "databases", Glob: "*.sqlite3"},
+	{Category: "databases", Glob: "*.db"},
+	{Category: "databases", Glob: "*-wal"},
+	{Category: "databases", Glob: "*.ibd"},
+	{Category: "databases", Glob: "*.mdb"},
+	{Category: "archives", Glob: "*.zip"},
+	{Category: "archives", Glob: "*.tar"},
+	{Category: "archives", Glob: "*.gz"},
+	{Category: "archives", Glob: "*.tgz"},
+	{Category: "archives", Glob: "*.xz"},
+	{Category: "archives", Glob: "*.bz2"},
+	{Category: "archives", Glob: "*.7z"},
+	{Category: "media", Mime: "image/*"},
+	{Category: "media", Mime: "video/*"},
+	{Category: "media", Mime: "audio/*"},
+	{Category: "media", Glob: "*.jpg"},
+	{Category: "media", Glob: "*.jpeg"},
+	{Category: "media", Glob: "*.png"},
+	{Category: "media", Glob: "*.heic"},
+	{Category: "media", Glob: "*.mp4"},
+	{Category: "media", Glob: "*.mkv"},
+	{Category: "media", Glob: "*.mov"},
+	{Category: "media", Glob: "*.mp3"},
+	{Category: "media", Glob: "*.flac"},
+	{Category: "media", Glob: "*.wav"},
+}
+
+func allCategoryRules() []categoryRule {
+	return append(append([]categoryRule(nil), getConfig().Categories...), categoryRules...)
+}
+
+type categoryEnt struct {
+	name  string
+	size  int64
+	files int64
+	rate  float64
+}
+
+// getCategoryTotals totals the latest size and growth rate of the files in
+// dirid by category, biggest first.
+func (fdb *fileDB) getCategoryTotals(dirid int64, o reportOptions) (result []categoryEnt) {
+	rules, err := json.Marshal(allCategoryRules())
+	fatal(err)
+
+	category := `,
+		coalesce((select json_extract(rule.value, '$.category') from json_each(?) as rule
+			where file.path GLOB json_extract(rule.value, '$.glob') or
+				coalesce(file.mimetype, '') GLOB json_extract(rule.value, '$.mime')
+			order by rule.key limit 1), 'other') as category`
+	rows, err := fdb.ro.Query(
+		`select category, sum(size), count(*), coalesce(sum(rate), 0)
+		from (`+o.reportQueryWith(category)+`)
+		group by category`,
+		append([]interface{}{string(rules)}, o.reportArgs(dirid)...)...)
+	fatal(err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var c categoryEnt
+		fatal(rows.Scan(&c.name, &c.size, &c.files, &c.rate))
+		result = append(result, c)
+	}
+	fatal(rows.Err())
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].size != result[j].size {
+			return result[i].size > result[j].size
+		}
+		return result[i].name < result[j].name
+	})
+	return
+}
+
+// printCategories prints the -categories report.
+func printCategories(dirid int64) {
+	printTitle("CATEGORIES")
+	t := newTableWriter()
+	for _, c := range cache.getCategoryTotals(dirid, opts) {
+		t.Line(fmt.Sprintf("%v\t%d files\t%sB/day\t%s", sizeColumns(c.size), c.files, niceSizef(c.rate*secondsPerDay), c.name), "")
+	}
+	t.Flush()
+	endReport()
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "report",
+		synopsis: "[-since age] [-depth n] <dir>",
+		help:     "List the files under dir that are new, have grown or shrunk, or have been deleted since a time, biggest change first.  With -depth, total the changes by the directories that many levels below dir instead.",
+		run:      runReport,
+		readOnly: true,
+	})
+}
+
+// Files that a scan doesn't find any more are forgotten along with their
+// samples, so each is recorded as vanished first, with its last size, to
+// tell what was deleted and when.
+
+// vanishedFiles adds the table of files that scans found deleted.  Their
+// paths are relative to the scanned directory, like dirtree paths.
+func vanishedFiles(tx *sql.Tx) {
+	_, err := tx.Exec(`
+CREATE TABLE IF NOT EXISTS vanished (
+        dirid integer,
+        scanid integer,
+        path text,
+        size integer,
+        firstseen integer,
+        FOREIGN KEY (dirid) REFERENCES dir(dirid) ON UPDATE RESTRICT ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS vanishedscan ON vanished(scanid);`)
+	fatal(err)
+}
+
+// recordVanished records the files in dirid that scanid didn't find,
+// before they're deleted.
+func (fdb *fileDB) recordVanished(dirid, scanid int64) {
+	_, err := fdb.db.Exec(
+		`INSERT INTO vanished (dirid, scanid, path, size, firstseen, uid)
+		SELECT file.dirid, ?, ltrim(dirtree.path || '/' || file.name, '/'),
+			(SELECT size FROM sample WHERE sample.fileid = file.fileid AND invalid IS NULL
+				ORDER BY sampletime DESC LIMIT 1),
+			(SELECT min(sampletime) FROM sample WHERE sample.fileid = file.fileid),
+			file.uid
+		FROM file, dirtree
+		WHERE file.dirid = ? AND file.lastscan IS NOT ? AND dirtree.treeid = file.treeid`,
+		scanid, dirid, scanid)
+	fatal(err)
+}
+
+// A changeEnt is a file that changed size since the reference time.
+type changeEnt struct {
+	delta int64
+	kind  string
+	size  int64
+	path  string
+}
+
+func runReport(args []string) {
+	fs := commandFlags("report")
+	since := fs.String("since", "24h", "How far back to look, such as 12h or 7d.")
+	depth := fs.Int("depth", 0, "Total the changes by the directories this many levels below dir.")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	age, err := parseAge(*since)
+	if err != nil {
+		usagef("invalid -since %q", *since)
+	}
+
+	cutoff := time.Now().Add(-age)
+	dirid, path := cache.findDir(fs.Arg(0))
+	changes := cache.getChanges(dirid, path, cutoff)
+
+	var total int64
+	for _, c := range changes {
+		total += c.delta
+	}
+	printTitle(fmt.Sprintf("CHANGES SINCE %s: %s", cutoff.Format("2006-01-02 15:04"), signedSize(total)))
+	if *depth > 0 {
+		printChangesByPrefix(changes, path, *depth)
+		return
+	}
+	t := newTableWriter()
+	for i, c := range changes {
+		if listSize >= 0 && i >= listSize {
+			break
+		}
+		t.File(c.path, fmt.Sprintf("%s\t%s\t%v\t%s", signedSize(c.delta), c.kind, sizeColumns(c.size), c.path), "")
+	}
+	t.Flush()
+	endReport()
+}
+
+// A prefixEnt is the net change in the files below a directory.
+type prefixEnt struct {
+	delta int64
+	files int
+	path  string
+}
+
+// printChangesByPrefix totals changes by the directory depth levels below
+// root holding them, or by file for files less deep, and prints the
+// totals, most growth first.
+func printChangesByPrefix(changes []changeEnt, root string, depth int) {
+	prefixes := map[string]*prefixEnt{}
+	for _, c := range changes {
+		p := prefixAt(root, c.path, depth)
+		e := prefixes[p]
+		if e == nil {
+			e = &prefixEnt{path: p}
+			prefixes[p] = e
+		}
+		e.delta += c.delta
+		e.files++
+	}
+
+	result := make([]*prefixEnt, 0, len(prefixes))
+	for _, e := range prefixes {
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].delta != result[j].delta {
+			return result[i].delta > result[j].delta
+		}
+		return result[i].path < result[j].path
+	})
+
+	t := newTableWriter()
+	for i, e := range result {
+		if listSize >= 0 && i >= listSize {
+			break
+		}
+		t.File(e.path, fmt.Sprintf("%s\t%d files\t%s", signedSize(e.delta), e.files, e.path), "")
+	}
+	t.Flush()
+	endReport()
+}
+
+// prefixAt returns path cut off depth levels below root.
+func prefixAt(root, path string, depth int) string {
+	root = strings.TrimSuffix(root, "/")
+	rest := strings.TrimPrefix(path, root+"/")
+	if rest == path {
+		return path
+	}
+	parts := strings.SplitN(rest, "/", depth+1)
+	if len(parts) > depth {
+		parts = parts[:depth]
+	}
+	return root + "/" + strings.Join(parts, "/")
+}
+
+// signedSize is niceSize with a sign in front.
+func signedSize(n int64) string {
+	if n < 0 {
+		return "-" + niceSize(-n) + "B"
+	}
+	return "+" + niceSize(n) + "B"
+}
+
+// getChanges compares the latest sample of each file below path with its
+// last one before cutoff, and adds the files deleted since then, biggest
+// change first.  Files that came and went since cutoff aren't included.
+func (fdb *fileDB) getChanges(dirid int64, path string, cutoff time.Time) (result []changeEnt) {
+	args := append([]interface{}{cutoff.Unix(), dirid}, underPathArgs(path)...)
+	rows, err := fdb.ro.Query(
+		`select path, size,
+			(select size from sample as old where old.fileid = file.fileid and
+				old.invalid is null and old.sampletime <= ?
+				order by old.sampletime desc limit 1)
+		from filepaths as file, sample
+		where file.fileid=sample.fileid and
+			file.dirid = ? and `+underPath+` and
+			sample.sampletime =	(
+				select max(sampletime) from sample where file.fileid=sample.fileid and invalid is null
+				)`, args...)
+	fatal(err)
+	for rows.Next() {
+		var c changeEnt
+		var before sql.NullInt64
+		fatal(rows.Scan(&c.path, &c.size, &before))
+		switch {
+		case !before.Valid:
+			c.kind, c.delta = "new", c.size
+		case c.size > before.Int64:
+			c.kind, c.delta = "grown", c.size-before.Int64
+		case c.size < before.Int64:
+			c.kind, c.delta = "shrunk", c.size-before.Int64
+		default:
+			continue
+		}
+		result = append(result, c)
+	}
+	fatal(rows.Err())
+	rows.Close()
+
+	args = append([]interface{}{dirid, cutoff.Unix(), cutoff.Unix()}, underPathArgs(path)...)
+	rows, err = fdb.ro.Query(
+		`select path, size from (
+			select rtrim(dir.dirpath, '/') || '/' || v.path as path, v.size as size
+			from vanished as v, scan, dir
+			where v.dirid = ? and scan.rowid = v.scanid and dir.dirid = v.dirid and
+				scan.started > ? and v.firstseen <= ? and v.size is not null
+		) as file
+		where `+underPath, args...)
+	fatal(err)
+	defer rows.Close()
+	for rows.Next() {
+		c := changeEnt{kind: "deleted"}
+		fatal(rows.Scan(&c.path, &c.size))
+		c.delta = -c.size
+		result = append(result, c)
+	}
+	fatal(rows.Err())
+
+	sort.Slice(result, func(i, j int) bool {
+		di, dj := result[i].delta, result[j].delta
+		if di < 0 {
+			di = -di
+		}
+		if dj < 0 {
+			dj = -dj
+		}
+		if di != dj {
+			return di > dj
+		}
+		return result[i].path < result[j].path
+	})
+	return
+}
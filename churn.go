@@ -0,0 +1,52 @@
+package main
+
+import "fmt"
+
+// churnEnt is a file and how many times it was seen to have changed.
+type churnEnt struct {
+	path    string
+	changes int64
+	samples int64
+	size    int64
+}
+
+// getChurn ranks the files in dirid by how many of their samples found a
+// different size or mtime from the one before.
+func (fdb *fileDB) getChurn(dirid int64, n int, o reportOptions) (result []churnEnt) {
+	rows, err := fdb.ro.Query(
+		`select path, sum(changed), count(*), (select size from sample as last
+				where last.fileid = s.fileid and last.invalid is null order by sampletime desc limit 1)
+		from (
+			select file.path, sample.fileid,
+				(size != lag(size) over w or mtime != lag(mtime) over w) as changed
+			from filepaths as file, sample
+			where file.fileid=sample.fileid and
+				file.dirid = ?`+nameFilter+` and sample.invalid is null
+			window w as (partition by sample.fileid order by sampletime)
+		) as s
+		group by s.fileid
+		having sum(changed) > 0
+		order by sum(changed) desc, path
+		limit ? offset ?`, o.filterArgs(dirid, o.limit(n), o.Offset)...)
+	fatal(err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var c churnEnt
+		fatal(rows.Scan(&c.path, &c.changes, &c.samples, &c.size))
+		result = append(result, c)
+	}
+	fatal(rows.Err())
+	return
+}
+
+// printChurn prints the -churn report.
+func printChurn(dirid int64) {
+	printTitle("MOST FREQUENTLY CHANGED FILES")
+	t := newTableWriter()
+	for _, c := range cache.getChurn(dirid, listSize, opts) {
+		t.File(c.path, fmt.Sprintf("%d of %d samples\t%v\t%s", c.changes, c.samples, sizeColumns(c.size), c.path), "")
+	}
+	t.Flush()
+	endReport()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// When stdout is a terminal, text output is aligned into columns, and
+// files are colored unless -no-color or $NO_COLOR is set.
+var terminal, colorize bool
+
+const (
+	colorReset = "\x1b[0m"
+	colorRed   = "\x1b[31m"
+	colorDim   = "\x1b[2m"
+
+	// Files growing by this fraction of their size per day are shown in
+	// red, and those untouched for oldAge are dimmed.
+	fastGrowth = 0.01
+	oldAge     = 365 * 24 * time.Hour
+)
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func fileColor(f *fileEnt) string {
+	switch {
+	case f.rate > 0 && f.rate*secondsPerDay >= fastGrowth*float64(f.size):
+		return colorRed
+	case time.Since(f.mtime) > oldAge:
+		return colorDim
+	}
+	return ""
+}
+
+// tableWriter prints tab separated lines.  On a terminal it holds them
+// until Flush, so that it can line up their columns, and with -format html
+// or markdown so that it can make a table of them.  With -format csv or
+// json they're rows of a rowWriter.
+type tableWriter struct {
+	rows   [][]string
+	colors []string
+	w      rowWriter
+}
+
+func newTableWriter() *tableWriter {
+	return &tableWriter{}
+}
+
+// Line adds a line of tab separated cells.  Lines that aren't about one
+// file are left out of -format paths.
+func (t *tableWriter) Line(line, color string) {
+	if pathsOnly() {
+		return
+	}
+	if outputFormat == "csv" || outputFormat == "json" {
+		if t.w == nil {
+			t.w = newRowWriter(stdout)
+		}
+		cells := strings.Split(line, "\t")
+		vals := make([]interface{}, len(cells))
+		for i, c := range cells {
+			vals[i] = strings.TrimSpace(c)
+		}
+		t.w.Row(vals)
+		return
+	}
+	if !terminal && outputFormat != "html" && outputFormat != "markdown" {
+		fmt.Fprintln(stdout, line)
+		return
+	}
+	t.rows = append(t.rows, strings.Split(line, "\t"))
+	t.colors = append(t.colors, color)
+}
+
+// File adds the line for the file at path, or lists just its path for
+// -format paths.
+func (t *tableWriter) File(path, line, color string) {
+	if pathsOnly() {
+		writePath(stdout, path)
+		return
+	}
+	t.Line(line, color)
+}
+
+func (t *tableWriter) Flush() {
+	if t.w != nil {
+		t.w.Flush()
+		t.w = nil
+		return
+	}
+	if outputFormat == "html" || outputFormat == "markdown" {
+		switch {
+		case len(t.rows) == 0:
+		case outputFormat == "html":
+			printHTMLTable(t.rows, t.colors)
+		default:
+			printMarkdownTable(t.rows)
+		}
+		t.rows, t.colors = nil, nil
+		return
+	}
+
+	var widths []int
+	for _, cells := range t.rows {
+		for i, c := range cells {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := utf8.RuneCountInString(c); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	var b strings.Builder
+	for r, cells := range t.rows {
+		b.Reset()
+		color := colorize && t.colors[r] != ""
+		if color {
+			b.WriteString(t.colors[r])
+		}
+		for i, c := range cells {
+			b.WriteString(c)
+			if i < len(cells)-1 {
+				b.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c)+2))
+			}
+		}
+		if color {
+			b.WriteString(colorReset)
+		}
+		fmt.Fprintln(stdout, b.String())
+	}
+	t.rows, t.colors = nil, nil
+}
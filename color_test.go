@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// TestTableWriterFormats checks that table lines, titles and the space
+// after reports keep out of the formats meant for programs.
+func TestTableWriterFormats(t *testing.T) {
+	defer func(w io.Writer, format string, term bool) {
+		stdout, outputFormat, terminal = w, format, term
+	}(stdout, outputFormat, terminal)
+	terminal = false
+
+	tests := []struct {
+		format, want string
+	}{
+		{"csv", "2.00,a\ntotal,2.00\n"},
+		{"json", "[\n[\"2.00\",\"a\"],\n[\"total\",\"2.00\"]\n]\n"},
+		{"paths", "/d/a\n"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		stdout, outputFormat = &b, tt.format
+		printTitle("TITLE")
+		w := newTableWriter()
+		w.File("/d/a", "2.00 \ta", "")
+		w.Line("total\t2.00 ", "")
+		w.Flush()
+		endReport()
+		if got := b.String(); got != tt.want {
+			t.Errorf("-format %s wrote %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
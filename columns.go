@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A fileColumn is a field of a file report that can be chosen with
+// -columns.  text formats it for people, and value for csv and json.
+type fileColumn struct {
+	name  string
+	text  func(f *fileEnt) string
+	value func(f *fileEnt) interface{}
+}
+
+var fileColumns = []*fileColumn{
+	{"path",
+		func(f *fileEnt) string { return f.path },
+		func(f *fileEnt) interface{} { return f.path }},
+	{"size",
+		func(f *fileEnt) string { return niceSize(f.size) },
+		func(f *fileEnt) interface{} { return f.size }},
+	{"bytes",
+		func(f *fileEnt) string { return localNumber(fmt.Sprint(f.size)) },
+		func(f *fileEnt) interface{} { return f.size }},
+	{"mtime",
+		func(f *fileEnt) string { return f.mtime.String() },
+		func(f *fileEnt) interface{} { return f.mtime.Format(time.RFC3339) }},
+	{"mode",
+		func(f *fileEnt) string { return fmt.Sprintf("%o", f.mode) },
+		func(f *fileEnt) interface{} { return f.mode }},
+	{"rate",
+		func(f *fileEnt) string {
+			if f.rate == 0 {
+				return ""
+			}
+			return niceSizef(f.rate*secondsPerDay) + "B/day"
+		},
+		func(f *fileEnt) interface{} { return f.rate * secondsPerDay }},
+	{"samples",
+		func(f *fileEnt) string { return fmt.Sprint(f.samples) },
+		func(f *fileEnt) interface{} { return f.samples }},
+	{"sampled",
+		func(f *fileEnt) string { return f.when.String() },
+		func(f *fileEnt) interface{} { return f.when.Format(time.RFC3339) }},
+	{"dir",
+		func(f *fileEnt) string { return f.dir },
+		func(f *fileEnt) interface{} { return f.dir }},
+	{"note",
+		func(f *fileEnt) string { return noteFor(f.path) },
+		func(f *fileEnt) interface{} { return noteFor(f.path) }},
+}
+
+// defaultColumns are used for csv and json output when -columns isn't
+// given.  Text output then keeps its traditional layout.
+func defaultColumns() string {
+	if allDirs {
+		return "dir,path,size,mtime,mode,rate,samples,note"
+	}
+	return "path,size,mtime,mode,rate,samples,note"
+}
+
+func parseColumns(s string) (cols []*fileColumn, err error) {
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		var col *fileColumn
+		for _, c := range fileColumns {
+			if c.name == name {
+				col = c
+			}
+		}
+		if col == nil {
+			return nil, fmt.Errorf("no column named %q", name)
+		}
+		cols = append(cols, col)
+	}
+	return
+}
+
+// textColumns are used for aligned text output on a terminal, or with
+// -all-dirs, when -columns isn't given, matching the traditional layout.
+func textColumns() string {
+	cols := "mtime,mode,size,rate,path,note"
+	if showBytes {
+		cols = "mtime,mode,size,bytes,rate,path,note"
+	}
+	if allDirs {
+		cols = "dir," + cols
+	}
+	return cols
+}
+
+// fileWriter prints the files of a report in the chosen -format and
+// -columns.  Markdown, unlike csv and json, is for people, so gets the
+// text of each column.
+type fileWriter struct {
+	w     rowWriter
+	t     *tableWriter
+	h     *htmlTable
+	cols  []*fileColumn
+	vals  []interface{}
+	cells []htmlCell
+}
+
+func newFileWriter() *fileWriter {
+	cols := columns
+	if pathsOnly() {
+		var err error
+		cols, err = parseColumns("path")
+		fatal(err)
+	}
+	if cols == nil && (outputFormat != "text" || terminal || allDirs) {
+		names := defaultColumns()
+		if outputFormat == "text" {
+			names = textColumns()
+		}
+		var err error
+		cols, err = parseColumns(names)
+		fatal(err)
+	}
+
+	if outputFormat == "text" {
+		return &fileWriter{t: newTableWriter(), cols: cols}
+	}
+
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.name
+	}
+	if outputFormat == "html" {
+		return &fileWriter{h: newHTMLTable(stdout, names), cols: cols, cells: make([]htmlCell, len(cols))}
+	}
+
+	fw := &fileWriter{w: newRowWriter(stdout), cols: cols, vals: make([]interface{}, len(cols))}
+	fw.w.Header(names)
+	return fw
+}
+
+func (fw *fileWriter) Write(f *fileEnt) {
+	if fw.t != nil {
+		if fw.cols == nil {
+			line := f.String()
+			if note := noteFor(f.path); note != "" {
+				line += "\t" + note
+			}
+			fw.t.Line(line, "")
+			return
+		}
+		cells := make([]string, len(fw.cols))
+		for i, c := range fw.cols {
+			cells[i] = c.text(f)
+		}
+		fw.t.Line(strings.Join(cells, "\t"), fileColor(f))
+		return
+	}
+	if fw.h != nil {
+		// Sizes and times are shown for people, but sorted by value.
+		for i, c := range fw.cols {
+			fw.cells[i] = htmlCell{c.text(f), c.value(f)}
+		}
+		fw.h.Row(fw.cells, fileColor(f))
+		return
+	}
+
+	for i, c := range fw.cols {
+		if outputFormat == "markdown" {
+			fw.vals[i] = c.text(f)
+		} else {
+			fw.vals[i] = c.value(f)
+		}
+	}
+	fw.w.Row(fw.vals)
+}
+
+func (fw *fileWriter) Flush() {
+	switch {
+	case fw.t != nil:
+		fw.t.Flush()
+	case fw.h != nil:
+		fw.h.Close()
+	default:
+		fw.w.Flush()
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestParseColumns(t *testing.T) {
+	tests := []struct {
+		s     string
+		names []string
+		ok    bool
+	}{
+		{"path", []string{"path"}, true},
+		{"size,path", []string{"size", "path"}, true},
+		{" mtime , mode,rate ", []string{"mtime", "mode", "rate"}, true},
+		{"path,path", []string{"path", "path"}, true},
+		{"path,size,bytes,mtime,mode,rate,samples", []string{"path", "size", "bytes", "mtime", "mode", "rate", "samples"}, true},
+		{"path,owner", nil, false},
+		{"Size", nil, false},
+		{"", nil, false},
+		{"path,", nil, false},
+	}
+	for _, tt := range tests {
+		cols, err := parseColumns(tt.s)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseColumns(%q) error = %v, want ok %v", tt.s, err, tt.ok)
+			continue
+		}
+		if tt.names == nil {
+			continue
+		}
+		if len(cols) != len(tt.names) {
+			t.Errorf("parseColumns(%q) gave %d columns, want %d", tt.s, len(cols), len(tt.names))
+			continue
+		}
+		for i, c := range cols {
+			if c.name != tt.names[i] {
+				t.Errorf("parseColumns(%q) column %d is %s, want %s", tt.s, i, c.name, tt.names[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A command is a subcommand, like "filebase find".  If the first argument
+// after the flags names a command, it is run instead of scanning and
+// reporting on the arguments as directories.
+type command struct {
+	name     string
+	synopsis string
+	help     string
+	run      func(args []string)
+
+	// noDB is set for commands that don't use the database, and readOnly
+	// for those that only read it, which then open it read-only.
+	noDB     bool
+	readOnly bool
+}
+
+var commands = map[string]*command{}
+
+func addCommand(cmd *command) {
+	commands[cmd.name] = cmd
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] dir...\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(out, "       %s [flags] command [args]\n", filepath.Base(os.Args[0]))
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(out, "\nCommands:")
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Fprintf(out, "  %s %s\n    \t%s\n", cmd.name, cmd.synopsis, cmd.help)
+	}
+
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+// commandFlags returns a FlagSet for a command's own flags, which follow the
+// command name.
+func commandFlags(cmd string) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.Usage = func() {
+		c := commands[cmd]
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] %s %s\n", filepath.Base(os.Args[0]), c.name, c.synopsis)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses a command's arguments, ending it as flag.ExitOnError
+// would if they're wrong or ask for help, but by way of fatal so the
+// database is closed behind it.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	switch err := fs.Parse(args); {
+	case err == flag.ErrHelp:
+		fatal(exitStatus(0))
+	case err != nil:
+		fatal(exitStatus(2))
+	}
+}
+
+// badUsage shows the command's usage and ends it with status 2.
+func badUsage(fs *flag.FlagSet) {
+	fs.Usage()
+	fatal(exitStatus(2))
+}
+
+// needArgs ends the command with its usage unless there are exactly n
+// arguments.
+func needArgs(fs *flag.FlagSet, n int) {
+	if fs.NArg() != n {
+		badUsage(fs)
+	}
+}
+
+// findDir locates the registered directory containing dir, which need not
+// exist any more, on the -host or this one.  It returns the directory's
+// id and the absolute path that was asked for.
+func (fdb *fileDB) findDir(dir string) (dirid int64, path string) {
+	// Directories ingested from agents are named host:/path and are
+	// matched as given.
+	if host, _, ok := strings.Cut(dir, ":/"); ok {
+		if dirid, ok := fdb.lookupDir(host, dir); ok {
+			return dirid, dir
+		}
+	}
+
+	path, err := filepath.Abs(dir)
+	fatal(err)
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	host := localHost
+	if hostFilter != "" {
+		host = hostFilter
+	}
+	dirid, ok := fdb.lookupDir(host, path)
+	if !ok {
+		fatal(fmt.Errorf("%s is not in a recorded directory", dir))
+	}
+	return
+}
+
+func (fdb *fileDB) lookupDir(host, path string) (dirid int64, ok bool) {
+	err := fdb.db.QueryRow(
+		`SELECT dirid FROM dir
+		WHERE (dirpath = ? OR substr(?, 1, length(dirpath) + 1) = dirpath || '/' OR dirpath = '/') AND `+onHost+`
+		ORDER BY length(dirpath) DESC, host IS NULL LIMIT 1`, path, path, host).Scan(&dirid)
+	if err == sql.ErrNoRows {
+		return 0, false
+	}
+	fatal(err)
+	return dirid, true
+}
+
+// onHost is an SQL condition matching directories scanned on a host, or
+// recorded before hosts were.  Its argument is the host.
+const onHost = "(dir.host IS NULL OR dir.host = ?)"
+
+// forHost is an SQL condition matching directories scanned on the -host,
+// or every directory if none was given.  Its arguments come from
+// forHostArgs.
+const forHost = "(? = '' OR dir.host = ?)"
+
+func forHostArgs() []interface{} {
+	return []interface{}{hostFilter, hostFilter}
+}
+
+// underPath is an SQL condition matching file paths at or below a
+// directory.  Its arguments come from underPathArgs.
+const underPath = "(file.path = ? OR substr(file.path, 1, length(?) + 1) = ? || '/')"
+
+func underPathArgs(path string) []interface{} {
+	path = strings.TrimSuffix(path, "/")
+	return []interface{}{path, path, path}
+}
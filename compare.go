@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "compare",
+		synopsis: "[-hash] <dirA> <dirB>",
+		help:     "Compare what was last recorded under two dirs, by relative path and size, and list the files only in one of them or different in both, such as a mirror and its original.  Exits with status 1 if they differ.",
+		run:      runCompare,
+		readOnly: true,
+	})
+}
+
+// A fileState is what was last recorded about a file.  Its hash is empty
+// unless it was hashed (see -hash) at its current size and mtime.
+type fileState struct {
+	size  int64
+	mtime int64
+	hash  string
+}
+
+func runCompare(args []string) {
+	fs := commandFlags("compare")
+	byHash := fs.Bool("hash", false, "Also compare the contents of files hashed in both dirs.")
+	parseFlags(fs, args)
+	needArgs(fs, 2)
+
+	dirA, pathA := cache.findDir(fs.Arg(0))
+	dirB, pathB := cache.findDir(fs.Arg(1))
+	filesA := cache.latestFiles(dirA, pathA)
+	filesB := cache.latestFiles(dirB, pathB)
+
+	var onlyA, onlyB, differ []string
+	for p, a := range filesA {
+		b, ok := filesB[p]
+		switch {
+		case !ok:
+			onlyA = append(onlyA, p)
+		case a.size != b.size || *byHash && a.hash != "" && b.hash != "" && a.hash != b.hash:
+			differ = append(differ, p)
+		}
+	}
+	for p := range filesB {
+		if _, ok := filesA[p]; !ok {
+			onlyB = append(onlyB, p)
+		}
+	}
+
+	printCompared("ONLY IN "+pathA, pathA, onlyA, filesA)
+	printCompared("ONLY IN "+pathB, pathB, onlyB, filesB)
+	printTitle(fmt.Sprintf("DIFFERENT: %d FILES", len(differ)))
+	sort.Strings(differ)
+	t := newTableWriter()
+	for i, p := range differ {
+		if listSize >= 0 && i >= listSize {
+			break
+		}
+		note := ""
+		if filesA[p].size == filesB[p].size {
+			note = "\t(contents differ)"
+		}
+		fileBoth(t, pathA, pathB, p, fmt.Sprintf("%v\t%v\t%s%s", sizeColumns(filesA[p].size), sizeColumns(filesB[p].size), p, note))
+	}
+	t.Flush()
+	endReport()
+
+	if len(onlyA)+len(onlyB)+len(differ) > 0 {
+		fatal(exitStatus(1))
+	}
+}
+
+// printCompared lists files found on one side only, biggest first.  Their
+// paths are relative to root, which is added back for -format paths.
+func printCompared(title, root string, paths []string, files map[string]fileState) {
+	var total int64
+	for _, p := range paths {
+		total += files[p].size
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if files[paths[i]].size != files[paths[j]].size {
+			return files[paths[i]].size > files[paths[j]].size
+		}
+		return paths[i] < paths[j]
+	})
+	printTitle(fmt.Sprintf("%s: %d FILES, %sB", title, len(paths), niceSize(total)))
+	t := newTableWriter()
+	for i, p := range paths {
+		if listSize >= 0 && i >= listSize {
+			break
+		}
+		t.File(filepath.Join(root, p), fmt.Sprintf("%v\t%s", sizeColumns(files[p].size), p), "")
+	}
+	t.Flush()
+	endReport()
+}
+
+// fileBoth adds the line for a file found under both rootA and rootB, by
+// its path relative to them, listing both its paths for -format paths.
+func fileBoth(t *tableWriter, rootA, rootB, p, line string) {
+	t.File(filepath.Join(rootA, p), line, "")
+	if pathsOnly() {
+		writePath(stdout, filepath.Join(rootB, p))
+	}
+}
+
+// latestFiles returns the latest sample of each file below path, by its
+// path relative to path.
+func (fdb *fileDB) latestFiles(dirid int64, path string) map[string]fileState {
+	args := append([]interface{}{dirid}, underPathArgs(path)...)
+	rows, err := fdb.ro.Query(
+		`select path, size, mtime,
+			case when hashsize = size and hashmtime = mtime then hash end
+		from filepaths as file, sample
+		where file.fileid=sample.fileid and
+			file.dirid = ? and `+underPath+` and
+			sample.sampletime =	(
+				select max(sampletime) from sample where file.fileid=sample.fileid and invalid is null
+				)`, args...)
+	fatal(err)
+	defer rows.Close()
+
+	root := strings.TrimSuffix(path, "/") + "/"
+	result := make(map[string]fileState)
+	for rows.Next() {
+		var p string
+		var f fileState
+		var hash sql.NullString
+		fatal(rows.Scan(&p, &f.size, &f.mtime, &hash))
+		f.hash = hash.String
+		result[strings.TrimPrefix(p, root)] = f
+	}
+	fatal(rows.Err())
+	return result
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestCompare scans two trees and checks that compare lists each
+// difference by its path on the side it was found, and exits 1.
+func TestCompare(t *testing.T) {
+	tmp := t.TempDir()
+	defer func(path string, cfg *config) { configPath, loadedConfig = path, cfg }(configPath, loadedConfig)
+	defer func(fdb *fileDB, w io.Writer, format string, n int) {
+		cache, stdout, outputFormat, listSize = fdb, w, format, n
+	}(cache, stdout, outputFormat, listSize)
+	configPath, loadedConfig = filepath.Join(tmp, "none.json"), nil
+
+	write := func(path string, size int) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rootA, rootB := filepath.Join(tmp, "a"), filepath.Join(tmp, "b")
+	write(filepath.Join(rootA, "same"), 5)
+	write(filepath.Join(rootA, "onlyA"), 10)
+	write(filepath.Join(rootA, "sub/differ"), 7)
+	write(filepath.Join(rootB, "same"), 5)
+	write(filepath.Join(rootB, "onlyB"), 3)
+	write(filepath.Join(rootB, "sub/differ"), 8)
+
+	var err error
+	cache, err = newFileDB(filepath.Join(tmp, "test.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.close()
+	var paths []string
+	for _, root := range []string{rootA, rootB} {
+		dirid := cache.getDirID(root)
+		if err := cache.scanDir(dirid); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, cache.getDirPath(dirid))
+	}
+
+	var out bytes.Buffer
+	stdout, outputFormat, listSize = &out, "paths", -1
+	err = func() (err error) {
+		defer catch(&err, "")
+		runCompare([]string{rootA, rootB})
+		return nil
+	}()
+	var status exitStatus
+	if !errors.As(err, &status) || status != 1 {
+		t.Errorf("compare ended with %v, want exit status 1", err)
+	}
+
+	pathA, pathB := paths[0], paths[1]
+	want := []string{
+		filepath.Join(pathA, "onlyA"),
+		filepath.Join(pathB, "onlyB"),
+		filepath.Join(pathA, "sub/differ"),
+		filepath.Join(pathB, "sub/differ"),
+	}
+	if got := strings.Fields(out.String()); !reflect.DeepEqual(got, want) {
+		t.Errorf("compare listed %q, want %q", got, want)
+	}
+}
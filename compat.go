@@ -0,0 +1,159 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fixtures holds databases in the formats written by earlier versions, as
+// SQL, each with the results it should give.  Add one whenever a release
+// changes the schema.
+//
+//go:embed fixtures
+var fixtures embed.FS
+
+type fixtureExpect struct {
+	Dir     string
+	Files   int64
+	Bytes   int64
+	Biggest []string
+	Fastest []struct {
+		Path string
+		Rate float64
+	}
+}
+
+func init() {
+	addCommand(&command{
+		name:     "db",
+		synopsis: "compat | check [-repair] | index [-drop]",
+		help:     "Maintain the database.  compat checks that databases from older versions still open and give the right results.  check looks for corruption and leftover rows, which -repair removes.  index makes the path index used by search afresh, or with -drop removes it.",
+		run:      runDB,
+		noDB:     true,
+	})
+}
+
+func runDB(args []string) {
+	flags := commandFlags("db")
+	repair := flags.Bool("repair", false, "With check, remove the leftover rows found.")
+	drop := flags.Bool("drop", false, "With index, remove the path index.")
+	parseFlags(flags, args)
+
+	switch {
+	case flags.Arg(0) == "check":
+		// Let -repair follow the subcommand too.
+		parseFlags(flags, flags.Args()[1:])
+		if flags.NArg() != 0 {
+			badUsage(flags)
+		}
+		runCheckDB(*repair)
+	case flags.Arg(0) == "index":
+		parseFlags(flags, flags.Args()[1:])
+		if flags.NArg() != 0 {
+			badUsage(flags)
+		}
+		runIndex(*drop)
+	case flags.Arg(0) == "compat" && flags.NArg() == 1:
+		if !checkCompat() {
+			fatal(exitStatus(1))
+		}
+	default:
+		badUsage(flags)
+	}
+}
+
+func checkCompat() (ok bool) {
+	names, err := fs.Glob(fixtures, "fixtures/*.sql")
+	fatal(err)
+
+	ok = true
+	for _, name := range names {
+		problems := checkFixture(name)
+		if len(problems) == 0 {
+			fmt.Fprintf(stdout, "ok\t%s\n", name)
+			continue
+		}
+		ok = false
+		fmt.Fprintf(stdout, "FAIL\t%s\n", name)
+		for _, p := range problems {
+			fmt.Fprintf(stdout, "\t%s\n", p)
+		}
+	}
+	return
+}
+
+// checkFixture builds the old database, opens it as usual, which brings it
+// up to date, and checks the reports on it.
+func checkFixture(name string) (problems []string) {
+	script, err := fixtures.ReadFile(name)
+	fatal(err)
+	expectJSON, err := fixtures.ReadFile(strings.TrimSuffix(name, ".sql") + ".json")
+	fatal(err)
+	var expect fixtureExpect
+	fatal(json.Unmarshal(expectJSON, &expect))
+
+	tmp, err := os.MkdirTemp("", "filebase-compat-")
+	fatal(err)
+	defer os.RemoveAll(tmp)
+	path := filepath.Join(tmp, "old.sqlite3")
+
+	old, err := sql.Open("sqlite3", path)
+	fatal(err)
+	_, err = old.Exec(string(script))
+	old.Close()
+	if err != nil {
+		return []string{fmt.Sprintf("fixture doesn't load: %v", err)}
+	}
+
+	fdb, err := newFileDB(path)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	defer fdb.close()
+
+	dirid, ok := fdb.lookupDir(localHost, expect.Dir)
+	if !ok {
+		return []string{fmt.Sprintf("%s not found", expect.Dir)}
+	}
+
+	o := reportOptions{NoCache: true}
+	var files, bytes int64
+	biggest := fdb.getReport(dirid, biggestReport, -1, o)
+	var paths []string
+	for biggest.Next() {
+		f := biggest.File()
+		files++
+		bytes += f.size
+		paths = append(paths, f.path)
+	}
+	if files != expect.Files || bytes != expect.Bytes {
+		problems = append(problems, fmt.Sprintf("%d files of %d bytes, expected %d of %d", files, bytes, expect.Files, expect.Bytes))
+	}
+	if strings.Join(paths, "\n") != strings.Join(expect.Biggest, "\n") {
+		problems = append(problems, fmt.Sprintf("biggest files are %q, expected %q", paths, expect.Biggest))
+	}
+
+	fastest := fdb.getReport(dirid, fastestReport, -1, o)
+	i := 0
+	for fastest.Next() {
+		f := fastest.File()
+		if i >= len(expect.Fastest) {
+			problems = append(problems, fmt.Sprintf("unexpected fastest file %s", f.path))
+		} else if e := expect.Fastest[i]; f.path != e.Path || math.Abs(f.rate*secondsPerDay-e.Rate) > 0.001 {
+			problems = append(problems, fmt.Sprintf("fastest file %d is %s at %g bytes/day, expected %s at %g",
+				i+1, f.path, f.rate*secondsPerDay, e.Path, e.Rate))
+		}
+		i++
+	}
+	if i < len(expect.Fastest) {
+		problems = append(problems, fmt.Sprintf("%d fastest files, expected %d", i, len(expect.Fastest)))
+	}
+	return
+}
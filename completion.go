@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "completion",
+		synopsis: "bash|zsh|fish",
+		help:     "Write a script completing commands, flags and recorded directories in a shell, such as with source <(filebase completion bash) in .bashrc.  The directories are looked up in the database as they're completed.",
+		run:      runCompletion,
+		noDB:     true,
+	})
+}
+
+// The scripts run "filebase completion dirs" for the recorded directories,
+// passing on any -db given on the command line being completed.
+
+func runCompletion(args []string) {
+	fs := commandFlags("completion")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	w := bufio.NewWriter(stdout)
+	defer func() { fatal(w.Flush()) }()
+	c := newCompletions()
+	switch fs.Arg(0) {
+	case "bash":
+		c.bash(w)
+	case "zsh":
+		c.zsh(w)
+	case "fish":
+		c.fish(w)
+	case "dirs":
+		var err error
+		cache, err = openReadOnlyDB(dbPath)
+		fatal(err)
+		defer cache.close()
+		for _, d := range cache.listDirs() {
+			fmt.Fprintln(w, d.path)
+		}
+	default:
+		badUsage(fs)
+	}
+}
+
+// completions is what the scripts complete, gathered from the commands
+// and flags.  Commands parse their own flags only when run, so those are
+// taken from their synopses, as are their subcommands.
+type completions struct {
+	prog        string
+	commands    []*command
+	flags       []*flag.Flag
+	valueFlags  []string
+	cmdFlags    map[string][]string
+	subcommands map[string][]string
+}
+
+var (
+	synopsisFlag       = regexp.MustCompile(`(?:^|[\s\[])-([a-z][a-z0-9-]*)`)
+	synopsisSubcommand = regexp.MustCompile(`^[a-z]+$`)
+)
+
+func newCompletions() *completions {
+	c := &completions{
+		prog:        filepath.Base(os.Args[0]),
+		cmdFlags:    make(map[string][]string),
+		subcommands: make(map[string][]string),
+	}
+	for _, cmd := range commands {
+		c.commands = append(c.commands, cmd)
+		for _, m := range synopsisFlag.FindAllStringSubmatch(cmd.synopsis, -1) {
+			c.cmdFlags[cmd.name] = appendNew(c.cmdFlags[cmd.name], "-"+m[1])
+		}
+		for _, alt := range strings.Split(cmd.synopsis, "|") {
+			word := strings.Fields(alt + " ")
+			if len(word) > 0 && synopsisSubcommand.MatchString(word[0]) && word[0] != cmd.name {
+				c.subcommands[cmd.name] = appendNew(c.subcommands[cmd.name], word[0])
+			}
+		}
+	}
+	sort.Slice(c.commands, func(i, j int) bool { return c.commands[i].name < c.commands[j].name })
+
+	flag.VisitAll(func(f *flag.Flag) {
+		c.flags = append(c.flags, f)
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+			c.valueFlags = append(c.valueFlags, "-"+f.Name)
+		}
+	})
+	return c
+}
+
+func appendNew(list []string, s string) []string {
+	for _, l := range list {
+		if l == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// firstSentence shortens help to fit beside a completion.
+func firstSentence(help string) string {
+	s, _, _ := strings.Cut(help, ".  ")
+	return strings.TrimSuffix(s, ".")
+}
+
+func (c *completions) flagNames() (names []string) {
+	for _, f := range c.flags {
+		names = append(names, "-"+f.Name)
+	}
+	return
+}
+
+func (c *completions) commandNames() (names []string) {
+	for _, cmd := range c.commands {
+		names = append(names, cmd.name)
+	}
+	return
+}
+
+func (c *completions) bash(w *bufio.Writer) {
+	fmt.Fprintf(w, `_filebase() {
+	local cur="${COMP_WORDS[COMP_CWORD]}" cmd="" i
+	local -a db
+	for ((i = 1; i < COMP_CWORD; i++)); do
+		case "${COMP_WORDS[i]}" in
+		-db) db=(-db "${COMP_WORDS[i+1]}"); ((i++)) ;;
+		%s) ((i++)) ;;
+		-*) ;;
+		*) cmd="${COMP_WORDS[i]}"; break ;;
+		esac
+	done
+	local dirs
+	dirs="$(%s "${db[@]}" completion dirs 2>/dev/null)"
+	local IFS=$'\n'
+
+	if [[ $cur == -* ]]; then
+		case "$cmd" in
+		"") COMPREPLY=($(compgen -W "%s" -- "$cur")) ;;
+`, strings.Join(c.valueFlags, "|"), c.prog, strings.Join(c.flagNames(), "\n"))
+	for _, cmd := range c.commands {
+		if flags := c.cmdFlags[cmd.name]; len(flags) > 0 {
+			fmt.Fprintf(w, "\t\t%s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n", cmd.name, strings.Join(flags, "\n"))
+		}
+	}
+	fmt.Fprintf(w, `		esac
+		return
+	fi
+
+	local words="$dirs"
+	case "$cmd" in
+	"") words="%s"$'\n'"$dirs" ;;
+`, strings.Join(c.commandNames(), "\n"))
+	for _, cmd := range c.commands {
+		if subs := c.subcommands[cmd.name]; len(subs) > 0 {
+			fmt.Fprintf(w, "\t%s) words=\"%s\"$'\\n'\"$dirs\" ;;\n", cmd.name, strings.Join(subs, "\n"))
+		}
+	}
+	fmt.Fprintf(w, `	esac
+	COMPREPLY=($(compgen -W "$words" -- "$cur"))
+}
+complete -o default -F _filebase %s
+`, c.prog)
+}
+
+// zshQuote quotes s for zsh, in single quotes.
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (c *completions) zsh(w *bufio.Writer) {
+	fmt.Fprintf(w, "#compdef %s\n\n_filebase() {\n\tlocal -a commands flags dirs db\n\tlocal cmd i\n\tcommands=(\n", c.prog)
+	for _, cmd := range c.commands {
+		fmt.Fprintf(w, "\t\t%s\n", zshQuote(cmd.name+":"+firstSentence(cmd.help)))
+	}
+	fmt.Fprint(w, "\t)\n\tflags=(\n")
+	for _, f := range c.flags {
+		fmt.Fprintf(w, "\t\t%s\n", zshQuote("-"+f.Name+":"+firstSentence(f.Usage)))
+	}
+	fmt.Fprintf(w, `	)
+	for ((i = 2; i < CURRENT; i++)); do
+		case $words[i] in
+		-db) db=(-db $words[i+1]); ((i++)) ;;
+		%s) ((i++)) ;;
+		-*) ;;
+		*) cmd=$words[i]; break ;;
+		esac
+	done
+	dirs=(${(f)"$(%s $db completion dirs 2>/dev/null)"})
+
+	if [[ $PREFIX == -* ]]; then
+		case $cmd in
+		'') _describe flag flags ;;
+`, strings.Join(c.valueFlags, "|"), c.prog)
+	for _, cmd := range c.commands {
+		if flags := c.cmdFlags[cmd.name]; len(flags) > 0 {
+			fmt.Fprintf(w, "\t\t%s) compadd -- %s ;;\n", cmd.name, strings.Join(flags, " "))
+		}
+	}
+	fmt.Fprint(w, `		esac
+		return
+	fi
+
+	case $cmd in
+	'') _describe command commands ;;
+`)
+	for _, cmd := range c.commands {
+		if subs := c.subcommands[cmd.name]; len(subs) > 0 {
+			fmt.Fprintf(w, "\t%s) compadd -- %s ;;\n", cmd.name, strings.Join(subs, " "))
+		}
+	}
+	fmt.Fprintf(w, `	esac
+	compadd -a dirs
+	_files
+}
+
+compdef _filebase %s
+`, c.prog)
+}
+
+// fishQuote quotes s for fish, in single quotes.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func (c *completions) fish(w *bufio.Writer) {
+	fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -a '(%[1]s completion dirs 2>/dev/null)'\n", c.prog)
+	for _, cmd := range c.commands {
+		fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -a %s -d %s\n", c.prog, cmd.name, fishQuote(firstSentence(cmd.help)))
+	}
+	for _, f := range c.flags {
+		required := ""
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+			required = " -r"
+		}
+		fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -o %s%s -d %s\n", c.prog, f.Name, required, fishQuote(firstSentence(f.Usage)))
+	}
+	for _, cmd := range c.commands {
+		seen := fmt.Sprintf("'__fish_seen_subcommand_from %s'", cmd.name)
+		for _, f := range c.cmdFlags[cmd.name] {
+			fmt.Fprintf(w, "complete -c %s -n %s -o %s\n", c.prog, seen, strings.TrimPrefix(f, "-"))
+		}
+		if subs := c.subcommands[cmd.name]; len(subs) > 0 {
+			fmt.Fprintf(w, "complete -c %s -n %s -a %s\n", c.prog, seen, fishQuote(strings.Join(subs, " ")))
+		}
+		if !cmd.noDB {
+			fmt.Fprintf(w, "complete -c %s -n %s -a '(%[1]s completion dirs 2>/dev/null)'\n", c.prog, seen)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// config is the optional JSON configuration file, for settings that are
+// too long-lived or too detailed for flags.
+type config struct {
+	// Quotas are soft quotas by owner name.  "*" applies to everyone
+	// without one of their own.
+	Quotas map[string]byteSize `json:"quotas"`
+
+	Mail mailConfig `json:"mail"`
+
+	// Alerts are checked after every scan.
+	Alerts []*alertRule `json:"alerts"`
+
+	// Schedule is when the daemon rescans directories, unless Schedules
+	// has one for their path.  See parseSchedule.
+	Schedule  string            `json:"schedule"`
+	Schedules map[string]string `json:"schedules"`
+
+	// Junk adds to the patterns the -junk report looks for.
+	Junk []junkPattern `json:"junk"`
+
+	// Categories come before the built-in rules for the -categories
+	// report.
+	Categories []categoryRule `json:"categories"`
+
+	// Blackouts are times the daemon mustn't scan, by directory path, or
+	// "*" for all of them.  See parseBlackout.
+	Blackouts map[string][]string `json:"blackouts"`
+
+	// Profiles keep unrelated sets of directories apart, each in its own
+	// database.  See applyProfile.
+	Profiles map[string]*profile `json:"profiles"`
+
+	// Analyzers record more about new and changed files as they're
+	// scanned.  See analyzer.
+	Analyzers []*analyzer `json:"analyzers"`
+
+	// Backups, if set, are copies of the database made before history
+	// is thrown away.  See fileDB.backup.
+	Backups *backupConfig `json:"backups"`
+
+	// Database, if set, is how big or fast growing the database may get
+	// before scans warn about it.  See fileDB.checkDBSize.
+	Database *dbLimits `json:"database"`
+
+	// TSDB, if set, is a time-series database samples are forwarded to.
+	// See tsdbSink.
+	TSDB *tsdbConfig `json:"tsdb"`
+}
+
+// A profile, chosen with -profile, supplies the database to use, the
+// directories to scan when none are given, and patterns to -exclude.
+type profile struct {
+	DB       string   `json:"db"`
+	Dirs     []string `json:"dirs"`
+	Excludes []string `json:"excludes"`
+}
+
+type mailConfig struct {
+	From     string `json:"from"`
+	Domain   string `json:"domain"`
+	Template string `json:"template"`
+
+	// SMTP is the host:port alerts and -email-to reports are mailed
+	// through, logging in with Username and Password if they're given.
+	SMTP     string `json:"smtp"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+var loadedConfig *config
+
+// getConfig reads the configuration file the first time it's needed.  It's
+// fine for there to be none.
+func getConfig() *config {
+	if loadedConfig != nil {
+		return loadedConfig
+	}
+
+	loadedConfig = &config{}
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return loadedConfig
+	}
+	fatal(err)
+	if err = json.Unmarshal(data, loadedConfig); err != nil {
+		fatal(fmt.Errorf("%s: %w", configPath, err))
+	}
+	return loadedConfig
+}
+
+// lookupOwner finds the uid of a user given by name or number.
+func lookupOwner(name string) (int64, error) {
+	if uid, err := strconv.ParseInt(name, 10, 64); err == nil {
+		return uid, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(u.Uid, 10, 64)
+}
+
+// ownerName is the user name for a uid, or the number if it has none.
+func ownerName(uid int64) string {
+	id := strconv.FormatInt(uid, 10)
+	if u, err := user.LookupId(id); err == nil {
+		return u.Username
+	}
+	return id
+}
+
+// applyProfile puts the named profile into effect.  Flags given on the
+// command line win over its settings, and its excludes are added to any
+// that were given.  It returns the profile's directories.
+func applyProfile(name string) (dirs []string) {
+	p := getConfig().Profiles[name]
+	if p == nil {
+		usagef("%s: no profile named %q", configPath, name)
+	}
+
+	dbGiven := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "db" {
+			dbGiven = true
+		}
+	})
+	if p.DB != "" && !dbGiven {
+		dbPath = expandHome(p.DB)
+	}
+	opts.Excludes = append(opts.Excludes, p.Excludes...)
+
+	for _, dir := range p.Dirs {
+		dirs = append(dirs, expandHome(dir))
+	}
+	return
+}
+
+// expandHome replaces a leading ~ in path with the home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	fatal(err)
+	return filepath.Join(home, path[1:])
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// Each scan records how many files each directory holds directly, so that
+// directories filling up with many small files can be found, which sizes
+// alone don't show.  Directories are recorded by their dirtree path.
+
+// recordDirCounts counts the files found by a scan in each directory.
+func (fdb *fileDB) recordDirCounts(dirid, scanid int64) {
+	_, err := fdb.db.Exec(
+		`INSERT INTO dircount (dirid, scanid, path, files)
+		SELECT dirtree.dirid, ?, dirtree.path, count(*) FROM dirtree, file
+		WHERE dirtree.dirid = ? AND file.treeid = dirtree.treeid AND file.lastscan = ?
+		GROUP BY dirtree.treeid`, scanid, dirid, scanid)
+	fatal(err)
+}
+
+// countEnt is a directory's file count in the last scan, with its change
+// since the scan before and its average change per day since it was first
+// counted, if that was at least minRateSpan before.
+type countEnt struct {
+	path   string
+	files  int64
+	change int64
+	perDay sql.NullFloat64
+}
+
+// getDirCounts returns the n directories in dirid holding the most files
+// in its last scan.
+func (fdb *fileDB) getDirCounts(dirid int64, n int, o reportOptions) (result []countEnt) {
+	root := fdb.getDirPath(dirid)
+	rows, err := fdb.ro.Query(
+		`select c.path, c.files,
+			(select prev.files from dircount as prev, scan as ps
+				where prev.dirid = c.dirid and prev.path = c.path and ps.rowid = prev.scanid and ps.started < s.started
+				order by ps.started desc limit 1),
+			(select first.files from dircount as first, scan as fs
+				where first.dirid = c.dirid and first.path = c.path and fs.rowid = first.scanid
+				order by fs.started limit 1),
+			(select min(fs.started) from dircount as first, scan as fs
+				where first.dirid = c.dirid and first.path = c.path and fs.rowid = first.scanid),
+			s.started
+		from dircount as c, scan as s
+		where c.dirid = ? and s.rowid = c.scanid and
+			c.scanid = (select rowid from scan where dirid = ? and finished is not null order by started desc limit 1)
+		order by c.files desc, c.path
+		limit ? offset ?`, dirid, dirid, o.limit(n), o.Offset)
+	fatal(err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var c countEnt
+		var prev sql.NullInt64
+		var first, firstTime, lastTime int64
+		fatal(rows.Scan(&c.path, &c.files, &prev, &first, &firstTime, &lastTime))
+		c.path = filepath.Join(root, c.path)
+		if prev.Valid {
+			c.change = c.files - prev.Int64
+		}
+		if time.Duration(lastTime-firstTime)*time.Second >= minRateSpan {
+			c.perDay.Float64 = float64(c.files-first) / (float64(lastTime-firstTime) / secondsPerDay)
+			c.perDay.Valid = true
+		}
+		result = append(result, c)
+	}
+	fatal(rows.Err())
+	return
+}
+
+// printDirCounts prints the -counts report.
+func printDirCounts(dirid int64) {
+	printTitle("MOST FILES PER DIRECTORY")
+	t := newTableWriter()
+	for _, c := range cache.getDirCounts(dirid, listSize, opts) {
+		perDay := "-"
+		if c.perDay.Valid {
+			perDay = fmt.Sprintf("%+.1f/day", c.perDay.Float64)
+		}
+		t.File(c.path, fmt.Sprintf("%d\t%+d\t%s\t%s", c.files, c.change, perDay, c.path), "")
+	}
+	t.Flush()
+	endReport()
+}
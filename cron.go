@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A schedule says when a directory is due to be scanned: either a cron
+// expression (minute hour day-of-month month day-of-week), or "@every"
+// followed by a duration.  @hourly, @daily, @weekly and @monthly are also
+// understood.
+type schedule struct {
+	every time.Duration
+
+	minute, hour, dom, month, dow uint64
+	anyDom, anyDow                bool
+}
+
+var cronNicknames = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+func parseSchedule(s string) (*schedule, error) {
+	s = strings.TrimSpace(s)
+	if rest := strings.TrimPrefix(s, "@every "); rest != s {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid schedule %q", s)
+		}
+		return &schedule{every: d}, nil
+	}
+	if nick, ok := cronNicknames[s]; ok {
+		s = nick
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: want 5 fields", s)
+	}
+	sch := &schedule{
+		anyDom: fields[2] == "*",
+		anyDow: fields[4] == "*",
+	}
+	var err error
+	for i, f := range []struct {
+		bits     *uint64
+		min, max int
+	}{
+		{&sch.minute, 0, 59},
+		{&sch.hour, 0, 23},
+		{&sch.dom, 1, 31},
+		{&sch.month, 1, 12},
+		{&sch.dow, 0, 7},
+	} {
+		if *f.bits, err = parseCronField(fields[i], f.min, f.max); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v", s, err)
+		}
+	}
+	// Sunday is 0 or 7.
+	if sch.dow&(1<<7) != 0 {
+		sch.dow |= 1
+	}
+	return sch, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges (a-b) and
+// steps (*/n or a-b/n) into a bit set.
+func parseCronField(field string, min, max int) (bits uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			r := strings.SplitN(part, "-", 2)
+			if lo, err = strconv.Atoi(r[0]); err != nil {
+				return 0, fmt.Errorf("bad value %q", part)
+			}
+			hi = lo
+			if len(r) == 2 {
+				if hi, err = strconv.Atoi(r[1]); err != nil {
+					return 0, fmt.Errorf("bad value %q", part)
+				}
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return
+}
+
+// next returns the first time the schedule is due after last.
+func (sch *schedule) next(last time.Time) time.Time {
+	if sch.every > 0 {
+		return last.Add(sch.every)
+	}
+
+	t := last.Truncate(time.Minute).Add(time.Minute)
+	// A schedule that never matches, like February 30th, gives up after
+	// a few years.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case sch.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !sch.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case sch.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case sch.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return limit
+}
+
+// dayMatches applies cron's rule that when both the day of the month and
+// the day of the week are given, either will do.
+func (sch *schedule) dayMatches(t time.Time) bool {
+	dom := sch.dom&(1<<uint(t.Day())) != 0
+	dow := sch.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case sch.anyDom && sch.anyDow:
+		return true
+	case sch.anyDom:
+		return dow
+	case sch.anyDow:
+		return dom
+	}
+	return dom || dow
+}
+
+// A blackout is a time of day, on some days of the week, when the daemon
+// mustn't scan, written like "Mon-Fri 09:00-18:00".  The days may be left
+// out to mean every day, and the times may wrap past midnight.
+type blackout struct {
+	days     uint64
+	from, to int // minutes into the day
+}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func parseBlackout(s string) (*blackout, error) {
+	fields := strings.Fields(s)
+	b := &blackout{days: 1<<7 - 1}
+	switch len(fields) {
+	case 1:
+	case 2:
+		days, err := parseDays(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid blackout %q: %v", s, err)
+		}
+		b.days = days
+		fields = fields[1:]
+	default:
+		return nil, fmt.Errorf("invalid blackout %q", s)
+	}
+
+	times := strings.SplitN(fields[0], "-", 2)
+	if len(times) != 2 {
+		return nil, fmt.Errorf("invalid blackout %q: want HH:MM-HH:MM", s)
+	}
+	for i, p := range []*int{&b.from, &b.to} {
+		t, err := time.Parse("15:04", times[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid blackout %q: %v", s, err)
+		}
+		*p = t.Hour()*60 + t.Minute()
+	}
+	return b, nil
+}
+
+// parseDays parses days of the week like "Mon-Fri" or "Sat,Sun".
+func parseDays(s string) (days uint64, err error) {
+	day := func(name string) (int, error) {
+		for i, d := range weekdays {
+			if strings.EqualFold(name, d) {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("bad day %q", name)
+	}
+	for _, part := range strings.Split(s, ",") {
+		r := strings.SplitN(part, "-", 2)
+		lo, err := day(r[0])
+		if err != nil {
+			return 0, err
+		}
+		hi := lo
+		if len(r) == 2 {
+			if hi, err = day(r[1]); err != nil {
+				return 0, err
+			}
+		}
+		for d := lo; ; d = (d + 1) % 7 {
+			days |= 1 << uint(d)
+			if d == hi {
+				break
+			}
+		}
+	}
+	return
+}
+
+// end returns when the blackout that t falls in is over, if it's in one.
+// A window wrapping past midnight belongs to the day it starts on.
+func (b *blackout) end(t time.Time) (time.Time, bool) {
+	min := t.Hour()*60 + t.Minute()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	today := b.days&(1<<uint(t.Weekday())) != 0
+	yesterday := b.days&(1<<uint((t.Weekday()+6)%7)) != 0
+
+	switch {
+	case b.from < b.to:
+		if today && min >= b.from && min < b.to {
+			return midnight.Add(time.Duration(b.to) * time.Minute), true
+		}
+	case b.from > b.to:
+		if today && min >= b.from {
+			return midnight.AddDate(0, 0, 1).Add(time.Duration(b.to) * time.Minute), true
+		}
+		if yesterday && min < b.to {
+			return midnight.Add(time.Duration(b.to) * time.Minute), true
+		}
+	}
+	return t, false
+}
+
+// avoidBlackouts moves t to the end of any blackouts it falls in.
+func avoidBlackouts(t time.Time, blackouts []*blackout) time.Time {
+	for moved := true; moved; {
+		moved = false
+		for _, b := range blackouts {
+			if end, in := b.end(t); in {
+				t, moved = end, true
+			}
+		}
+	}
+	return t
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		bits     uint64
+		ok       bool
+	}{
+		{"*", 0, 5, 0x3f, true},
+		{"3", 0, 59, 1 << 3, true},
+		{"1,3,5", 0, 7, 1<<1 | 1<<3 | 1<<5, true},
+		{"2-4", 0, 7, 1<<2 | 1<<3 | 1<<4, true},
+		{"*/15", 0, 59, 1<<0 | 1<<15 | 1<<30 | 1<<45, true},
+		{"10-20/5", 0, 59, 1<<10 | 1<<15 | 1<<20, true},
+		{"1-12", 1, 12, 0x1ffe, true},
+		{"60", 0, 59, 0, false},
+		{"0", 1, 31, 0, false},
+		{"5-3", 0, 59, 0, false},
+		{"*/0", 0, 59, 0, false},
+		{"*/x", 0, 59, 0, false},
+		{"a", 0, 59, 0, false},
+		{"1-b", 0, 59, 0, false},
+		{"", 0, 59, 0, false},
+	}
+	for _, tt := range tests {
+		bits, err := parseCronField(tt.field, tt.min, tt.max)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseCronField(%q, %d, %d) error = %v, want ok %v", tt.field, tt.min, tt.max, err, tt.ok)
+			continue
+		}
+		if tt.ok && bits != tt.bits {
+			t.Errorf("parseCronField(%q, %d, %d) = %#x, want %#x", tt.field, tt.min, tt.max, bits, tt.bits)
+		}
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		s  string
+		ok bool
+	}{
+		{"@every 6h", true},
+		{"@every  90m", true},
+		{"@every 0s", false},
+		{"@every soon", false},
+		{"@hourly", true},
+		{"@daily", true},
+		{"@weekly", true},
+		{"@monthly", true},
+		{"@yearly", false},
+		{"0 3 * * *", true},
+		{"*/30 9-17 * * 1-5", true},
+		{"0 0 1,15 * 7", true},
+		{"0 3 * *", false},
+		{"0 3 * * * *", false},
+		{"60 3 * * *", false},
+		{"0 24 * * *", false},
+		{"0 0 0 * *", false},
+		{"0 0 * 13 *", false},
+		{"0 0 * * 8", false},
+	}
+	for _, tt := range tests {
+		_, err := parseSchedule(tt.s)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseSchedule(%q) error = %v, want ok %v", tt.s, err, tt.ok)
+		}
+	}
+
+	// Sunday is 0 or 7.
+	sch, err := parseSchedule("0 0 * * 7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sch.dow&1 == 0 {
+		t.Errorf("parseSchedule(\"0 0 * * 7\") doesn't include day 0")
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	tests := []struct {
+		sched, last, next string
+	}{
+		{"@every 6h", "2024-03-01 10:17", "2024-03-01 16:17"},
+		{"@hourly", "2024-03-01 10:17", "2024-03-01 11:00"},
+		{"@daily", "2024-03-01 10:17", "2024-03-02 00:00"},
+		{"@daily", "2024-03-01 00:00", "2024-03-02 00:00"},
+		{"@monthly", "2024-12-15 00:00", "2025-01-01 00:00"},
+		{"30 2 * * *", "2024-03-01 02:29", "2024-03-01 02:30"},
+		{"30 2 * * *", "2024-03-01 02:30", "2024-03-02 02:30"},
+		{"*/20 * * * *", "2024-03-01 10:41", "2024-03-01 11:00"},
+		// 2024-03-01 is a Friday.
+		{"0 9 * * 1-5", "2024-03-01 09:00", "2024-03-04 09:00"},
+		{"@weekly", "2024-03-01 10:00", "2024-03-03 00:00"},
+		// With both days given, either will do.
+		{"0 0 15 * 1", "2024-03-01 10:00", "2024-03-04 00:00"},
+		{"0 0 15 * 1", "2024-03-12 10:00", "2024-03-15 00:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		// Never matches, so gives up after five years.
+		{"0 0 30 2 *", "2024-03-01 00:00", "2029-03-01 00:01"},
+	}
+	for _, tt := range tests {
+		sch, err := parseSchedule(tt.sched)
+		if err != nil {
+			t.Errorf("parseSchedule(%q): %v", tt.sched, err)
+			continue
+		}
+		if got := sch.next(at(tt.last)); !got.Equal(at(tt.next)) {
+			t.Errorf("%q.next(%s) = %s, want %s", tt.sched, tt.last, got.Format("2006-01-02 15:04"), tt.next)
+		}
+	}
+}
+
+func TestParseDays(t *testing.T) {
+	tests := []struct {
+		s    string
+		days uint64
+		ok   bool
+	}{
+		{"Sun", 1 << 0, true},
+		{"mon", 1 << 1, true},
+		{"Mon-Fri", 0x3e, true},
+		{"Sat,Sun", 1<<6 | 1<<0, true},
+		{"Fri-Mon", 1<<5 | 1<<6 | 1<<0 | 1<<1, true},
+		{"Tue,Thu-Fri", 1<<2 | 1<<4 | 1<<5, true},
+		{"Funday", 0, false},
+		{"Mon-", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		days, err := parseDays(tt.s)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseDays(%q) error = %v, want ok %v", tt.s, err, tt.ok)
+			continue
+		}
+		if tt.ok && days != tt.days {
+			t.Errorf("parseDays(%q) = %#b, want %#b", tt.s, days, tt.days)
+		}
+	}
+}
+
+func TestParseBlackout(t *testing.T) {
+	tests := []struct {
+		s        string
+		days     uint64
+		from, to int
+		ok       bool
+	}{
+		{"09:00-18:00", 0x7f, 9 * 60, 18 * 60, true},
+		{"Mon-Fri 09:00-18:00", 0x3e, 9 * 60, 18 * 60, true},
+		{"Sat 22:30-06:15", 1 << 6, 22*60 + 30, 6*60 + 15, true},
+		{"Mon-Fri", 0, 0, 0, false},
+		{"09:00", 0, 0, 0, false},
+		{"Mon 9-17", 0, 0, 0, false},
+		{"Mon 25:00-26:00", 0, 0, 0, false},
+		{"Someday 09:00-18:00", 0, 0, 0, false},
+		{"Mon Tue 09:00-18:00", 0, 0, 0, false},
+		{"", 0, 0, 0, false},
+	}
+	for _, tt := range tests {
+		b, err := parseBlackout(tt.s)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseBlackout(%q) error = %v, want ok %v", tt.s, err, tt.ok)
+			continue
+		}
+		if tt.ok && (b.days != tt.days || b.from != tt.from || b.to != tt.to) {
+			t.Errorf("parseBlackout(%q) = %#b %d-%d, want %#b %d-%d", tt.s, b.days, b.from, b.to, tt.days, tt.from, tt.to)
+		}
+	}
+}
+
+func TestBlackoutEnd(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	// 2024-03-01 is a Friday.
+	tests := []struct {
+		blackout, t string
+		end         string // "" if t isn't in the blackout
+	}{
+		{"09:00-18:00", "2024-03-01 08:59", ""},
+		{"09:00-18:00", "2024-03-01 09:00", "2024-03-01 18:00"},
+		{"09:00-18:00", "2024-03-01 17:59", "2024-03-01 18:00"},
+		{"09:00-18:00", "2024-03-01 18:00", ""},
+		{"Mon-Fri 09:00-18:00", "2024-03-02 12:00", ""},
+		{"Mon-Fri 09:00-18:00", "2024-03-04 12:00", "2024-03-04 18:00"},
+
+		// Across midnight, the window belongs to the day it starts on.
+		{"22:00-06:00", "2024-03-01 21:59", ""},
+		{"22:00-06:00", "2024-03-01 22:00", "2024-03-02 06:00"},
+		{"22:00-06:00", "2024-03-01 23:59", "2024-03-02 06:00"},
+		{"22:00-06:00", "2024-03-02 00:00", "2024-03-02 06:00"},
+		{"22:00-06:00", "2024-03-02 05:59", "2024-03-02 06:00"},
+		{"22:00-06:00", "2024-03-02 06:00", ""},
+		{"Fri 22:00-06:00", "2024-03-01 23:00", "2024-03-02 06:00"},
+		{"Fri 22:00-06:00", "2024-03-02 03:00", "2024-03-02 06:00"},
+		{"Fri 22:00-06:00", "2024-03-02 23:00", ""},
+		{"Fri 22:00-06:00", "2024-03-01 03:00", ""},
+		{"Sat 22:00-06:00", "2024-03-02 03:00", ""},
+		// The end of a month.
+		{"Thu 23:00-01:00", "2024-02-29 23:30", "2024-03-01 01:00"},
+	}
+	for _, tt := range tests {
+		b, err := parseBlackout(tt.blackout)
+		if err != nil {
+			t.Errorf("parseBlackout(%q): %v", tt.blackout, err)
+			continue
+		}
+		end, in := b.end(at(tt.t))
+		switch {
+		case tt.end == "" && in:
+			t.Errorf("%q.end(%s) = %s, want not in it", tt.blackout, tt.t, end.Format("2006-01-02 15:04"))
+		case tt.end != "" && !in:
+			t.Errorf("%q.end(%s) not in it, want %s", tt.blackout, tt.t, tt.end)
+		case tt.end != "" && !end.Equal(at(tt.end)):
+			t.Errorf("%q.end(%s) = %s, want %s", tt.blackout, tt.t, end.Format("2006-01-02 15:04"), tt.end)
+		}
+	}
+}
+
+func TestAvoidBlackouts(t *testing.T) {
+	var blackouts []*blackout
+	for _, s := range []string{"22:00-02:00", "01:30-04:00"} {
+		b, err := parseBlackout(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blackouts = append(blackouts, b)
+	}
+	start := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+	want := time.Date(2024, 3, 2, 4, 0, 0, 0, time.UTC)
+	if got := avoidBlackouts(start, blackouts); !got.Equal(want) {
+		t.Errorf("avoidBlackouts(%s) = %s, want %s", start, got, want)
+	}
+}
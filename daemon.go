@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// defaultSchedule is used by the daemon when the configuration file
+// doesn't give one.
+const defaultSchedule = "@daily"
+
+func init() {
+	addCommand(&command{
+		name:     "daemon",
+		synopsis: "[-listen addr]",
+		help:     "Keep running, rescanning registered directories on the schedules in the configuration file.",
+		run:      runDaemon,
+	})
+	addCommand(&command{
+		name:     "status",
+		synopsis: "",
+		help:     "Show each registered directory's size, last scan, usual scan time and churn, for planning scans.",
+		run:      runStatus,
+		readOnly: true,
+	})
+}
+
+func runStatus(args []string) {
+	fs := commandFlags("status")
+	parseFlags(fs, args)
+	needArgs(fs, 0)
+
+	w := newRowWriter(stdout)
+	w.Header([]string{"dir", "host", "files", "bytes", "last_scan", "scan_seconds", "churn"})
+	for _, d := range cache.dirSummaries() {
+		last := ""
+		if d.LastScan > 0 {
+			last = time.Unix(d.LastScan, 0).Format(time.RFC3339)
+		}
+		w.Row([]interface{}{d.Dir, d.Host, d.Files, d.Bytes, last,
+			math.Round(d.ScanSeconds*1000) / 1000, math.Round(d.Churn*1000) / 1000})
+	}
+	w.Flush()
+}
+
+// dirSummary is the state of a registered directory, as served by the
+// daemon.
+type dirSummary struct {
+	DirID    int64  `json:"-"`
+	Dir      string `json:"dir"`
+	Host     string `json:"host,omitempty"`
+	Agent    bool   `json:"agent,omitempty"`
+	Files    int64  `json:"files"`
+	Bytes    int64  `json:"bytes"`
+	LastScan int64  `json:"last_scan"`
+
+	// ScanSeconds is how long a scan can be expected to take, and Churn
+	// the fraction of files that were new or changed at each scan, both
+	// averaged over the last few scans.  They let schedulers decide what
+	// to scan when.
+	ScanSeconds float64 `json:"scan_seconds"`
+	Churn       float64 `json:"churn"`
+}
+
+// local tells whether the directory is scanned on this host, rather than
+// by an agent or another host sharing the database.
+func (d *dirSummary) local() bool {
+	return !d.Agent && (d.Host == "" || d.Host == localHost)
+}
+
+// recentScans is how many scans ScanSeconds and Churn are averaged over.
+const recentScans = 5
+
+func runDaemon(args []string) {
+	fs := commandFlags("daemon")
+	listen := fs.String("listen", "", "Serve /metrics, /dirs and /status on this address, such as :9132.")
+	oneshot := fs.Bool("oneshot", false, "Scan every local directory once and exit, as when started by a systemd timer.")
+	parseFlags(fs, args)
+	needArgs(fs, 0)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+
+	if *oneshot {
+		sdNotify("READY=1")
+		for _, d := range cache.dirSummaries() {
+			if !d.local() {
+				continue
+			}
+			select {
+			case <-stop:
+				log.Print("stopping")
+				return
+			default:
+			}
+			sdNotify("STATUS=Scanning " + d.Dir)
+			scanAndAlert(d.DirID)
+		}
+		return
+	}
+
+	fatal(checkSchedules())
+
+	if *listen != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", serveMetrics)
+		mux.HandleFunc("/dirs", serveDirs)
+		mux.HandleFunc("/status", serveStatus)
+		l, err := net.Listen("tcp", *listen)
+		fatal(err)
+		defer l.Close()
+		go func() {
+			log.Print(http.Serve(l, mux))
+		}()
+	}
+	sdNotify("READY=1")
+	var watchdog <-chan time.Time
+	if interval := watchdogInterval(); interval > 0 {
+		go sdWatchdog(interval)
+		watchdog = time.Tick(interval)
+	}
+
+	// Scans run to the end once started, so the database is left
+	// consistent; a signal during one stops the daemon after it.  Watched
+	// files are sampled between them.
+	scanned := make(map[string]time.Time)
+	for {
+		nextWatch := cache.sampleWatched()
+		dir, dirid, when := cache.nextScan(scanned)
+		wait := time.Until(when)
+		if dirid == 0 {
+			log.Print("no directories to scan; waiting")
+			wait = time.Hour
+		}
+		if !nextWatch.IsZero() && time.Until(nextWatch) < wait {
+			wait = time.Until(nextWatch)
+		}
+		if wait > 0 {
+			sdNotify("STATUS=Idle")
+			timer := time.After(wait)
+		idle:
+			for {
+				select {
+				case <-stop:
+					sdNotify("STOPPING=1")
+					log.Print("stopping")
+					return
+				case <-watchdog:
+					sdNotify("WATCHDOG=1")
+				case <-timer:
+					break idle
+				}
+			}
+			continue
+		}
+
+		log.Printf("scanning %s", dir)
+		sdNotify("STATUS=Scanning " + dir)
+		scanned[dir] = time.Now()
+		scanAndAlert(dirid)
+	}
+}
+
+// scanAndAlert scans dirid and checks its alerts, logging what goes
+// wrong, so that one directory's trouble doesn't stop the daemon.
+func scanAndAlert(dirid int64) {
+	if err := cache.scanDir(dirid); err != nil {
+		log.Print(err)
+		return
+	}
+	if err := cache.checkAlerts(dirid); err != nil {
+		log.Print(err)
+	}
+}
+
+// checkSchedules makes sure every schedule and blackout in the
+// configuration file can be understood, before the daemon relies on them.
+func checkSchedules() error {
+	cfg := getConfig()
+	if cfg.Schedule != "" {
+		if _, err := parseSchedule(cfg.Schedule); err != nil {
+			return fmt.Errorf("%s: schedule: %w", configPath, err)
+		}
+	}
+	for dir, s := range cfg.Schedules {
+		if _, err := parseSchedule(s); err != nil {
+			return fmt.Errorf("%s: %s: %w", configPath, dir, err)
+		}
+	}
+	for dir, list := range cfg.Blackouts {
+		for _, s := range list {
+			if _, err := parseBlackout(s); err != nil {
+				return fmt.Errorf("%s: %s: %w", configPath, dir, err)
+			}
+		}
+	}
+	return nil
+}
+
+// dirSchedule returns the schedule for a directory from the configuration
+// file.  One that can't be understood is logged, and the default used
+// instead, though checkSchedules should have caught it.
+func dirSchedule(dir string) *schedule {
+	cfg := getConfig()
+	s, ok := cfg.Schedules[dir]
+	if !ok {
+		s = cfg.Schedule
+	}
+	if s == "" {
+		s = defaultSchedule
+	}
+	sch, err := parseSchedule(s)
+	if err != nil {
+		log.Printf("%s: %s: %v", configPath, dir, err)
+		sch, err = parseSchedule(defaultSchedule)
+		fatal(err)
+	}
+	return sch
+}
+
+// dirBlackouts returns the blackouts for a directory from the
+// configuration file, including those for every directory.  Those that
+// can't be understood are logged and left out.
+func dirBlackouts(dir string) (blackouts []*blackout) {
+	cfg := getConfig()
+	for _, s := range append(cfg.Blackouts["*"], cfg.Blackouts[dir]...) {
+		b, err := parseBlackout(s)
+		if err != nil {
+			log.Printf("%s: %s: %v", configPath, dir, err)
+			continue
+		}
+		blackouts = append(blackouts, b)
+	}
+	return
+}
+
+// nextScan finds the local directory due to be scanned soonest, and when,
+// going by the latest samples and the times directories were scanned.
+// Directories from agents and other hosts are left to them.
+func (fdb *fileDB) nextScan(scanned map[string]time.Time) (dir string, dirid int64, when time.Time) {
+	for _, d := range fdb.dirSummaries() {
+		if !d.local() {
+			continue
+		}
+		last := scanned[d.Dir]
+		if t := time.Unix(d.LastScan, 0); d.LastScan > 0 && t.After(last) {
+			last = t
+		}
+		next := time.Now()
+		if !last.IsZero() {
+			next = dirSchedule(d.Dir).next(last)
+		}
+		next = avoidBlackouts(next, dirBlackouts(d.Dir))
+		if dirid == 0 || next.Before(when) {
+			dir, when = d.Dir, next
+			dirid = d.DirID
+		}
+	}
+	return
+}
+
+// dirSummaries totals the latest samples of the files in each registered
+// directory.
+func (fdb *fileDB) dirSummaries() (result []dirSummary) {
+	rows, err := fdb.ro.Query(
+		`select dir.dirid, dirpath, coalesce(host, ''), agent, count(sample.fileid), coalesce(sum(size), 0), coalesce(max(sampletime), 0),
+			coalesce((select avg(duration) from (select duration from scan
+				where scan.dirid = dir.dirid order by started desc limit ?)), 0),
+			coalesce((select avg(cast(changed AS real) / files) from (select changed, files from scan
+				where scan.dirid = dir.dirid and files > 0 order by started desc limit ?)), 0)
+		from dir left join file on file.dirid = dir.dirid
+			left join sample on file.fileid = sample.fileid and
+			sample.sampletime = (
+				select max(sampletime) from sample where file.fileid=sample.fileid and invalid is null
+				)
+		where `+forHost+`
+		group by dir.dirid
+		order by dirpath, host`, append([]interface{}{recentScans, recentScans}, forHostArgs()...)...)
+	fatal(err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var d dirSummary
+		fatal(rows.Scan(&d.DirID, &d.Dir, &d.Host, &d.Agent, &d.Files, &d.Bytes, &d.LastScan, &d.ScanSeconds, &d.Churn))
+		result = append(result, d)
+	}
+	fatal(rows.Err())
+	return
+}
+
+// serveMetrics serves the directory summaries in Prometheus' text format.
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	dirs := cache.dirSummaries()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range []struct {
+		name, help string
+		value      func(d *dirSummary) float64
+	}{
+		{"filebase_dir_bytes", "Total size of the files in a directory.", func(d *dirSummary) float64 { return float64(d.Bytes) }},
+		{"filebase_dir_files", "Number of files in a directory.", func(d *dirSummary) float64 { return float64(d.Files) }},
+		{"filebase_dir_last_scan_seconds", "When a directory was last scanned.", func(d *dirSummary) float64 { return float64(d.LastScan) }},
+		{"filebase_dir_scan_duration_seconds", "How long scanning a directory usually takes.", func(d *dirSummary) float64 { return d.ScanSeconds }},
+		{"filebase_dir_churn_ratio", "Fraction of files usually new or changed at each scan.", func(d *dirSummary) float64 { return d.Churn }},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for i := range dirs {
+			fmt.Fprintf(w, "%s{dir=%q,host=%q} %g\n", m.name, dirs[i].Dir, dirs[i].Host, m.value(&dirs[i]))
+		}
+	}
+}
+
+// serveDirs serves the directory summaries as JSON.
+func serveDirs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cache.dirSummaries())
+}
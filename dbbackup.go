@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// With backups set in the configuration file, a copy of the database is
+// made before anything that throws history away: migrating it to a new
+// schema, removing directories, forgetting files and repairing it.  If it
+// turns out to have been a mistake, the copy can be put back in place of
+// the database.
+
+type backupConfig struct {
+	// Dir is where the copies go, by default beside the database.
+	Dir string `json:"dir"`
+	// Keep is how many copies to keep, the oldest being removed first.
+	// (default 5)
+	Keep int `json:"keep"`
+}
+
+const defaultBackupKeep = 5
+
+// backup copies the database before an operation named by reason, if
+// backups are configured.  The copies are named for the database, when
+// they were made and why, so that they sort oldest first.
+func (fdb *fileDB) backup(reason string) {
+	cfg := getConfig().Backups
+	if cfg == nil || fdb.path == "" {
+		return
+	}
+	dir := cfg.Dir
+	if dir == "" {
+		dir = filepath.Dir(fdb.path)
+	}
+	fatal(os.MkdirAll(dir, 0700))
+
+	base := filepath.Base(fdb.path)
+	name := filepath.Join(dir, fmt.Sprintf("%s.%s.%s.bak", base, time.Now().Format("20060102-150405"), reason))
+	if _, err := os.Stat(name); err == nil {
+		// Already copied for the same reason this second.
+		return
+	}
+	_, err := fdb.db.Exec("VACUUM INTO ?", name)
+	fatal(err)
+	log.Printf("Backed up the database to %s", name)
+
+	keep := cfg.Keep
+	if keep <= 0 {
+		keep = defaultBackupKeep
+	}
+	old, err := filepath.Glob(filepath.Join(dir, base+".*.bak"))
+	fatal(err)
+	sort.Strings(old)
+	for len(old) > keep {
+		if err := os.Remove(old[0]); err != nil {
+			log.Print(err)
+		}
+		old = old[1:]
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Long lived databases pick up cruft: rows left behind by crashes, or by
+// connections that didn't enforce foreign keys, and locks held by
+// processes that are gone.  checkDB finds it, and with -repair cleans it
+// up.  Damage found by SQLite's own integrity check can't be repaired
+// here.
+
+// scanTables hold rows belonging to a scan, which mean nothing once the
+// scan is gone.
+var scanTables = []string{"walkerror", "emptydir", "dircount", "fscapacity", "vanished"}
+
+// checkDB checks the database and reports what it finds, returning
+// whether all is well, or has been put right.
+func (fdb *fileDB) checkDB(repair bool) (ok bool) {
+	if repair {
+		fdb.backup("repair")
+	}
+	ok = true
+	t := newTableWriter()
+	report := func(what string, n int64) {
+		switch {
+		case n == 0:
+			t.Line(what+"\tok", "")
+		case repair:
+			t.Line(fmt.Sprintf("%s\t%d\trepaired", what, n), "")
+		default:
+			t.Line(fmt.Sprintf("%s\t%d\tuse -repair to remove", what, n), colorRed)
+			ok = false
+		}
+	}
+
+	rows, err := fdb.db.Query("PRAGMA integrity_check")
+	fatal(err)
+	for rows.Next() {
+		var msg string
+		fatal(rows.Scan(&msg))
+		if msg == "ok" {
+			t.Line("integrity\tok", "")
+		} else {
+			t.Line("integrity\t"+msg, colorRed)
+			ok = false
+		}
+	}
+	fatal(rows.Err())
+	rows.Close()
+
+	report("rows with missing parents", fdb.fixForeignKeys(repair))
+
+	report("files without samples", fdb.fixRows(repair,
+		"file WHERE NOT EXISTS (SELECT 1 FROM sample WHERE sample.fileid = file.fileid)"))
+	for _, table := range scanTables {
+		report(table+" rows from missing scans", fdb.fixRows(repair,
+			table+" WHERE scanid NOT IN (SELECT rowid FROM scan)"))
+	}
+	report("scan locks held by dead processes", fdb.fixLocks(repair))
+
+	t.Flush()
+	if repair {
+		fdb.changed()
+	}
+	return
+}
+
+// fixRows counts the rows matched by from, a table and WHERE clause, and
+// deletes them if repair is set.
+func (fdb *fileDB) fixRows(repair bool, from string) (n int64) {
+	if !repair {
+		fatal(fdb.db.QueryRow("SELECT count(*) FROM " + from).Scan(&n))
+		return
+	}
+	res, err := fdb.db.Exec("DELETE FROM " + from)
+	fatal(err)
+	n, err = res.RowsAffected()
+	fatal(err)
+	return
+}
+
+// fixForeignKeys counts the rows whose parent rows are gone, and deletes
+// them if repair is set.  Deleting some can orphan others, so it goes
+// round until there are none.
+func (fdb *fileDB) fixForeignKeys(repair bool) (n int64) {
+	for {
+		type orphan struct {
+			table string
+			rowid int64
+		}
+		var orphans []orphan
+		rows, err := fdb.db.Query("SELECT \"table\", rowid FROM pragma_foreign_key_check")
+		fatal(err)
+		for rows.Next() {
+			var o orphan
+			fatal(rows.Scan(&o.table, &o.rowid))
+			orphans = append(orphans, o)
+		}
+		fatal(rows.Err())
+		rows.Close()
+
+		n += int64(len(orphans))
+		if !repair || len(orphans) == 0 {
+			return
+		}
+
+		tx, err := fdb.db.Begin()
+		fatal(err)
+		for _, o := range orphans {
+			_, err = tx.Exec(fmt.Sprintf("DELETE FROM %q WHERE rowid = ?", o.table), o.rowid)
+			fatal(err)
+		}
+		fatal(tx.Commit())
+	}
+}
+
+// fixLocks counts the scan locks held by processes on this host that have
+// died, and releases them if repair is set.  Locks from other hosts can't
+// be checked from here.
+func (fdb *fileDB) fixLocks(repair bool) (n int64) {
+	rows, err := fdb.db.Query("SELECT dirid, pid FROM scanlock WHERE host = ?", localHost)
+	fatal(err)
+	var dead [][2]int64
+	for rows.Next() {
+		var dirid, pid int64
+		fatal(rows.Scan(&dirid, &pid))
+		if !processAlive(int(pid)) {
+			dead = append(dead, [2]int64{dirid, pid})
+		}
+	}
+	fatal(rows.Err())
+	rows.Close()
+
+	if repair {
+		for _, d := range dead {
+			_, err = fdb.db.Exec("DELETE FROM scanlock WHERE dirid = ? AND host = ? AND pid = ?", d[0], localHost, d[1])
+			fatal(err)
+		}
+	}
+	return int64(len(dead))
+}
+
+func runCheckDB(repair bool) {
+	var err error
+	cache, err = newFileDB(dbPath)
+	fatal(err)
+	defer cache.close()
+	if !cache.checkDB(repair) {
+		fatal(exitStatus(1))
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Every scan adds samples, so left alone the database grows without end,
+// and on a small disk it can become the very thing filling it.  The size
+// of the database is recorded after every scan, and "database" in the
+// configuration file sets how big, or how fast growing, is too much.  A
+// database over either is warned about after scans, with what would slow
+// it down.
+
+// dbLimits are the size and growth rate past which the database is warned
+// about.  Either may be left out.
+type dbLimits struct {
+	Size byteSize `json:"size"`
+	Rate byteRate `json:"rate"`
+}
+
+// dbGrowthWindow is how far back the database's growth rate is measured.
+const dbGrowthWindow = 7 * 24 * time.Hour
+
+// dbSuggestions is how many of the directories with the most samples are
+// suggested for scanning less often.
+const dbSuggestions = 3
+
+// dbSizes adds the size of the database after each scan.
+func dbSizes(tx *sql.Tx) {
+	addColumn(tx, "scan", "dbsize", "integer")
+}
+
+// dbSize returns the size of the database in use, and how much of it is
+// free pages left by deleted rows.
+func (fdb *fileDB) dbSize() (size, free int64) {
+	var pages, freePages, pageSize int64
+	err := fdb.db.QueryRow(
+		`SELECT page_count, freelist_count, page_size
+		FROM pragma_page_count, pragma_freelist_count, pragma_page_size`).Scan(&pages, &freePages, &pageSize)
+	fatal(err)
+	return pages * pageSize, freePages * pageSize
+}
+
+func (fdb *fileDB) recordDBSize(scanid int64) {
+	size, _ := fdb.dbSize()
+	_, err := fdb.db.Exec("UPDATE scan SET dbsize = ? WHERE rowid = ?", size, scanid)
+	fatal(err)
+}
+
+// dbGrowth returns how fast the database has grown over the scans in the
+// last dbGrowthWindow, in bytes per day, or false if too few recorded its
+// size to tell.
+func (fdb *fileDB) dbGrowth() (float64, bool) {
+	var first, last sql.NullInt64
+	var span sql.NullFloat64
+	err := fdb.db.QueryRow(
+		`SELECT
+			(SELECT dbsize FROM scan WHERE dbsize IS NOT NULL AND finished >= ?1 ORDER BY finished LIMIT 1),
+			(SELECT dbsize FROM scan WHERE dbsize IS NOT NULL AND finished >= ?1 ORDER BY finished DESC LIMIT 1),
+			(SELECT max(finished) - min(finished) FROM scan WHERE dbsize IS NOT NULL AND finished >= ?1)`,
+		time.Now().Add(-dbGrowthWindow).Unix()).Scan(&first, &last, &span)
+	fatal(err)
+	if !span.Valid || span.Float64 <= 0 {
+		return 0, false
+	}
+	return float64(last.Int64-first.Int64) / span.Float64 * secondsPerDay, true
+}
+
+// checkDBSize warns if the database is over the limits in the
+// configuration file, and suggests what would shrink it or slow it down.
+func (fdb *fileDB) checkDBSize() {
+	limits := getConfig().Database
+	if limits == nil {
+		return
+	}
+	size, free := fdb.dbSize()
+	var over bool
+	if limits.Size > 0 && size > int64(limits.Size) {
+		fmt.Fprintf(stdout, "DATABASE %s holds %sB, over %sB\n", dbPath, niceSize(size), niceSize(int64(limits.Size)))
+		over = true
+	}
+	if rate, ok := fdb.dbGrowth(); ok && limits.Rate > 0 && rate > float64(limits.Rate) {
+		fmt.Fprintf(stdout, "DATABASE %s is growing %sB/day, over %sB/day\n", dbPath, niceSizef(rate), niceSizef(float64(limits.Rate)))
+		over = true
+	}
+	if !over {
+		return
+	}
+
+	if free*10 > size {
+		fmt.Fprintf(stdout, "\t%sB of it is free space left by deleted rows, which VACUUM in sqlite3 would give back.\n", niceSize(free))
+	}
+	for _, s := range fdb.dbHeaviest(dbSuggestions) {
+		fmt.Fprintf(stdout, "\t%s has %d samples, from scans every %v; \"filebase interval %s %s\" would scan it at most half as often.\n",
+			s.path, s.samples, s.every.Round(time.Second), s.path, shortAge(2*s.every))
+	}
+	fmt.Fprintln(stdout, "\t\"filebase forget\" throws away the history of directories no longer of interest.")
+}
+
+type dbHeavy struct {
+	path    string
+	samples int64
+	every   time.Duration
+}
+
+// dbHeaviest returns the n directories with the most samples, of those
+// scanned more than once in the last dbGrowthWindow, with how often they
+// were scanned.
+func (fdb *fileDB) dbHeaviest(n int) (result []dbHeavy) {
+	rows, err := fdb.db.Query(
+		`SELECT file.dirid, count(*) AS samples,
+			(SELECT (max(started) - min(started)) / (count(*) - 1.0)
+				FROM scan WHERE scan.dirid = file.dirid AND started >= ?)
+		FROM file, sample
+		WHERE sample.fileid = file.fileid
+		GROUP BY file.dirid
+		ORDER BY samples DESC`,
+		time.Now().Add(-dbGrowthWindow).Unix())
+	fatal(err)
+	defer rows.Close()
+
+	var dirids []int64
+	for rows.Next() && len(result) < n {
+		var dirid int64
+		var h dbHeavy
+		var every sql.NullFloat64
+		fatal(rows.Scan(&dirid, &h.samples, &every))
+		if !every.Valid || every.Float64 <= 0 {
+			continue
+		}
+		h.every = time.Duration(every.Float64) * time.Second
+		dirids = append(dirids, dirid)
+		result = append(result, h)
+	}
+	fatal(rows.Err())
+	rows.Close()
+
+	for i, dirid := range dirids {
+		result[i].path = fdb.getDirPath(dirid)
+	}
+	return
+}
+
+// shortAge formats d the way parseAge reads it, in whole hours or days.
+func shortAge(d time.Duration) string {
+	if d < 24*time.Hour {
+		h := int64((d + time.Hour - 1) / time.Hour)
+		return fmt.Sprintf("%dh", h)
+	}
+	return fmt.Sprintf("%dd", int64((d+12*time.Hour)/(24*time.Hour)))
+}
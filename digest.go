@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// With -email-to, the reports chosen by flags aren't printed but mailed,
+// once every directory has been scanned, as one message holding them both
+// as aligned text and as the HTML page -format html writes.  A nightly
+// cron job can then deliver the digest itself.
+
+// mailReports mails the reports on dirids to the comma separated
+// addresses in to.
+func mailReports(to string, dirids []int64) error {
+	var addrs []string
+	for _, a := range strings.Split(to, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			addrs = append(addrs, a)
+		}
+	}
+
+	var roots []string
+	for _, dirid := range dirids {
+		roots = append(roots, cache.getDirPath(dirid))
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, format := range []string{"text", "html"} {
+		typ := "text/plain; charset=utf-8"
+		if format == "html" {
+			typ = "text/html; charset=utf-8"
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {typ},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		fatal(err)
+		qw := quotedprintable.NewWriter(part)
+		renderReports(qw, format, dirids)
+		fatal(qw.Close())
+	}
+	fatal(mw.Close())
+
+	header := fmt.Sprintf("To: %s\r\nFrom: %s\r\nSubject: filebase report for %s, %s\r\nMIME-Version: 1.0\r\nContent-Type: multipart/alternative; boundary=%s\r\n\r\n",
+		strings.Join(addrs, ", "), getConfig().Mail.From, strings.Join(roots, ", "),
+		time.Now().Format("2006-01-02"), mw.Boundary())
+	return sendMail(addrs, append([]byte(header), body.Bytes()...))
+}
+
+// renderReports writes the reports on dirids to w in format, as they
+// would be printed to a terminal, but without color.
+func renderReports(w io.Writer, format string, dirids []int64) {
+	savedOut, savedFormat, savedTerminal, savedColorize := stdout, outputFormat, terminal, colorize
+	defer func() {
+		stdout, outputFormat, terminal, colorize = savedOut, savedFormat, savedTerminal, savedColorize
+	}()
+	stdout, outputFormat, terminal, colorize = w, format, true, false
+
+	if format == "html" {
+		startHTML()
+	}
+	for _, dirid := range dirids {
+		printReports(dirid)
+	}
+	if allDirs {
+		printAllDirs()
+	}
+	if format == "html" {
+		endHTML()
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// totalEnt is a group of files, such as a directory or a content type,
+// together with their combined size, and for a directory its note.
+type totalEnt struct {
+	name  string
+	size  int64
+	files int64
+	note  string
+}
+
+func (t *totalEnt) String() string {
+	s := fmt.Sprintf("%v\t%d\t%v", sizeColumns(t.size), t.files, t.name)
+	if t.note != "" {
+		s += "\t" + t.note
+	}
+	return s
+}
+
+// printTotals prints a report of totals as a text table.  paths tells
+// whether they're named by path, to be listed by -format paths.
+func printTotals(title string, totals []totalEnt, paths bool) {
+	printTitle(title)
+	t := newTableWriter()
+	for i := range totals {
+		if paths {
+			t.File(totals[i].name, totals[i].String(), "")
+		} else {
+			t.Line(totals[i].String(), "")
+		}
+	}
+	t.Flush()
+	endReport()
+}
+
+// getDirTotals rolls the latest sample of every file up into each of its
+// parent directories (up to the scanned root), like du.  Directories below
+// minTotal bytes or minFiles files are left out.
+func (fdb *fileDB) getDirTotals(dirid int64, n int, minTotal, minFiles int64, o reportOptions) []totalEnt {
+	root := fdb.getDirPath(dirid)
+	rows, err := fdb.ro.Query(
+		`select path, size from filepaths as file, sample
+		where file.fileid=sample.fileid and
+			file.dirid = ?`+nameFilter+` and
+			sample.sampletime =	(
+				select max(sampletime) from sample where file.fileid=sample.fileid
+				)`, o.filterArgs(dirid)...)
+	fatal(err)
+	defer rows.Close()
+
+	totals := make(map[string]*totalEnt)
+	for rows.Next() {
+		var path string
+		var size int64
+		fatal(rows.Scan(&path, &size))
+
+		for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+			d := totals[dir]
+			if d == nil {
+				d = &totalEnt{name: dir}
+				totals[dir] = d
+			}
+			d.size += size
+			d.files++
+			if dir == root || dir == filepath.Dir(dir) {
+				break
+			}
+		}
+	}
+	fatal(rows.Err())
+
+	result := make([]totalEnt, 0, len(totals))
+	for _, d := range totals {
+		if d.size >= minTotal && d.files >= minFiles {
+			result = append(result, *d)
+		}
+	}
+	result = sortTotals(result, n, o)
+	for i := range result {
+		result[i].note = noteFor(result[i].name)
+	}
+	return result
+}
+
+// sortTotals orders totals biggest first and keeps at most n of them.
+func sortTotals(result []totalEnt, n int, o reportOptions) []totalEnt {
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].size != result[j].size {
+			return result[i].size > result[j].size
+		}
+		return result[i].name < result[j].name
+	})
+	if o.Offset >= len(result) {
+		return nil
+	}
+	result = result[o.Offset:]
+	if n < 0 {
+		return result
+	}
+	for n > 0 && n < len(result) && o.Ties && result[n].size == result[n-1].size {
+		n++
+	}
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
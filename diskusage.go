@@ -0,0 +1,16 @@
+package main
+
+import "database/sql"
+
+// On filesystems that compress or deduplicate, such as ZFS and APFS, a
+// file can take far less space than its size.  Scanning with -disk-usage
+// records the space each takes, from the blocks the system says it has
+// allocated, and -on-disk has reports rank and total files by that.
+// Samples without it count at their size.  Btrfs reports blocks before
+// compression, so there it shows only what sparseness saves.
+
+// diskUsage adds the space each file took on disk as of each sample, which
+// is NULL unless scanned with -disk-usage.
+func diskUsage(tx *sql.Tx) {
+	addColumn(tx, "sample", "disk", "integer")
+}
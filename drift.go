@@ -0,0 +1,90 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// A directory's baseline, kept by the baseline command, doubles as the
+// state it was approved in.  drift lists everything that has changed
+// since, as a simple integrity monitor.
+
+func init() {
+	addCommand(&command{
+		name:     "drift",
+		synopsis: "[-hash] <dir>",
+		help:     "List the files under dir added, removed or changed in size or mtime since the scan kept as its baseline (see baseline).  Exits with status 1 if there are any.",
+		run:      runDrift,
+		readOnly: true,
+	})
+}
+
+func runDrift(args []string) {
+	fs := commandFlags("drift")
+	byHash := fs.Bool("hash", false, "Also list files whose contents have changed, if they were hashed both times.")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	dirid, path := cache.findDir(fs.Arg(0))
+	files := cache.latestFiles(dirid, path)
+	base, ok := cache.getBaseline(dirid, path)
+	if !ok {
+		fatal(fmt.Errorf("%s has no baseline; approve its last scan with the baseline command", fs.Arg(0)))
+	}
+	printTitle(fmt.Sprintf("CHANGES UNDER %s SINCE ITS BASELINE FROM %s", path, cache.baselineTime(dirid).Format("2006-01-02 15:04")))
+	endReport()
+
+	var added, removed, changed []string
+	reasons := make(map[string]string)
+	for p, f := range files {
+		b, ok := base[p]
+		switch {
+		case !ok:
+			added = append(added, p)
+		case f.size != b.size:
+			reasons[p] = "size"
+		case f.mtime != b.mtime:
+			reasons[p] = "mtime"
+		case *byHash && f.hash != "" && b.hash != "" && f.hash != b.hash:
+			reasons[p] = "contents"
+		}
+	}
+	for p := range base {
+		if _, ok := files[p]; !ok {
+			removed = append(removed, p)
+		}
+	}
+	for p := range reasons {
+		changed = append(changed, p)
+	}
+
+	printCompared("ADDED", path, added, files)
+	printCompared("REMOVED", path, removed, base)
+	printTitle(fmt.Sprintf("CHANGED: %d FILES", len(changed)))
+	sort.Strings(changed)
+	t := newTableWriter()
+	for i, p := range changed {
+		if listSize >= 0 && i >= listSize {
+			break
+		}
+		t.File(filepath.Join(path, p), fmt.Sprintf("%v\t%v\t%s changed\t%s", sizeColumns(base[p].size), sizeColumns(files[p].size), reasons[p], p), "")
+	}
+	t.Flush()
+	endReport()
+
+	if len(added)+len(removed)+len(changed) > 0 {
+		fatal(exitStatus(1))
+	}
+}
+
+// baselineTime returns when the scan kept as dirid's baseline started.
+func (fdb *fileDB) baselineTime(dirid int64) time.Time {
+	var started sql.NullInt64
+	fatal(fdb.ro.QueryRow(
+		`SELECT started FROM scan WHERE rowid = (SELECT scanid FROM baseline WHERE dirid = ? LIMIT 1)`,
+		dirid).Scan(&started))
+	return time.Unix(started.Int64, 0)
+}
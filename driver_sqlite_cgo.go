@@ -0,0 +1,19 @@
+//go:build cgo
+
+package main
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteCode returns the primary SQLite result code of err, if it came
+// from SQLite.
+func sqliteCode(err error) (int, bool) {
+	var e sqlite3.Error
+	if errors.As(err, &e) {
+		return int(e.Code), true
+	}
+	return 0, false
+}
@@ -0,0 +1,8 @@
+//go:build !cgo
+
+package main
+
+// Without cgo there is no SQLite to return errors.
+func sqliteCode(err error) (int, bool) {
+	return 0, false
+}
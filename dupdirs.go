@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "dupdirs",
+		synopsis: "[dir...]",
+		help:     "Find directories under the dirs, or under every recorded directory, holding identical files, by relative path, size and hash (see -hash), with the space their copies waste.",
+		run:      runDupDirs,
+		readOnly: true,
+	})
+}
+
+// dirDigest sums up everything below a directory, so that directories
+// with the same files have the same digest.
+type dirDigest struct {
+	path     string
+	entries  []string
+	digest   string
+	size     int64
+	files    int64
+	unhashed bool
+}
+
+// A dupGroup is a set of identical directories.
+type dupGroup struct {
+	dirs     []string
+	size     int64
+	files    int64
+	unhashed bool
+}
+
+func (g *dupGroup) wasted() int64 {
+	return g.size * int64(len(g.dirs)-1)
+}
+
+func runDupDirs(args []string) {
+	fs := commandFlags("dupdirs")
+	parseFlags(fs, args)
+
+	var roots []dupRoot
+	for _, dir := range fs.Args() {
+		dirid, path := cache.findDir(dir)
+		roots = append(roots, dupRoot{dirid, path})
+	}
+	if len(roots) == 0 {
+		for _, dirid := range cache.allDirIDs() {
+			roots = append(roots, dupRoot{dirid, cache.getDirPath(dirid)})
+		}
+	}
+	groups := cache.getDupDirs(roots)
+
+	var total int64
+	for _, g := range groups {
+		total += g.wasted()
+	}
+	printTitle(fmt.Sprintf("DUPLICATE DIRECTORIES: %sB WASTED", niceSize(total)))
+	t := newTableWriter()
+	for i, g := range groups {
+		if listSize >= 0 && i >= listSize {
+			break
+		}
+		note := ""
+		if g.unhashed {
+			note = "\t(some files not hashed; matched by size)"
+		}
+		t.File(g.dirs[0], fmt.Sprintf("%v\t%d files\t%s%s", sizeColumns(g.wasted()), g.files, g.dirs[0], note), "")
+		for _, d := range g.dirs[1:] {
+			t.File(d, fmt.Sprintf("\t\t%s", d), "")
+		}
+	}
+	t.Flush()
+	endReport()
+}
+
+// A dupRoot is a directory to look for copies below.
+type dupRoot struct {
+	dirid int64
+	path  string
+}
+
+// getDupDirs groups the directories below the roots by their contents,
+// and returns the groups with more than one directory, most wasteful
+// first.  Copies inside copies aren't listed again.
+func (fdb *fileDB) getDupDirs(roots []dupRoot) []*dupGroup {
+	dirs := make(map[string]*dirDigest)
+	isRoot := make(map[string]bool)
+	sort.Slice(roots, func(i, j int) bool { return len(roots[i].path) < len(roots[j].path) })
+	for _, r := range roots {
+		root := strings.TrimSuffix(r.path, "/")
+		if root == "" {
+			root = "/"
+		}
+		// Recorded directories inside others were read with them.
+		if _, ok := dirs[root]; ok {
+			continue
+		}
+		isRoot[root] = true
+		fdb.readDirDigests(r.dirid, r.path, dirs)
+	}
+	getDir := func(p string) *dirDigest { return digestFor(dirs, p) }
+
+	// Work up from the deepest directories, so each one's subdirectories
+	// are summed up before it, and add them to their parents.
+	var paths []string
+	for p := range dirs {
+		paths = append(paths, p)
+	}
+	sort.Slice(paths, func(i, j int) bool { return len(paths[i]) > len(paths[j]) })
+	for _, p := range paths {
+		d := dirs[p]
+		sort.Strings(d.entries)
+		h := sha256.New()
+		for _, e := range d.entries {
+			fmt.Fprintln(h, e)
+		}
+		d.digest = hex.EncodeToString(h.Sum(nil))
+		if isRoot[p] || p == "/" {
+			continue
+		}
+		parent := getDir(filepath.Dir(p))
+		parent.entries = append(parent.entries, fmt.Sprintf("d %s %s", filepath.Base(p), d.digest))
+		parent.unhashed = parent.unhashed || d.unhashed
+		parent.size += d.size
+		parent.files += d.files
+	}
+
+	byDigest := make(map[string]*dupGroup)
+	for _, d := range dirs {
+		if d.files == 0 {
+			continue
+		}
+		g := byDigest[d.digest]
+		if g == nil {
+			g = &dupGroup{size: d.size, files: d.files}
+			byDigest[d.digest] = g
+		}
+		g.dirs = append(g.dirs, d.path)
+		g.unhashed = g.unhashed || d.unhashed
+	}
+
+	var groups []*dupGroup
+	for _, g := range byDigest {
+		if len(g.dirs) < 2 || nestedCopy(g, dirs, byDigest, isRoot) {
+			continue
+		}
+		sort.Strings(g.dirs)
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].wasted() != groups[j].wasted() {
+			return groups[i].wasted() > groups[j].wasted()
+		}
+		return groups[i].dirs[0] < groups[j].dirs[0]
+	})
+	return groups
+}
+
+// readDirDigests adds the files below path to the directories in dirs
+// holding them, adding those directories and the ones between them and
+// path as need be.
+func (fdb *fileDB) readDirDigests(dirid int64, path string, dirs map[string]*dirDigest) {
+	args := append([]interface{}{dirid}, underPathArgs(path)...)
+	rows, err := fdb.ro.Query(
+		`select path, size, hash from filepaths as file, sample
+		where file.fileid=sample.fileid and
+			file.dirid = ? and `+underPath+` and
+			sample.sampletime =	(
+				select max(sampletime) from sample where file.fileid=sample.fileid and invalid is null
+				)`, args...)
+	fatal(err)
+	defer rows.Close()
+
+	root := strings.TrimSuffix(path, "/")
+	getDir := func(p string) *dirDigest { return digestFor(dirs, p) }
+	for rows.Next() {
+		var p string
+		var size int64
+		var hash sql.NullString
+		fatal(rows.Scan(&p, &size, &hash))
+
+		d := getDir(filepath.Dir(p))
+		d.entries = append(d.entries, fmt.Sprintf("f %s %d %s", filepath.Base(p), size, hash.String))
+		d.unhashed = d.unhashed || !hash.Valid
+		d.size += size
+		d.files++
+		for dir := filepath.Dir(p); len(dir) >= len(root); dir = filepath.Dir(dir) {
+			getDir(dir)
+			if dir == "/" {
+				break
+			}
+		}
+	}
+	fatal(rows.Err())
+}
+
+// digestFor returns the dirDigest in dirs for path, adding it if need be.
+func digestFor(dirs map[string]*dirDigest, path string) *dirDigest {
+	d := dirs[path]
+	if d == nil {
+		d = &dirDigest{path: path}
+		dirs[path] = d
+	}
+	return d
+}
+
+// nestedCopy tells whether every directory in a group is inside a
+// directory that's copied too, so the group is already accounted for.
+func nestedCopy(g *dupGroup, dirs map[string]*dirDigest, byDigest map[string]*dupGroup, isRoot map[string]bool) bool {
+	for _, p := range g.dirs {
+		if isRoot[p] {
+			return false
+		}
+		parent := dirs[filepath.Dir(p)]
+		if parent == nil {
+			return false
+		}
+		if pg := byDigest[parent.digest]; pg == nil || len(pg.dirs) < 2 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package main
+
+import "fmt"
+
+// minEmptySamples is how many times a file must have been seen empty, and
+// never otherwise, to be listed as empty.
+const minEmptySamples = 2
+
+// emptyEnt is an empty file or directory, and how many scans found it so.
+type emptyEnt struct {
+	path  string
+	times int64
+}
+
+// getEmptyDirs lists the directories holding nothing but empty
+// directories in the last scan of dirid, with how many scans found them
+// empty.
+func (fdb *fileDB) getEmptyDirs(dirid int64) []emptyEnt {
+	return fdb.queryEmpty(
+		`select path, (select count(distinct scanid) from emptydir as old
+				where old.dirid = e.dirid and old.path = e.path)
+		from emptydir as e
+		where dirid = ? and
+			scanid = (select rowid from scan where dirid = ? and finished is not null order by started desc limit 1)
+		order by path`, dirid, dirid)
+}
+
+// getEmptyFiles lists the files in dirid that have always been empty, over
+// at least minEmptySamples samples.
+func (fdb *fileDB) getEmptyFiles(dirid int64, o reportOptions) []emptyEnt {
+	return fdb.queryEmpty(
+		`select path, count(*) from filepaths as file, sample
+		where file.fileid=sample.fileid and
+			file.dirid = ?`+nameFilter+` and sample.invalid is null
+		group by file.fileid
+		having max(size) = 0 and count(*) >= ?
+		order by path`, o.filterArgs(dirid, minEmptySamples)...)
+}
+
+func (fdb *fileDB) queryEmpty(query string, args ...interface{}) (result []emptyEnt) {
+	rows, err := fdb.ro.Query(query, args...)
+	fatal(err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var e emptyEnt
+		fatal(rows.Scan(&e.path, &e.times))
+		result = append(result, e)
+	}
+	fatal(rows.Err())
+	return
+}
+
+// printEmpty prints the -empty report.
+func printEmpty(dirid int64) {
+	for _, section := range []struct {
+		title   string
+		entries []emptyEnt
+	}{
+		{"EMPTY DIRECTORIES", cache.getEmptyDirs(dirid)},
+		{"EMPTY FILES", cache.getEmptyFiles(dirid, opts)},
+	} {
+		printTitle(section.title)
+		t := newTableWriter()
+		for _, e := range section.entries {
+			t.File(e.path, fmt.Sprintf("%d scans\t%s", e.times, e.path), "")
+		}
+		t.Flush()
+		endReport()
+	}
+}
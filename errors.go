@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"syscall"
+)
+
+// Failures deep inside fileDB are raised with fatal, which panics, and
+// turned back into errors by catch at the methods that return them:
+// opening a database, scanning, checking alerts, and main itself for
+// everything else.  Deferred rollbacks run on the way out, so no
+// transaction is left half done.  main explains the error it ends up
+// with and exits with a status telling what kind it was.
+
+// A fatalError is what fatal panics with.
+type fatalError struct {
+	err error
+}
+
+func fatal(err error) {
+	if err != nil {
+		panic(fatalError{err})
+	}
+}
+
+// catch recovers from fatal, setting *err to what it was raised with,
+// wrapped with what was being done if that's given.  Other panics go on.
+// It must be deferred.
+func catch(err *error, doing string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	f, ok := r.(fatalError)
+	if !ok {
+		panic(r)
+	}
+	*err = f.err
+	if doing != "" {
+		*err = fmt.Errorf("%s: %w", doing, f.err)
+	}
+}
+
+// A usageError is a command or flag used wrongly, and exits with status
+// 2.
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+// usagef raises a usageError with the message given.
+func usagef(format string, args ...interface{}) {
+	fatal(usageError(fmt.Sprintf(format, args...)))
+}
+
+// An exitStatus ends filebase with that status and nothing more said, as
+// when a command has already shown its usage, or found what it exits 1
+// to report.
+type exitStatus int
+
+func (s exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(s))
+}
+
+// Exit statuses, beyond 1 for any other error, 2 for bad usage and
+// exitThreshold.
+const (
+	exitBusy    = 4
+	exitFull    = 5
+	exitCorrupt = 6
+	exitAccess  = 7
+)
+
+// SQLite's primary result codes, as found by sqliteCode.
+const (
+	sqlitePerm     = 3
+	sqliteBusy     = 5
+	sqliteLocked   = 6
+	sqliteReadOnly = 8
+	sqliteCorrupt  = 11
+	sqliteFull     = 13
+	sqliteCantOpen = 14
+	sqliteNotADB   = 26
+)
+
+// explain returns the exit status for err, and what might be done about
+// it.
+func explain(err error) (int, string) {
+	code, _ := sqliteCode(err)
+	var status exitStatus
+	var bad usageError
+	switch {
+	case errors.As(err, &status):
+		return int(status), ""
+	case errors.As(err, &bad):
+		return 2, ""
+	case errors.Is(err, errScanLocked):
+		return exitBusy, "Use -wait to wait for the other scan to finish."
+	case code == sqliteBusy || code == sqliteLocked:
+		return exitBusy, "The database stayed locked by another process.  Try again when it has finished."
+	case code == sqliteFull || errors.Is(err, syscall.ENOSPC):
+		return exitFull, "The disk is full.  Free some space, or use -db to put the database elsewhere."
+	case code == sqliteCorrupt || code == sqliteNotADB:
+		return exitCorrupt, "The database is damaged, or isn't a filebase database.  Run \"filebase db check\", or put back a backup."
+	case code == sqlitePerm || code == sqliteReadOnly || code == sqliteCantOpen || errors.Is(err, fs.ErrPermission):
+		return exitAccess, "The database can't be opened for writing.  Check its permissions and those of its directory, or use -noscan to only report."
+	}
+	return 1, ""
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// With -events ndjson, scans write a JSON object a line for each file
+// they see, add or find changed, each file that has vanished and each
+// error, for other programs to follow as a feed of changes.
+
+// events is where scan events go, or nil without -events.
+var events *eventWriter
+
+type event struct {
+	Event    string `json:"event"`
+	Time     string `json:"time"`
+	Dir      string `json:"dir"`
+	Path     string `json:"path"`
+	Size     *int64 `json:"size,omitempty"`
+	Mtime    int64  `json:"mtime,omitempty"`
+	PrevSize *int64 `json:"prev_size,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type eventWriter struct {
+	mu  sync.Mutex
+	w   *bufio.Writer
+	enc *json.Encoder
+	c   io.Closer
+}
+
+// openEvents starts writing events as -events and -events-to say.  When
+// they go to stdout, output that would have gone there too goes to stderr
+// instead, unless -o sends it elsewhere.
+func openEvents(format, to string) *eventWriter {
+	if format == "" {
+		return nil
+	}
+	if format != "ndjson" {
+		usagef("-events must be ndjson")
+	}
+
+	var out io.Writer = os.Stdout
+	var c io.Closer
+	if to == "" {
+		if stdout == out {
+			stdout = os.Stderr
+		}
+	} else {
+		network := "tcp"
+		if strings.Contains(to, "/") {
+			network = "unix"
+		}
+		conn, err := net.Dial(network, to)
+		if err != nil {
+			fatal(fmt.Errorf("-events-to: %w", err))
+		}
+		out, c = conn, conn
+	}
+	w := bufio.NewWriter(out)
+	return &eventWriter{w: w, enc: json.NewEncoder(w), c: c}
+}
+
+func (e *eventWriter) send(ev event) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if ev.Time == "" {
+		ev.Time = time.Now().Format(time.RFC3339)
+	}
+	fatal(e.enc.Encode(ev))
+}
+
+func (e *eventWriter) flush() {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fatal(e.w.Flush())
+}
+
+func (e *eventWriter) close() {
+	if e == nil {
+		return
+	}
+	e.flush()
+	if e.c != nil {
+		e.c.Close()
+	}
+}
+
+// sampleEvent sends the event for a sample about to be inserted for
+// fileid: added if it has none yet, changed if its size or mtime differs
+// from the one before, and seen otherwise.
+func (fdb *fileDB) sampleEvent(tx *sql.Tx, fileid int64, root string, job *insertJob) {
+	ev := event{
+		Event: "seen",
+		Time:  job.now.Format(time.RFC3339),
+		Dir:   root,
+		Path:  job.p,
+		Mtime: job.i.ModTime().Unix(),
+	}
+	size := job.i.Size()
+	ev.Size = &size
+
+	var prevSize, prevMtime int64
+	err := tx.QueryRow("SELECT size, mtime FROM sample WHERE fileid = ? ORDER BY sampletime DESC LIMIT 1", fileid).
+		Scan(&prevSize, &prevMtime)
+	switch {
+	case err == sql.ErrNoRows:
+		ev.Event = "added"
+	case err != nil:
+		fatal(err)
+	case prevSize != size || prevMtime != ev.Mtime:
+		ev.Event = "changed"
+		ev.PrevSize = &prevSize
+	}
+	events.send(ev)
+}
+
+// vanishedEvents sends an event for each file recorded as vanished by
+// scanid.
+func (fdb *fileDB) vanishedEvents(dirid, scanid int64) {
+	root := fdb.getDirPath(dirid)
+	rows, err := fdb.db.Query("SELECT path, size FROM vanished WHERE scanid = ? ORDER BY path", scanid)
+	fatal(err)
+	defer rows.Close()
+	for rows.Next() {
+		var path string
+		var size sql.NullInt64
+		fatal(rows.Scan(&path, &size))
+		ev := event{Event: "vanished", Dir: root, Path: strings.TrimSuffix(root, "/") + "/" + path}
+		if size.Valid {
+			ev.PrevSize = &size.Int64
+		}
+		events.send(ev)
+	}
+	fatal(rows.Err())
+}
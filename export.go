@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "export",
+		synopsis: "[-as influx|json] [-since age] [-file path]... [dir...]",
+		help:     "Write the size of the dirs, or of every recorded directory, at each scan, and of each -file at each sample, for Grafana: as InfluxDB line protocol, or as JSON datasource time series.",
+		run:      runExport,
+		readOnly: true,
+	})
+}
+
+// A series is a directory's or file's size over time.
+type series struct {
+	measurement string
+	tags        [][2]string
+	points      []seriesPoint
+}
+
+type seriesPoint struct {
+	when   time.Time
+	fields []seriesField
+}
+
+type seriesField struct {
+	name  string
+	value int64
+}
+
+func runExport(args []string) {
+	fs := commandFlags("export")
+	as := fs.String("as", "influx", "Output influx line protocol or json.")
+	since := fs.String("since", "", "Only export points this recent, such as 30d.")
+	var files []string
+	fs.Var((*stringList)(&files), "file", "Also export the samples of this file. May be repeated.")
+	parseFlags(fs, args)
+	if *as != "influx" && *as != "json" {
+		usagef("-as must be influx or json")
+	}
+	var cutoff time.Time
+	if *since != "" {
+		age, err := parseAge(*since)
+		if err != nil {
+			usagef("invalid -since %q", *since)
+		}
+		cutoff = time.Now().Add(-age)
+	}
+
+	var dirids []int64
+	for _, dir := range fs.Args() {
+		dirid, _ := cache.findDir(dir)
+		dirids = append(dirids, dirid)
+	}
+	if fs.NArg() == 0 {
+		dirids = cache.allDirIDs()
+	}
+
+	var all []series
+	for _, dirid := range dirids {
+		all = append(all, cache.dirSeries(dirid, cutoff))
+	}
+	for _, f := range files {
+		all = append(all, cache.fileSeries(f, cutoff))
+	}
+
+	w := bufio.NewWriter(stdout)
+	if *as == "json" {
+		writeJSONSeries(w, all)
+	} else {
+		for _, s := range all {
+			writeInfluxSeries(w, s)
+		}
+	}
+	fatal(w.Flush())
+}
+
+// dirSeries returns the size and file count of dirid at each finished
+// scan since cutoff.
+func (fdb *fileDB) dirSeries(dirid int64, cutoff time.Time) series {
+	var dir, host string
+	fatal(fdb.ro.QueryRow("SELECT dirpath, coalesce(host, '') FROM dir WHERE dirid = ?", dirid).Scan(&dir, &host))
+	s := series{measurement: "filebase_dir", tags: [][2]string{{"dir", dir}}}
+	if host != "" {
+		s.tags = append(s.tags, [2]string{"host", host})
+	}
+
+	rows, err := fdb.ro.Query(
+		`SELECT started, bytes, files FROM scan
+		WHERE dirid = ? AND finished IS NOT NULL AND bytes IS NOT NULL AND started >= ?
+		ORDER BY started`, dirid, cutoff.Unix())
+	fatal(err)
+	defer rows.Close()
+	for rows.Next() {
+		var when, bytes, files int64
+		fatal(rows.Scan(&when, &bytes, &files))
+		s.points = append(s.points, seriesPoint{time.Unix(when, 0), []seriesField{{"bytes", bytes}, {"files", files}}})
+	}
+	fatal(rows.Err())
+	return s
+}
+
+// fileSeries returns the valid samples of the file at path since cutoff.
+func (fdb *fileDB) fileSeries(path string, cutoff time.Time) series {
+	dirid, abs := fdb.findDir(path)
+	root := fdb.getDirPath(dirid)
+	s := series{measurement: "filebase_file", tags: [][2]string{{"path", abs}}}
+
+	rows, err := fdb.ro.Query(
+		`SELECT sampletime, size FROM sample, file, dirtree
+		WHERE dirtree.dirid = ? AND dirtree.path = ? AND file.treeid = dirtree.treeid AND file.name = ? AND
+			sample.fileid = file.fileid AND sample.invalid IS NULL AND sampletime >= ?
+		ORDER BY sampletime`, dirid, treePath(root, filepath.Dir(abs)), filepath.Base(abs), cutoff.Unix())
+	fatal(err)
+	defer rows.Close()
+	for rows.Next() {
+		var when, size int64
+		fatal(rows.Scan(&when, &size))
+		s.points = append(s.points, seriesPoint{time.Unix(when, 0), []seriesField{{"bytes", size}}})
+	}
+	fatal(rows.Err())
+	if len(s.points) == 0 {
+		fmt.Fprintf(os.Stderr, "%s has no samples\n", path)
+	}
+	return s
+}
+
+// influxEscaper escapes tag keys and values in InfluxDB line protocol.
+var influxEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+
+func writeInfluxSeries(w *bufio.Writer, s series) {
+	var key strings.Builder
+	key.WriteString(s.measurement)
+	for _, t := range s.tags {
+		fmt.Fprintf(&key, ",%s=%s", t[0], influxEscaper.Replace(t[1]))
+	}
+	for _, p := range s.points {
+		w.WriteString(key.String())
+		for i, f := range p.fields {
+			sep := ","
+			if i == 0 {
+				sep = " "
+			}
+			fmt.Fprintf(w, "%s%s=%di", sep, f.name, f.value)
+		}
+		fmt.Fprintf(w, " %d\n", p.when.UnixNano())
+	}
+}
+
+// writeJSONSeries writes a time series for each field of each series, in
+// the form served by a Grafana JSON datasource: values with times in
+// milliseconds.
+func writeJSONSeries(w *bufio.Writer, all []series) {
+	type target struct {
+		Target     string     `json:"target"`
+		Datapoints [][2]int64 `json:"datapoints"`
+	}
+	result := []target{}
+	for _, s := range all {
+		name := s.tags[0][1]
+		if len(s.tags) > 1 {
+			name = s.tags[1][1] + ":" + name
+		}
+		var fields []string
+		if len(s.points) > 0 {
+			for _, f := range s.points[0].fields {
+				fields = append(fields, f.name)
+			}
+		}
+		for i, field := range fields {
+			t := target{Target: name + " " + field, Datapoints: [][2]int64{}}
+			for _, p := range s.points {
+				t.Datapoints = append(t.Datapoints, [2]int64{p.fields[i].value, p.when.UnixNano() / int64(time.Millisecond)})
+			}
+			result = append(result, t)
+		}
+	}
+	fatal(json.NewEncoder(w).Encode(result))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// stringList is a flag.Value collecting every use of a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// nameFilter is an SQL condition, to be placed directly after the
+// "file.dirid = ?" of a report query, applying -match, -exclude, -owner,
+// -tag, -exclude-tag and -hidden.  The arguments for all of them come from
+// reportOptions.filterArgs.
+const nameFilter = `
+			and (? = 0 or exists (select 1 from json_each(?) where file.path GLOB json_each.value))
+			and not exists (select 1 from json_each(?) where file.path GLOB json_each.value)
+			and (? = 0 or file.uid in (select value from json_each(?)))` + tagFilter + hiddenFilter
+
+// filterArgs builds the arguments for a report query, inserting those
+// needed by nameFilter after the first one (the dirid).
+func (o reportOptions) filterArgs(dirid int64, rest ...interface{}) []interface{} {
+	owners, err := json.Marshal(o.Owners)
+	fatal(err)
+	args := []interface{}{dirid, len(o.Matches), jsonList(o.Matches), jsonList(o.Excludes),
+		len(o.Owners), string(owners), len(o.Tags), jsonList(o.Tags), jsonList(o.ExcludeTags), o.Hidden, o.Hidden}
+	return append(args, rest...)
+}
+
+// jsonList encodes a list for use with SQLite's json_each.
+func jsonList(l []string) string {
+	if l == nil {
+		l = []string{}
+	}
+	b, err := json.Marshal(l)
+	fatal(err)
+	return string(b)
+}
+
+// Hidden files are those with a name starting with a dot, or under a
+// directory with one, below the recorded directory.  -hidden and
+// -scan-hidden can leave them out, or everything else.
+const (
+	hiddenSkip = "skip"
+	hiddenOnly = "only"
+)
+
+func parseHidden(s string) (string, error) {
+	if s != hiddenSkip && s != hiddenOnly {
+		return "", fmt.Errorf("%q isn't skip or only", s)
+	}
+	return s, nil
+}
+
+// hiddenFilter is the part of nameFilter applying -hidden.
+const hiddenFilter = `
+			and (? = '' or (? = 'only') = exists (select 1 from dir where dir.dirid = file.dirid and
+				instr(substr(file.path, length(rtrim(dir.dirpath, '/')) + 1), '/.') > 0))`
+
+// hiddenPath tells whether a path relative to a recorded directory is
+// hidden.
+func hiddenPath(rel string) bool {
+	return strings.HasPrefix(rel, ".") || strings.Contains(rel, "/.")
+}
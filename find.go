@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "find",
+		synopsis: "<dir> <pattern>",
+		help:     "List recorded files under dir whose path matches a glob or contains a substring.",
+		run:      runFind,
+		readOnly: true,
+	})
+}
+
+func runFind(args []string) {
+	fs := commandFlags("find")
+	parseFlags(fs, args)
+	needArgs(fs, 2)
+
+	dirid, path := cache.findDir(fs.Arg(0))
+	files := cache.findFiles(dirid, path, fs.Arg(1))
+	if sortKey != nil {
+		sortKey.sort(files)
+	}
+	w := newFileWriter()
+	for i := range files {
+		w.Write(&files[i])
+	}
+	w.Flush()
+}
+
+// findFiles returns the latest sample of each file below path matching
+// pattern.  Patterns containing glob metacharacters are matched against the
+// whole path, anything else is a substring search.
+func (fdb *fileDB) findFiles(dirid int64, path, pattern string) []fileEnt {
+	match := "instr(path, ?) > 0"
+	if strings.ContainsAny(pattern, "*?[") {
+		match = "path GLOB ?"
+	}
+
+	args := append([]interface{}{dirid}, underPathArgs(path)...)
+	args = append(args, pattern)
+	rows, err := fdb.ro.Query(
+		`select path, sampletime, mode, size, mtime from filepaths as file, sample
+		where file.fileid=sample.fileid and
+			file.dirid = ? and `+underPath+` and `+match+` and
+			sample.sampletime =	(
+				select max(sampletime) from sample where file.fileid=sample.fileid
+				)
+		order by path`, args...)
+	fatal(err)
+	defer rows.Close()
+
+	var result []fileEnt
+	for rows.Next() {
+		var f fileEnt
+		f.Scan(rows)
+		result = append(result, f)
+	}
+	fatal(rows.Err())
+	return result
+}
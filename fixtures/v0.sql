@@ -0,0 +1,54 @@
+-- A database as written by the first release of filebase.
+
+PRAGMA foreign_keys = ON;
+
+CREATE TABLE IF NOT EXISTS dir (
+		dirid integer PRIMARY KEY,
+		dirpath text
+);
+
+CREATE TABLE IF NOT EXISTS file (
+        fileid integer PRIMARY KEY,
+        dirid integer,
+        path text,
+        FOREIGN KEY (dirid) REFERENCES dir(dirid) ON UPDATE RESTRICT ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS filediridpath ON file(dirid, path);
+
+CREATE TABLE IF NOT EXISTS sample (
+        fileid integer,
+        sampletime integer,
+        mode integer,
+        size integer,
+        mtime integer,
+        PRIMARY KEY (fileid, sampletime),
+        FOREIGN KEY (fileid) REFERENCES file(fileid) ON UPDATE RESTRICT ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS samplesize ON sample(size);
+CREATE INDEX IF NOT EXISTS samplemtime ON sample(mtime);
+
+create view IF NOT EXISTS times as
+    SELECT file.dirid, sample.fileid, sampletime, mode, size, mtime, max(sampletime) as maxtime, min(sampletime) as mintime
+    from sample, file, dir
+    where file.fileid == sample.fileid and file.dirid = dir.dirid
+    group by sample.fileid;
+
+create view IF NOT EXISTS rates AS
+    SELECT *,
+      ((select size from sample WHERE sampletime = maxtime and sample.fileid = times.fileid)-
+       (select size from sample WHERE sampletime = mintime and sample.fileid = times.fileid)) / 
+      cast(maxtime-mintime AS real) as rate
+    from times;
+
+INSERT INTO dir VALUES (1, '/data');
+
+INSERT INTO file VALUES (1, 1, '/data/a.log');
+INSERT INTO file VALUES (2, 1, '/data/big.iso');
+INSERT INTO file VALUES (3, 1, '/data/sub/old.txt');
+
+INSERT INTO sample VALUES (1, 1600000000, 420, 100, 1599999000);
+INSERT INTO sample VALUES (1, 1600086400, 420, 1100, 1600086000);
+INSERT INTO sample VALUES (2, 1600000000, 420, 5000000000, 1500000000);
+INSERT INTO sample VALUES (2, 1600086400, 420, 5000000000, 1500000000);
+INSERT INTO sample VALUES (3, 1600000000, 420, 10, 1000000000);
+INSERT INTO sample VALUES (3, 1600086400, 420, 10, 1000000000);
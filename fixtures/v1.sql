@@ -0,0 +1,78 @@
+-- A database with content types, sample sources, invalid samples, original
+-- root names, filesystem anchors, named queries and clock offsets.
+
+PRAGMA foreign_keys = ON;
+
+CREATE TABLE dir (
+		dirid integer PRIMARY KEY,
+		dirpath text,
+		origpath text,
+		fsuuid text,
+		relpath text
+);
+CREATE TABLE file (
+        fileid integer PRIMARY KEY,
+        dirid integer,
+        path text,
+        mimetype text,
+        FOREIGN KEY (dirid) REFERENCES dir(dirid) ON UPDATE RESTRICT ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX filediridpath ON file(dirid, path);
+CREATE TABLE sample (
+        fileid integer,
+        sampletime integer,
+        mode integer,
+        size integer,
+        mtime integer,
+        source text NOT NULL DEFAULT 'scan',
+        invalid text,
+        PRIMARY KEY (fileid, sampletime),
+        FOREIGN KEY (fileid) REFERENCES file(fileid) ON UPDATE RESTRICT ON DELETE CASCADE
+);
+CREATE INDEX samplesize ON sample(size);
+CREATE INDEX samplemtime ON sample(mtime);
+CREATE TABLE namedquery (
+        name text PRIMARY KEY,
+        query text
+);
+CREATE TABLE reportcache (
+        key text PRIMARY KEY,
+        result blob
+);
+CREATE TABLE clockoffset (
+        host text,
+        sampletime integer,
+        offset integer,
+        PRIMARY KEY (host, sampletime)
+);
+CREATE VIEW times as
+    SELECT file.dirid, sample.fileid, sampletime, mode, size, mtime, max(sampletime) as maxtime, min(sampletime) as mintime
+    from sample, file, dir
+    where file.fileid == sample.fileid and file.dirid = dir.dirid and sample.invalid is null
+    group by sample.fileid;
+CREATE VIEW rates AS
+    SELECT *,
+      ((select size from sample WHERE sampletime = maxtime and sample.fileid = times.fileid)-
+       (select size from sample WHERE sampletime = mintime and sample.fileid = times.fileid)) / 
+      cast(maxtime-mintime AS real) as rate
+    from times;
+
+INSERT INTO dir VALUES (1, '/data', '/mnt/data', NULL, NULL);
+INSERT INTO dir VALUES (2, 'remote:/srv', 'remote:/srv', NULL, NULL);
+
+INSERT INTO file VALUES (1, 1, '/data/a.log', 'text/plain');
+INSERT INTO file VALUES (2, 1, '/data/big.iso', 'application/octet-stream');
+INSERT INTO file VALUES (3, 1, '/data/sub/old.txt', 'text/plain');
+INSERT INTO file VALUES (4, 2, 'remote:/srv/db', NULL);
+
+INSERT INTO sample VALUES (1, 1600000000, 420, 100, 1599999000, 'scan', NULL);
+INSERT INTO sample VALUES (1, 1600086400, 420, 1100, 1600086000, 'scan', NULL);
+INSERT INTO sample VALUES (1, 1700000000, 420, 999999999, 1600086000, 'scan', 'sample time in the future');
+INSERT INTO sample VALUES (2, 1600000000, 420, 5000000000, 1500000000, 'scan', NULL);
+INSERT INTO sample VALUES (2, 1600086400, 420, 5000000000, 1500000000, 'scan', NULL);
+INSERT INTO sample VALUES (3, 1600000000, 420, 10, 1000000000, 'scan', NULL);
+INSERT INTO sample VALUES (3, 1600086400, 420, 10, 1000000000, 'scan', NULL);
+INSERT INTO sample VALUES (4, 1600000000, 420, 1000, 1600000000, 'agent', NULL);
+
+INSERT INTO namedquery VALUES ('count', 'select count(*) from file');
+INSERT INTO clockoffset VALUES ('remote', 1600000000, -3);
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "freed",
+		synopsis: "[-since age] [-by dir|owner|day|week|month] [-depth n] <dir>",
+		help:     "Total the space freed by files deleted under dir since a time, by the directories -depth levels below it, by the owners of the files, or by when scans found them gone.",
+		run:      runFreed,
+		readOnly: true,
+	})
+}
+
+// vanishedOwners adds who owned each deleted file, so the space freed can
+// be put down to them.
+func vanishedOwners(tx *sql.Tx) {
+	addColumn(tx, "vanished", "uid", "integer")
+}
+
+type freedEnt struct {
+	name  string
+	files int64
+	size  int64
+}
+
+func runFreed(args []string) {
+	fs := commandFlags("freed")
+	since := fs.String("since", "7d", "How far back to look, such as 12h or 30d.")
+	by := fs.String("by", "dir", "Total by dir, owner, day, week or month.")
+	depth := fs.Int("depth", 1, "With -by dir, total by the directories this many levels below dir.")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	age, err := parseAge(*since)
+	if err != nil {
+		usagef("invalid -since %q", *since)
+	}
+	group, ok := freedGroups[*by]
+	if !ok || *depth < 1 {
+		badUsage(fs)
+	}
+
+	dirid, root := cache.findDir(fs.Arg(0))
+	cutoff := time.Now().Add(-age)
+	totals := make(map[string]*freedEnt)
+	var all freedEnt
+	for _, v := range cache.getVanished(dirid, cutoff) {
+		name := group(root, *depth, &v)
+		t := totals[name]
+		if t == nil {
+			t = &freedEnt{name: name}
+			totals[name] = t
+		}
+		t.files++
+		t.size += v.size
+		all.files++
+		all.size += v.size
+	}
+
+	result := make([]*freedEnt, 0, len(totals))
+	for _, t := range totals {
+		result = append(result, t)
+	}
+	// Times are listed in order, the rest most freed first.
+	sort.Slice(result, func(i, j int) bool {
+		if *by == "dir" || *by == "owner" {
+			if result[i].size != result[j].size {
+				return result[i].size > result[j].size
+			}
+		}
+		return result[i].name < result[j].name
+	})
+
+	if outputFormat != "csv" && outputFormat != "json" {
+		printTitle(fmt.Sprintf("FREED SINCE %s: %sB IN %d FILES", cutoff.Format("2006-01-02 15:04"),
+			strings.TrimSpace(niceSize(all.size)), all.files))
+	}
+	col := *by
+	if col == "dir" {
+		col = "path"
+	}
+	w := newRowWriter(stdout)
+	w.Header([]string{"freed", "files", col})
+	for i, t := range result {
+		if listSize >= 0 && i >= listSize {
+			break
+		}
+		size := interface{}(t.size)
+		if outputFormat == "text" || outputFormat == "markdown" || outputFormat == "html" {
+			size = strings.TrimSpace(niceSize(t.size)) + "B"
+		}
+		w.Row([]interface{}{size, t.files, t.name})
+	}
+	w.Flush()
+}
+
+// A vanishedEnt is a file a scan found deleted.
+type vanishedEnt struct {
+	path  string
+	size  int64
+	uid   sql.NullInt64
+	found time.Time
+}
+
+// freedGroups name what each -by totals a deleted file under.
+var freedGroups = map[string]func(root string, depth int, v *vanishedEnt) string{
+	"dir": func(root string, depth int, v *vanishedEnt) string {
+		return prefixAt(root, strings.TrimSuffix(root, "/")+"/"+v.path, depth)
+	},
+	"owner": func(root string, depth int, v *vanishedEnt) string {
+		if !v.uid.Valid {
+			return "unknown"
+		}
+		return ownerName(v.uid.Int64)
+	},
+	"day": func(root string, depth int, v *vanishedEnt) string {
+		return v.found.Format("2006-01-02")
+	},
+	"week": func(root string, depth int, v *vanishedEnt) string {
+		year, week := v.found.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	},
+	"month": func(root string, depth int, v *vanishedEnt) string {
+		return v.found.Format("2006-01")
+	},
+}
+
+// getVanished finds the files in dirid that scans started since cutoff
+// found deleted, with when they were found gone.
+func (fdb *fileDB) getVanished(dirid int64, cutoff time.Time) (result []vanishedEnt) {
+	rows, err := fdb.ro.Query(
+		`select vanished.path, coalesce(vanished.size, 0), vanished.uid, scan.started
+		from vanished, scan
+		where vanished.dirid = ? and scan.rowid = vanished.scanid and scan.started >= ?`,
+		dirid, cutoff.Unix())
+	fatal(err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var v vanishedEnt
+		var found int64
+		fatal(rows.Scan(&v.path, &v.size, &v.uid, &found))
+		v.found = time.Unix(found, 0)
+		result = append(result, v)
+	}
+	fatal(rows.Err())
+	return
+}
@@ -0,0 +1,8 @@
+//go:build !sqlite_fts5
+
+package main
+
+// ftsModule is the SQLite full-text search module behind the path index.
+// FTS5 is only there when go-sqlite3 is built with -tags sqlite_fts5, but
+// FTS4 always is, and matches words, prefixes and phrases the same way.
+const ftsModule = "fts4"
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// With -hash, scans record a SHA-256 of each file's contents, along with
+// the size and mtime it had then.  Files are only hashed again once their
+// size or mtime changes.
+
+// hashFile returns the hex SHA-256 of a file's contents.
+func hashFile(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Print(err)
+		return ""
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		log.Print(err)
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// needsHash tells whether a file has changed since it was last hashed.
+func (fdb *fileDB) needsHash(dirid int64, root, path string, info os.FileInfo) bool {
+	var size, mtime sql.NullInt64
+	err := fdb.getHashed.QueryRow(dirid, treePath(root, filepath.Dir(path)), filepath.Base(path)).Scan(&size, &mtime)
+	if err == sql.ErrNoRows {
+		return true
+	}
+	fatal(err)
+	return !size.Valid || size.Int64 != info.Size() || mtime.Int64 != info.ModTime().Unix()
+}
+
+// A hashPool hashes the files of the jobs sent to it on a few goroutines,
+// then passes the jobs on to be inserted, so that the walk goes on while
+// files are read, and big files are hashed side by side.  The walk waits
+// once all of them are busy and the few jobs queued for them are taken.
+type hashPool struct {
+	jobs chan *insertJob
+	wg   sync.WaitGroup
+}
+
+func startHashers(out chan<- *insertJob, workers int) *hashPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &hashPool{jobs: make(chan *insertJob, workers)}
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				job.hash = hashFile(job.p)
+				out <- job
+			}
+		}()
+	}
+	return p
+}
+
+// close waits for the jobs sent so far to be hashed and passed on.
+func (p *hashPool) close() {
+	close(p.jobs)
+	p.wg.Wait()
+}
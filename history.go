@@ -0,0 +1,135 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "history",
+		synopsis: "[-spark] <path>",
+		help:     "List every sample recorded of a file: when it was taken, the size and how it changed since the one before, the mode and mtime.  -spark draws the sizes as a sparkline instead.",
+		run:      runHistory,
+		readOnly: true,
+	})
+}
+
+type historyEnt struct {
+	when    time.Time
+	size    int64
+	delta   int64
+	mode    int
+	mtime   time.Time
+	source  string
+	invalid string
+}
+
+// sparks are the bars of a sparkline, lowest first.
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+func runHistory(args []string) {
+	fs := commandFlags("history")
+	spark := fs.Bool("spark", false, "Draw the sizes as a sparkline, with the least and most.")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	dirid, path := cache.findDir(fs.Arg(0))
+	history := cache.getHistory(dirid, path)
+	if len(history) == 0 {
+		fatal(fmt.Errorf("%s has no samples", path))
+	}
+
+	if *spark {
+		fmt.Fprintln(stdout, sparkline(history))
+		return
+	}
+
+	if outputFormat != "text" {
+		w := newRowWriter(stdout)
+		w.Header([]string{"time", "bytes", "delta", "mode", "mtime", "source", "invalid"})
+		for _, h := range history {
+			w.Row([]interface{}{h.when.Format(time.RFC3339), h.size, h.delta, h.mode,
+				h.mtime.Format(time.RFC3339), h.source, h.invalid})
+		}
+		w.Flush()
+		return
+	}
+
+	printTitle("HISTORY OF " + path)
+	t := newTableWriter()
+	for i, h := range history {
+		delta := ""
+		if i > 0 && h.delta != 0 {
+			sign := "+"
+			n := h.delta
+			if n < 0 {
+				sign, n = "-", -n
+			}
+			delta = sign + strings.TrimSpace(niceSize(n))
+		}
+		line := fmt.Sprintf("%s\t%v\t%s\t%o\t%s\t%s", h.when.Format("2006-01-02 15:04:05"), sizeColumns(h.size),
+			delta, h.mode, h.mtime.Format("2006-01-02 15:04:05"), h.source)
+		if h.invalid != "" {
+			t.Line(line+"\tinvalid: "+h.invalid, colorDim)
+		} else {
+			t.Line(line, "")
+		}
+	}
+	t.Flush()
+	fmt.Fprintln(stdout)
+}
+
+// getHistory returns every sample of the file at path in dirid, oldest
+// first, with how its size changed since the one before.
+func (fdb *fileDB) getHistory(dirid int64, path string) (result []historyEnt) {
+	root := fdb.getDirPath(dirid)
+	rows, err := fdb.ro.Query(
+		`SELECT sampletime, size, mode, mtime, source, invalid FROM sample, file, dirtree
+		WHERE dirtree.dirid = ? AND dirtree.path = ? AND file.treeid = dirtree.treeid AND file.name = ? AND
+			sample.fileid = file.fileid
+		ORDER BY sampletime`, dirid, treePath(root, filepath.Dir(path)), filepath.Base(path))
+	fatal(err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var h historyEnt
+		var when, mtime int64
+		var invalid sql.NullString
+		fatal(rows.Scan(&when, &h.size, &h.mode, &mtime, &h.source, &invalid))
+		h.when, h.mtime, h.invalid = time.Unix(when, 0), time.Unix(mtime, 0), invalid.String
+		if len(result) > 0 {
+			h.delta = h.size - result[len(result)-1].size
+		}
+		result = append(result, h)
+	}
+	fatal(rows.Err())
+	return
+}
+
+// sparkline draws the sizes in history as bars scaled between the least
+// and the most of them.
+func sparkline(history []historyEnt) string {
+	least, most := history[0].size, history[0].size
+	for _, h := range history {
+		if h.size < least {
+			least = h.size
+		}
+		if h.size > most {
+			most = h.size
+		}
+	}
+
+	var b strings.Builder
+	for _, h := range history {
+		i := 0
+		if most > least {
+			i = int((h.size - least) * int64(len(sparks)-1) / (most - least))
+		}
+		b.WriteRune(sparks[i])
+	}
+	return fmt.Sprintf("%s  %sB .. %sB", b.String(), strings.TrimSpace(niceSize(least)), strings.TrimSpace(niceSize(most)))
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// With -format html, reports are written as one standalone page, with
+// tables that sort when their headings are clicked and a chart of each
+// directory's size over time, to be mailed around or put on a web server.
+
+const htmlHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>filebase report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+h1 { font-size: 1.4em; border-bottom: 1px solid #ccc; }
+h2 { font-size: 1.1em; margin-top: 1.5em; }
+table { border-collapse: collapse; }
+th { cursor: pointer; min-width: 1em; background: #eee; text-align: left; }
+th, td { padding: 0.2em 0.8em; }
+td { font-family: monospace; white-space: nowrap; }
+tr:nth-child(even) td { background: #f7f7f7; }
+tr.red td { color: #c00; }
+tr.dim td { color: #999; }
+svg.trend { background: #fafafa; border: 1px solid #ddd; }
+</style>
+<script>
+// Sizes sort by their value, so 2k comes before 1M.
+var units = {k: 1e3, M: 1e6, G: 1e9, T: 1e12, P: 1e15, E: 1e18,
+	Ki: 1024, Mi: Math.pow(2, 20), Gi: Math.pow(2, 30), Ti: Math.pow(2, 40), Pi: Math.pow(2, 50)};
+// Numbers shown with -thousands and -decimal marks are read without them.
+var thousandsMark = %q, decimalMark = %q;
+function sortKey(td) {
+	var s = td.dataset.sort !== undefined ? td.dataset.sort : td.textContent;
+	var n = s;
+	if (td.dataset.sort === undefined) {
+		n = (thousandsMark ? n.split(thousandsMark).join("") : n).replace(decimalMark, ".");
+	}
+	var m = /^\s*([+-]?[0-9.]+)\s*(Ki|Mi|Gi|Ti|Pi|k|M|G|T|P|E)?/.exec(n);
+	return m ? parseFloat(m[1]) * (units[m[2]] || 1) : s;
+}
+function sortTable(th) {
+	var table = th.closest("table"), col = th.cellIndex;
+	var rows = Array.from(table.tBodies[0].rows);
+	var desc = th.dataset.desc !== "true";
+	th.dataset.desc = desc;
+	rows.sort(function(a, b) {
+		var x = sortKey(a.cells[col]), y = sortKey(b.cells[col]);
+		var c = typeof x === "number" && typeof y === "number" ? x - y : String(x).localeCompare(String(y));
+		return desc ? -c : c;
+	});
+	rows.forEach(function(r) { table.tBodies[0].appendChild(r); });
+}
+</script>
+</head>
+<body>
+<p>Generated by filebase on %s.</p>
+`
+
+const htmlFoot = `</body>
+</html>
+`
+
+func startHTML() {
+	fmt.Fprintf(stdout, htmlHead, thousandsMark, decimalMark, html.EscapeString(time.Now().Format("2006-01-02 15:04")))
+}
+
+func endHTML() {
+	fmt.Fprint(stdout, htmlFoot)
+}
+
+// htmlCell is a table cell, sorted by sort instead of its text if that's
+// given.
+type htmlCell struct {
+	text string
+	sort interface{}
+}
+
+// htmlTable writes a sortable table.
+type htmlTable struct {
+	w    io.Writer
+	rows int
+}
+
+func newHTMLTable(w io.Writer, cols []string) *htmlTable {
+	fmt.Fprint(w, "<table>\n<thead><tr>")
+	for _, c := range cols {
+		fmt.Fprintf(w, `<th onclick="sortTable(this)">%s</th>`, html.EscapeString(c))
+	}
+	fmt.Fprint(w, "</tr></thead>\n<tbody>\n")
+	return &htmlTable{w: w}
+}
+
+func (t *htmlTable) Row(cells []htmlCell, color string) {
+	switch color {
+	case colorRed:
+		fmt.Fprint(t.w, `<tr class="red">`)
+	case colorDim:
+		fmt.Fprint(t.w, `<tr class="dim">`)
+	default:
+		fmt.Fprint(t.w, "<tr>")
+	}
+	for _, c := range cells {
+		if c.sort != nil && c.sort != c.text {
+			fmt.Fprintf(t.w, `<td data-sort="%s">%s</td>`, html.EscapeString(fmt.Sprint(c.sort)), html.EscapeString(c.text))
+		} else {
+			fmt.Fprintf(t.w, "<td>%s</td>", html.EscapeString(c.text))
+		}
+	}
+	fmt.Fprint(t.w, "</tr>\n")
+	t.rows++
+}
+
+func (t *htmlTable) Close() {
+	fmt.Fprint(t.w, "</tbody>\n</table>\n")
+}
+
+// htmlWriter is the rowWriter for -format html.
+type htmlWriter struct {
+	w     io.Writer
+	t     *htmlTable
+	cells []htmlCell
+}
+
+func (h *htmlWriter) Header(cols []string) {
+	h.t = newHTMLTable(h.w, cols)
+}
+
+func (h *htmlWriter) Row(vals []interface{}) {
+	h.cells = h.cells[:0]
+	for _, v := range vals {
+		h.cells = append(h.cells, htmlCell{text: cellString(v)})
+	}
+	h.t.Row(h.cells, "")
+}
+
+func (h *htmlWriter) Flush() {
+	if h.t != nil {
+		h.t.Close()
+	}
+}
+
+// printHTMLTable prints the tab separated lines of a tableWriter as a
+// table.  They have no headings, but the blank ones still sort.
+func printHTMLTable(rows [][]string, colors []string) {
+	cols := 0
+	for _, cells := range rows {
+		if len(cells) > cols {
+			cols = len(cells)
+		}
+	}
+	t := newHTMLTable(stdout, make([]string, cols))
+	for r, line := range rows {
+		cells := make([]htmlCell, len(line))
+		for i, c := range line {
+			cells[i] = htmlCell{text: strings.TrimSpace(c)}
+		}
+		t.Row(cells, colors[r])
+	}
+	t.Close()
+}
+
+// Charts are this many pixels.
+const (
+	chartWidth  = 600
+	chartHeight = 120
+)
+
+// printHTMLDir starts the part of the page about a directory, with a
+// chart of its daily size.
+func printHTMLDir(dirid int64) {
+	path := cache.getDirPath(dirid)
+	fmt.Fprintf(stdout, "<h1>%s</h1>\n", html.EscapeString(path))
+
+	var points []trendPoint
+	for _, p := range cache.getTrend(dirid, path, 24*time.Hour) {
+		if p.sampled {
+			points = append(points, p)
+		}
+	}
+	if len(points) < 2 {
+		return
+	}
+
+	var max int64
+	for _, p := range points {
+		if p.size > max {
+			max = p.size
+		}
+	}
+	first, last := points[0].when, points[len(points)-1].when
+	span := last.Sub(first).Seconds()
+	var coords []string
+	for _, p := range points {
+		x := float64(chartWidth) * p.when.Sub(first).Seconds() / span
+		y := float64(chartHeight)
+		if max > 0 {
+			y -= float64(chartHeight) * float64(p.size) / float64(max)
+		}
+		coords = append(coords, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+	fmt.Fprintf(stdout, `<svg class="trend" width="%d" height="%d" viewBox="0 -10 %[1]d %[2]d">`+"\n",
+		chartWidth, chartHeight+20)
+	fmt.Fprintf(stdout, `<polyline fill="none" stroke="#36c" stroke-width="2" points="%s"/>`+"\n", strings.Join(coords, " "))
+	fmt.Fprintf(stdout, `<text x="4" y="4" font-size="10">%sB</text>`+"\n", html.EscapeString(strings.TrimSpace(niceSize(max))))
+	fmt.Fprintf(stdout, `<text x="4" y="%d" font-size="10">%s</text>`+"\n", chartHeight+8, first.Format("2006-01-02"))
+	fmt.Fprintf(stdout, `<text x="%d" y="%d" font-size="10" text-anchor="end">%s</text>`+"\n",
+		chartWidth-4, chartHeight+8, last.Format("2006-01-02"))
+	fmt.Fprint(stdout, "</svg>\n")
+}
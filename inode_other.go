@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+func fileIdentity(info os.FileInfo) (id inode, ok bool) {
+	return inode{}, false
+}
+
+func fileLinks(info os.FileInfo) (nlink uint64, ok bool) {
+	return 0, false
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// A directory can have a minimum interval between scans, so that a job
+// scanning everything often doesn't keep rescanning volumes that rarely
+// change.  Scans sooner than that are skipped, unless -force is given.
+
+func init() {
+	addCommand(&command{
+		name:     "interval",
+		synopsis: "<dir> [age | none]",
+		help:     "Show or set the least time between scans of dir, such as 1d.  Scans sooner than that are skipped unless -force is given.",
+		run:      runInterval,
+	})
+}
+
+// dirIntervals adds the column holding each directory's interval, in
+// seconds.
+func dirIntervals(tx *sql.Tx) {
+	addColumn(tx, "dir", "mininterval", "integer")
+}
+
+func runInterval(args []string) {
+	fs := commandFlags("interval")
+	parseFlags(fs, args)
+	if fs.NArg() != 1 && fs.NArg() != 2 {
+		badUsage(fs)
+	}
+	dirid := cache.getDirID(fs.Arg(0))
+
+	switch fs.Arg(1) {
+	case "":
+		if d := cache.minInterval(dirid); d > 0 {
+			fmt.Fprintln(stdout, d)
+		} else {
+			fmt.Fprintln(stdout, "none")
+		}
+	case "none":
+		cache.setMinInterval(dirid, 0)
+	default:
+		d, err := parseAge(fs.Arg(1))
+		if err != nil {
+			usagef("%v", err)
+		}
+		cache.setMinInterval(dirid, d)
+	}
+}
+
+func (fdb *fileDB) minInterval(dirid int64) time.Duration {
+	var secs sql.NullInt64
+	fatal(fdb.db.QueryRow("SELECT mininterval FROM dir WHERE dirid = ?", dirid).Scan(&secs))
+	return time.Duration(secs.Int64) * time.Second
+}
+
+func (fdb *fileDB) setMinInterval(dirid int64, d time.Duration) {
+	var secs interface{}
+	if d > 0 {
+		secs = int64(d / time.Second)
+	}
+	_, err := fdb.db.Exec("UPDATE dir SET mininterval = ? WHERE dirid = ?", secs, dirid)
+	fatal(err)
+}
+
+// scannedRecently tells whether dirid was last scanned within its minimum
+// interval, and if so, when.
+func (fdb *fileDB) scannedRecently(dirid int64) (last time.Time, recent bool) {
+	interval := fdb.minInterval(dirid)
+	if interval <= 0 {
+		return
+	}
+	var started sql.NullInt64
+	err := fdb.db.QueryRow("SELECT max(started) FROM scan WHERE dirid = ? AND finished IS NOT NULL", dirid).Scan(&started)
+	fatal(err)
+	if !started.Valid {
+		return
+	}
+	last = time.Unix(started.Int64, 0)
+	return last, time.Since(last) < interval
+}
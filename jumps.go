@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "jumps",
+		synopsis: "[-since age] <dir>",
+		help:     "List the biggest growth of any file between one sample and the next ever recorded under dir, with when it happened, biggest first, -list of them.",
+		run:      runJumps,
+		readOnly: true,
+	})
+}
+
+type jump struct {
+	path          string
+	from, to      time.Time
+	before, after int64
+}
+
+func runJumps(args []string) {
+	fs := commandFlags("jumps")
+	since := fs.String("since", "", "Only list growth this recent, such as 30d.")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	var cutoff time.Time
+	if *since != "" {
+		age, err := parseAge(*since)
+		if err != nil {
+			usagef("invalid -since %q", *since)
+		}
+		cutoff = time.Now().Add(-age)
+	}
+
+	dirid, _ := cache.findDir(fs.Arg(0))
+	if outputFormat != "csv" && outputFormat != "json" {
+		printTitle("BIGGEST JUMPS")
+	}
+	w := newRowWriter(stdout)
+	w.Header([]string{"from", "to", "before", "after", "added", "path"})
+	size := func(n int64) interface{} {
+		if outputFormat == "text" || outputFormat == "markdown" || outputFormat == "html" {
+			return strings.TrimSpace(niceSize(n))
+		}
+		return n
+	}
+	for _, j := range cache.getJumps(dirid, cutoff, listSize, opts) {
+		w.Row([]interface{}{j.from.Format(time.RFC3339), j.to.Format(time.RFC3339),
+			size(j.before), size(j.after), size(j.after - j.before), j.path})
+	}
+	w.Flush()
+}
+
+// getJumps finds the n biggest increases in size from one valid sample of
+// a file in dirid to the next, of those ending since cutoff, biggest
+// first.  n < 0 finds them all.
+func (fdb *fileDB) getJumps(dirid int64, cutoff time.Time, n int, o reportOptions) (result []jump) {
+	rows, err := fdb.ro.Query(
+		`select path, j.prevtime, j.sampletime, j.prev, j.size
+		from filepaths as file,
+			(select sample.fileid, sampletime, size,
+					lag(size) over w as prev, lag(sampletime) over w as prevtime
+				from sample, file
+				where sample.fileid = file.fileid and file.dirid = ? and invalid is null
+				window w as (partition by sample.fileid order by sampletime)) as j
+		where j.fileid = file.fileid and file.dirid = ?`+nameFilter+` and
+			j.size > j.prev and j.sampletime >= ?
+		order by j.size - j.prev desc, j.sampletime desc, path
+		limit ?`,
+		append([]interface{}{dirid}, o.filterArgs(dirid, cutoff.Unix(), n)...)...)
+	fatal(err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var j jump
+		var from, to int64
+		fatal(rows.Scan(&j.path, &from, &to, &j.before, &j.after))
+		j.from, j.to = time.Unix(from, 0), time.Unix(to, 0)
+		result = append(result, j)
+	}
+	fatal(rows.Err())
+	return
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// junkPattern is a glob, matched against whole paths, for files that are
+// probably safe to delete, and why.
+type junkPattern struct {
+	Glob string `json:"glob"`
+	Why  string `json:"why"`
+}
+
+// junkPatterns are the built-in heuristics for the -junk report.  More can
+// be added under "junk" in the configuration file.
+var junkPatterns = []junkPattern{
+	{"*/.cache/*", "cache directory"},
+	{"*/__pycache__/*", "Python bytecode"},
+	{"*/node_modules/.cache/*", "build cache"},
+	{"*/.gradle/caches/*", "build cache"},
+	{"*/target/debug/*", "build output"},
+	{"*/target/release/*", "build output"},
+	{"*.o", "object file"},
+	{"*.pyc", "Python bytecode"},
+	{"*.class", "Java bytecode"},
+	{"*.tmp", "temporary file"},
+	{"*.temp", "temporary file"},
+	{"*/core", "core dump"},
+	{"*/core.[0-9]*", "core dump"},
+	{"*.core", "core dump"},
+	{"*.swp", "editor swap file"},
+	{"*.swo", "editor swap file"},
+	{"*~", "editor backup"},
+	{"*/.#*", "editor lock file"},
+	{"*/.DS_Store", "Finder metadata"},
+	{"*/Thumbs.db", "thumbnail cache"},
+}
+
+func allJunkPatterns() []junkPattern {
+	return append(append([]junkPattern(nil), junkPatterns...), getConfig().Junk...)
+}
+
+// getJunkTotals totals the latest samples of the files in dirid matching
+// each junk pattern, and all of them together, without counting files
+// matching more than one pattern twice.
+func (fdb *fileDB) getJunkTotals(dirid int64, n int, o reportOptions) (totals []totalEnt, all totalEnt) {
+	patterns := allJunkPatterns()
+	globs := make([]string, len(patterns))
+	why := make(map[string]string)
+	for i, p := range patterns {
+		globs[i] = p.Glob
+		why[p.Glob] = p.Why
+	}
+	globsJSON, err := json.Marshal(globs)
+	fatal(err)
+
+	const latest = `
+			sample.sampletime =	(
+				select max(sampletime) from sample where file.fileid=sample.fileid and invalid is null
+				)`
+	rows, err := fdb.ro.Query(
+		`select pattern.value, sum(size), count(*) from filepaths as file, sample, json_each(?) as pattern
+		where file.fileid=sample.fileid and
+			file.dirid = ?`+nameFilter+` and file.path GLOB pattern.value and`+latest+`
+		group by pattern.value`, append([]interface{}{string(globsJSON)}, o.filterArgs(dirid)...)...)
+	fatal(err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var t totalEnt
+		fatal(rows.Scan(&t.name, &t.size, &t.files))
+		t.name = fmt.Sprintf("%s (%s)", t.name, why[t.name])
+		totals = append(totals, t)
+	}
+	fatal(rows.Err())
+
+	all.name = "all junk"
+	err = fdb.ro.QueryRow(
+		`select coalesce(sum(size), 0), count(*) from filepaths as file, sample
+		where file.fileid=sample.fileid and
+			file.dirid = ?`+nameFilter+` and
+			exists (select 1 from json_each(?) as pattern where file.path GLOB pattern.value) and`+latest,
+		o.filterArgs(dirid, string(globsJSON))...).Scan(&all.size, &all.files)
+	fatal(err)
+
+	return sortTotals(totals, n, o), all
+}
+
+// printJunk prints the -junk report.
+func printJunk(dirid int64) {
+	totals, all := cache.getJunkTotals(dirid, listSize, opts)
+	printTotals(fmt.Sprintf("LIKELY JUNK: %sB IN %d FILES", niceSize(all.size), all.files), totals, false)
+}
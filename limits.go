@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// A directory can have a soft limit on how much it holds, for filesystems
+// without quotas of their own.  After every scan, directories over their
+// limit are reported, and alert rules with "limit" set fire for them.
+
+func init() {
+	addCommand(&command{
+		name:     "limit",
+		synopsis: "[<dir> [size | none]]",
+		help:     "Show or set the soft limit on how much dir holds, such as 500G.  Without a dir, list every directory with a limit, how much it holds and how fast it's growing.",
+		run:      runLimit,
+	})
+}
+
+// dirLimits adds the column holding each directory's soft limit, in
+// bytes.
+func dirLimits(tx *sql.Tx) {
+	addColumn(tx, "dir", "softlimit", "integer")
+}
+
+func runLimit(args []string) {
+	fs := commandFlags("limit")
+	parseFlags(fs, args)
+	if fs.NArg() > 2 {
+		badUsage(fs)
+	}
+	if fs.NArg() == 0 {
+		printLimits()
+		return
+	}
+	dirid, _ := cache.findDir(fs.Arg(0))
+
+	switch fs.Arg(1) {
+	case "":
+		if l := cache.softLimit(dirid); l > 0 {
+			fmt.Fprintln(stdout, strings.TrimSpace(niceSize(l))+"B")
+		} else {
+			fmt.Fprintln(stdout, "none")
+		}
+	case "none":
+		cache.setSoftLimit(dirid, 0)
+	default:
+		var size byteSize
+		if err := size.Set(fs.Arg(1)); err != nil {
+			usagef("%v", err)
+		}
+		cache.setSoftLimit(dirid, int64(size))
+	}
+}
+
+func (fdb *fileDB) softLimit(dirid int64) int64 {
+	var limit sql.NullInt64
+	fatal(fdb.db.QueryRow("SELECT softlimit FROM dir WHERE dirid = ?", dirid).Scan(&limit))
+	return limit.Int64
+}
+
+func (fdb *fileDB) setSoftLimit(dirid, limit int64) {
+	var value interface{}
+	if limit > 0 {
+		value = limit
+	}
+	_, err := fdb.db.Exec("UPDATE dir SET softlimit = ? WHERE dirid = ?", value, dirid)
+	fatal(err)
+}
+
+type limitEnt struct {
+	root  string
+	limit int64
+	used  int64
+	// rate is how fast the directory is growing, in bytes a second.
+	rate float64
+}
+
+func (l *limitEnt) over() bool {
+	return l.used > l.limit
+}
+
+// message describes how l stands against its limit.
+func (l *limitEnt) message() string {
+	size := func(n int64) string { return strings.TrimSpace(niceSize(n)) + "B" }
+	var s string
+	if l.over() {
+		s = fmt.Sprintf("%s holds %s, %s over its %s limit", l.root, size(l.used), size(l.used-l.limit), size(l.limit))
+	} else {
+		s = fmt.Sprintf("%s holds %s, %.0f%% of its %s limit", l.root, size(l.used), percent(l.used, l.limit), size(l.limit))
+	}
+	if l.rate > 0 {
+		perDay := l.rate * secondsPerDay
+		s += fmt.Sprintf(", growing %sB/day", strings.TrimSpace(niceSizef(perDay)))
+		if !l.over() {
+			s += fmt.Sprintf(", full in %.0f days", float64(l.limit-l.used)/perDay)
+		}
+	}
+	return s
+}
+
+// getLimit returns how dirid stands against its limit as of its last
+// scan, or nil if it has no limit or hasn't been scanned.
+func (fdb *fileDB) getLimit(dirid int64) *limitEnt {
+	l := &limitEnt{root: fdb.getDirPath(dirid), limit: fdb.softLimit(dirid)}
+	if l.limit <= 0 {
+		return nil
+	}
+	err := fdb.ro.QueryRow(
+		`select bytes from scan where dirid = ? and finished is not null
+		order by started desc limit 1`, dirid).Scan(&l.used)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	fatal(err)
+
+	o := reportOptions{NoCache: true}
+	err = fdb.ro.QueryRow(`select coalesce(sum(rate), 0) from (`+o.reportQuery()+`)`,
+		o.reportArgs(dirid)...).Scan(&l.rate)
+	fatal(err)
+	return l
+}
+
+// printLimits lists every directory with a limit, those over it first.
+func printLimits() {
+	var over, under []*limitEnt
+	for _, dirid := range cache.allDirIDs() {
+		if l := cache.getLimit(dirid); l == nil {
+			continue
+		} else if l.over() {
+			over = append(over, l)
+		} else {
+			under = append(under, l)
+		}
+	}
+	for _, l := range over {
+		fmt.Fprintln(stdout, "OVER LIMIT", l.message())
+	}
+	for _, l := range under {
+		fmt.Fprintln(stdout, l.message())
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// symlinks adds where each symlink recorded with -symlinks leads, and
+// whether it led nowhere as of each sample, which is NULL for files.
+func symlinks(tx *sql.Tx) {
+	addColumn(tx, "file", "linktarget", "text")
+	addColumn(tx, "sample", "broken", "integer")
+}
+
+type brokenLinkEnt struct {
+	path, target string
+	samples      int64
+	since        time.Time
+}
+
+// getBrokenLinks lists the symlinks in dirid broken as of their latest
+// sample, with how many samples in a row have found them broken and since
+// when.
+func (fdb *fileDB) getBrokenLinks(dirid int64) (result []brokenLinkEnt) {
+	rows, err := fdb.ro.Query(
+		`SELECT path, coalesce(linktarget, ''), count(*), min(s.sampletime)
+		FROM filepaths AS file, sample AS s
+		WHERE file.dirid = ? AND s.fileid = file.fileid AND s.broken AND
+			(SELECT broken FROM sample WHERE fileid = file.fileid ORDER BY sampletime DESC LIMIT 1) AND
+			s.sampletime > coalesce((SELECT max(sampletime) FROM sample
+				WHERE fileid = file.fileid AND NOT broken), 0)
+		GROUP BY file.fileid
+		ORDER BY path`, dirid)
+	fatal(err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var b brokenLinkEnt
+		var since int64
+		fatal(rows.Scan(&b.path, &b.target, &b.samples, &since))
+		b.since = time.Unix(since, 0)
+		result = append(result, b)
+	}
+	fatal(rows.Err())
+	return
+}
+
+// printBrokenLinks prints the -broken-links report.
+func printBrokenLinks(dirid int64) {
+	printTitle("BROKEN SYMLINKS")
+	t := newTableWriter()
+	for _, b := range cache.getBrokenLinks(dirid) {
+		t.File(b.path, fmt.Sprintf("%d scans\tsince %s\t%s -> %s", b.samples, b.since.Format("2006-01-02"), b.path, b.target), "")
+	}
+	t.Flush()
+	endReport()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Scans take a lock on their directory in the database, so that two
+// instances of filebase don't interleave their samples and each forget the
+// files the other found.  Locks left by processes that died on this host
+// are taken over.
+
+// errScanLocked is what lockScan fails with when another scan holds the
+// lock, and -wait wasn't given.
+var errScanLocked = errors.New("being scanned")
+
+// lockScan locks dirid for a scan, waiting for another scan of it to
+// finish if -wait was given, and otherwise returning errScanLocked.
+func (fdb *fileDB) lockScan(dirid int64) error {
+	host, err := os.Hostname()
+	fatal(err)
+
+	waiting := false
+	for {
+		res, err := fdb.db.Exec(
+			`INSERT INTO scanlock (dirid, host, pid, started) VALUES (?,?,?,?)
+			ON CONFLICT (dirid) DO NOTHING`,
+			dirid, host, os.Getpid(), time.Now().Unix())
+		fatal(err)
+		if n, err := res.RowsAffected(); err == nil && n == 1 {
+			return nil
+		}
+
+		var holder string
+		var pid, started int64
+		err = fdb.db.QueryRow("SELECT host, pid, started FROM scanlock WHERE dirid = ?", dirid).
+			Scan(&holder, &pid, &started)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		fatal(err)
+
+		if holder == host && !processAlive(int(pid)) {
+			_, err = fdb.db.Exec("DELETE FROM scanlock WHERE dirid = ? AND host = ? AND pid = ?", dirid, holder, pid)
+			fatal(err)
+			continue
+		}
+
+		err = fmt.Errorf("%s is %w by process %d on %s, since %s",
+			fdb.getDirPath(dirid), errScanLocked, pid, holder, time.Unix(started, 0).Format("2006-01-02 15:04:05"))
+		if !waitLock {
+			return err
+		}
+		if !waiting {
+			fmt.Fprintf(os.Stderr, "%v.  Waiting...\n", err)
+			waiting = true
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// unlockScan releases the lock taken by lockScan.
+func (fdb *fileDB) unlockScan(dirid int64) {
+	host, err := os.Hostname()
+	fatal(err)
+	_, err = fdb.db.Exec("DELETE FROM scanlock WHERE dirid = ? AND host = ? AND pid = ?", dirid, host, os.Getpid())
+	fatal(err)
+}
+
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
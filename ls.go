@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "ls",
+		synopsis: "[-at time] <dir>",
+		help:     "List every recorded file under dir as it was at a time, from its samples.  Files since deleted aren't remembered.",
+		run:      runLs,
+		readOnly: true,
+	})
+}
+
+func runLs(args []string) {
+	fs := commandFlags("ls")
+	at := fs.String("at", "", "When to list the files as of: a date, a date and time, or an age such as 7d.  (default now)")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	when := time.Now()
+	if *at != "" {
+		var err error
+		if when, err = parseTime(*at); err != nil {
+			usagef("%v", err)
+		}
+	}
+
+	dirid, path := cache.findDir(fs.Arg(0))
+	w := newFileWriter()
+	for _, f := range cache.filesAt(dirid, path, when) {
+		w.Write(&f)
+	}
+	w.Flush()
+}
+
+// timeLayouts are the ways times can be given on the command line.
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// parseTime parses a time in one of timeLayouts, in local time, or an age
+// for parseAge, meaning that long ago.
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if age, err := parseAge(s); err == nil {
+		return time.Now().Add(-age), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// filesAt returns the last sample before when of each file below path
+// that had been seen by then.
+func (fdb *fileDB) filesAt(dirid int64, path string, when time.Time) []fileEnt {
+	args := append([]interface{}{dirid}, underPathArgs(path)...)
+	args = append(args, when.Unix())
+	rows, err := fdb.ro.Query(
+		`select path, sampletime, mode, size, mtime from filepaths as file, sample
+		where file.fileid=sample.fileid and
+			file.dirid = ? and `+underPath+` and
+			sample.sampletime =	(
+				select max(sampletime) from sample
+				where file.fileid=sample.fileid and invalid is null and sampletime <= ?
+				)
+		order by path`, args...)
+	fatal(err)
+	defer rows.Close()
+
+	var result []fileEnt
+	for rows.Next() {
+		var f fileEnt
+		f.Scan(rows)
+		result = append(result, f)
+	}
+	fatal(rows.Err())
+	return result
+}
@@ -2,12 +2,17 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/user"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,22 +22,32 @@ import (
 )
 
 const (
-	dbFile        = ".filebase.sqlite3"
-	filesPerBatch = 1024
+	dbFile     = ".filebase.sqlite3"
+	configFile = ".filebase.json"
 )
 
+// schema is the database as of the first versioned migration.
 const schema = `
-PRAGMA foreign_keys = ON;
-
 CREATE TABLE IF NOT EXISTS dir (
 		dirid integer PRIMARY KEY,
-		dirpath text
+		dirpath text,
+		origpath text,
+		fsuuid text,
+		relpath text,
+		host text,
+		device integer
 );
 
 CREATE TABLE IF NOT EXISTS file (
         fileid integer PRIMARY KEY,
         dirid integer,
         path text,
+        mimetype text,
+        uid integer,
+        hash text,
+        hashsize integer,
+        hashmtime integer,
+        lastscan integer,
         FOREIGN KEY (dirid) REFERENCES dir(dirid) ON UPDATE RESTRICT ON DELETE CASCADE
 );
 CREATE UNIQUE INDEX IF NOT EXISTS filediridpath ON file(dirid, path);
@@ -43,224 +58,1062 @@ CREATE TABLE IF NOT EXISTS sample (
         mode integer,
         size integer,
         mtime integer,
+        source text NOT NULL DEFAULT 'scan',
+        invalid text,
         PRIMARY KEY (fileid, sampletime),
         FOREIGN KEY (fileid) REFERENCES file(fileid) ON UPDATE RESTRICT ON DELETE CASCADE
 );
 CREATE INDEX IF NOT EXISTS samplesize ON sample(size);
 CREATE INDEX IF NOT EXISTS samplemtime ON sample(mtime);
 
-create view IF NOT EXISTS times as
+CREATE TABLE IF NOT EXISTS namedquery (
+        name text PRIMARY KEY,
+        query text
+);
+
+CREATE TABLE IF NOT EXISTS reportcache (
+        key text PRIMARY KEY,
+        result blob
+);
+
+CREATE TABLE IF NOT EXISTS scan (
+        dirid integer,
+        started integer,
+        finished integer,
+        duration real,
+        files integer,
+        bytes integer,
+        added integer,
+        removed integer,
+        changed integer,
+        errors integer,
+        PRIMARY KEY (dirid, started),
+        FOREIGN KEY (dirid) REFERENCES dir(dirid) ON UPDATE RESTRICT ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS walkerror (
+        dirid integer,
+        scanid integer,
+        path text,
+        message text,
+        sampletime integer,
+        FOREIGN KEY (dirid) REFERENCES dir(dirid) ON UPDATE RESTRICT ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS walkerrorscan ON walkerror(scanid);
+
+CREATE TABLE IF NOT EXISTS emptydir (
+        dirid integer,
+        scanid integer,
+        path text,
+        FOREIGN KEY (dirid) REFERENCES dir(dirid) ON UPDATE RESTRICT ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS emptydirscan ON emptydir(scanid);
+
+CREATE TABLE IF NOT EXISTS dircount (
+        dirid integer,
+        scanid integer,
+        path text,
+        files integer,
+        FOREIGN KEY (dirid) REFERENCES dir(dirid) ON UPDATE RESTRICT ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS dircountscan ON dircount(scanid);
+CREATE INDEX IF NOT EXISTS dircountpath ON dircount(dirid, path);
+
+CREATE TABLE IF NOT EXISTS fscapacity (
+        dirid integer,
+        scanid integer,
+        total integer,
+        free integer,
+        inodes integer,
+        freeinodes integer,
+        FOREIGN KEY (dirid) REFERENCES dir(dirid) ON UPDATE RESTRICT ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS fscapacityscan ON fscapacity(scanid);
+
+CREATE TABLE IF NOT EXISTS scanlock (
+        dirid integer PRIMARY KEY,
+        host text,
+        pid integer,
+        started integer
+);
+
+CREATE TABLE IF NOT EXISTS clockoffset (
+        host text,
+        sampletime integer,
+        offset integer,
+        PRIMARY KEY (host, sampletime)
+);
+`
+
+// views are recreated every time the database is opened, after any
+// columns they use have been added to older databases.
+const views = `
+DROP VIEW IF EXISTS rates;
+DROP VIEW IF EXISTS times;
+DROP VIEW IF EXISTS filepaths;
+
+create view times as
     SELECT file.dirid, sample.fileid, sampletime, mode, size, mtime, max(sampletime) as maxtime, min(sampletime) as mintime
     from sample, file, dir
-    where file.fileid == sample.fileid and file.dirid = dir.dirid
+    where file.fileid == sample.fileid and file.dirid = dir.dirid and sample.invalid is null
     group by sample.fileid;
 
-create view IF NOT EXISTS rates AS
+-- filepaths puts the full paths of files back together, for queries.
+create view filepaths as
+    SELECT file.*, rtrim(rtrim(dir.dirpath, '/') || '/' || dirtree.path, '/') || '/' || file.name as path
+    from file, dirtree, dir
+    where file.treeid = dirtree.treeid and dirtree.dirid = dir.dirid;
+
+create view rates AS
     SELECT *,
       ((select size from sample WHERE sampletime = maxtime and sample.fileid = times.fileid)-
        (select size from sample WHERE sampletime = mintime and sample.fileid = times.fileid)) / 
       cast(maxtime-mintime AS real) as rate
     from times;
-
-CREATE TEMPORARY TABLE found (fileid integer PRIMARY KEY );
 `
 
 var (
 	cache         *fileDB
 	defaultDBPath string
 	dbPath        string
-
-	noScan    bool
-	doBiggest bool
-	doOldest  bool
-	doNewest  bool
-	doFastest bool
-	listSize  int
+	configPath    string
+
+	noScan        bool
+	doBiggest     bool
+	doOldest      bool
+	doNewest      bool
+	doFastest     bool
+	allDirs       bool
+	doDirs        bool
+	doTypes       bool
+	doUnreadable  bool
+	doBroken      bool
+	doJunk        bool
+	doCategories  bool
+	doEmpty       bool
+	doCounts      bool
+	doChurn       bool
+	doCapacity    bool
+	doMime        bool
+	doHash        bool
+	hashWorkers   = runtime.NumCPU()
+	opts          reportOptions
+	listSize      int
+	listAll       bool
+	sortKey       *reportSort
+	columns       []*fileColumn
+	outputFormat  = "text"
+	outputPath    string
+	mailTo        string
+	precision     = 2
+	units         = "si"
+	showBytes     bool
+	rebind        bool
+	noColor       bool
+	scanPseudo    bool
+	scanHidden    string
+	scanSnapshots string
+	recordAtime   bool
+	recordDisk    bool
+	recordShared  bool
+	statusAddr    string
+	recordLinks   bool
+	filesPerBatch = 8192
+	syncMode      = "normal"
+	waitLock      bool
+	dryRunScan    bool
+	manifestPath  string
+	previewScan   bool
+	assumeYes     bool
+	anchorRoots   bool
+	minTotal      byteSize
+	minFiles      int64
+	failBigger    byteSize
+	failRate      byteRate
+	localHost     string
+	hostFilter    string
+	forceScan     bool
+
+	// With -sample, scans walk only part of each directory.  See
+	// scanSample.
+	sampleFraction float64
+	sampleDepth    int
+
+	// Scans go no faster than these, if given.
+	throttleFiles int64
+	throttleBytes byteSize
+	throttleSleep time.Duration
+	niceScan      bool
 )
 
+// exitThreshold is the exit status when a file crosses -fail-if-bigger or
+// -fail-if-rate.
+const exitThreshold = 3
+
 func main() {
+	if err := run(); err != nil {
+		status, advice := explain(err)
+		var quiet exitStatus
+		if !errors.As(err, &quiet) {
+			fmt.Fprintf(os.Stderr, "filebase: %v\n", err)
+		}
+		if advice != "" {
+			fmt.Fprintln(os.Stderr, advice)
+		}
+		os.Exit(status)
+	}
+}
+
+// run does all that main does, returning what went wrong rather than
+// panicking.
+func run() (err error) {
+	defer catch(&err, "")
+
 	usr, err := user.Current()
 	fatal(err)
 	defaultDBPath = filepath.Join(usr.HomeDir, dbFile)
+	localHost, err = os.Hostname()
+	fatal(err)
 
-	flag.StringVar(&dbPath, "db", defaultDBPath, "Path to database file.")
+	flag.StringVar(&dbPath, "db", defaultDBPath, "Path to database file, or the http or https URL of one to report on.")
+	profileName := flag.String("profile", "", "Use the database, directories and excludes of this profile in the configuration file.")
+	flag.StringVar(&configPath, "config", filepath.Join(usr.HomeDir, configFile), "Path to configuration file.")
 	flag.BoolVar(&doBiggest, "biggest", false, "Search for biggest files.")
 	flag.BoolVar(&doFastest, "fastest", false, "Search for fastest growing files.")
+	flag.BoolVar(&allDirs, "all-dirs", false, "Rank the files of every recorded directory together for -biggest, -fastest, -oldest and -newest, in one list with a dir column.")
 	flag.BoolVar(&doOldest, "oldest", false, "Search for oldest files.")
 	flag.BoolVar(&doNewest, "newest", false, "Search for newest files.")
+	flag.BoolVar(&doDirs, "dirs", false, "Search for biggest directories, including their subdirectories.")
+	flag.BoolVar(&doTypes, "types", false, "Total up files by content type (see -mime).")
+	flag.BoolVar(&doChurn, "churn", false, "Search for the files changed most often from one scan to the next.")
+	flag.BoolVar(&doCounts, "counts", false, "Search for directories holding the most files, and how fast that's changing.")
+	flag.BoolVar(&doEmpty, "empty", false, "List empty directories, and files that have always been empty.")
+	flag.BoolVar(&doJunk, "junk", false, "Total up likely junk, such as caches, temporary files and core dumps.")
+	flag.BoolVar(&doCategories, "categories", false, "Total up the size and growth of files by category, such as media, builds, databases and backups, by rules in the configuration file and built in.")
+	flag.BoolVar(&doCapacity, "capacity", false, "Show the size and free space of the filesystem, and when the directory's growth will fill it.")
+	flag.BoolVar(&doUnreadable, "unreadable", false, "List directories the last scan was refused permission to read.")
+	flag.BoolVar(&doBroken, "broken-links", false, "List symlinks whose targets were missing at the last scan, and since when (see -symlinks).")
+	flag.BoolVar(&doMime, "mime", false, "Sniff file contents during the scan to record their content type.")
+	flag.BoolVar(&doHash, "hash", false, "Hash the contents of new and changed files during the scan.")
+	flag.IntVar(&hashWorkers, "hash-workers", hashWorkers, "How many files to hash at once with -hash.")
+	flag.Func("rate-sources", "Comma separated sample sources (scan,watch,import,agent,snapshot) to trust for growth rates.", func(s string) (err error) {
+		opts.Sources, err = parseSources(s)
+		return err
+	})
+	flag.Var((*stringList)(&opts.Matches), "match", "Only report on files whose full path matches this glob. May be repeated.")
+	flag.Var((*stringList)(&opts.Excludes), "exclude", "Don't report on files whose full path matches this glob. May be repeated.")
+	flag.Var((*stringList)(&opts.Tags), "tag", "Only report on files with this tag, or under a directory with it (see the tag command). May be repeated.")
+	flag.Var((*stringList)(&opts.ExcludeTags), "exclude-tag", "Don't report on files with this tag, or under a directory with it. May be repeated.")
+	flag.Func("hidden", "Leave out (skip) dotfiles and everything in dot-directories from reports, or report on nothing else (only).", func(s string) (err error) {
+		opts.Hidden, err = parseHidden(s)
+		return err
+	})
+	flag.Func("owner", "Only report on files owned by this user. May be repeated.", func(s string) error {
+		uid, err := lookupOwner(s)
+		if err != nil {
+			return err
+		}
+		opts.Owners = append(opts.Owners, uid)
+		return nil
+	})
+	flag.Var(&minTotal, "min-total", "Hide directories smaller than this many bytes (e.g. 1G).")
+	flag.Int64Var(&minFiles, "min-files", 0, "Hide directories containing fewer than this many files.")
+	flag.Var(&failBigger, "fail-if-bigger", "Exit with status 3 if any file is bigger than this (e.g. 10G).")
+	flag.Var(&failRate, "fail-if-rate", "Exit with status 3 if any file grows faster than this (e.g. 1G/day).")
+	flag.StringVar(&hostFilter, "host", "", "Only report on directories scanned on this host.  Other hosts' directories can't be scanned from here, so need -noscan.")
+	flag.BoolVar(&rebind, "rebind", false, "Move the history of directories whose symlinks now lead elsewhere to the new path.")
+	flag.BoolVar(&anchorRoots, "anchor", false, "Also recognize directories by filesystem UUID, so they're found again when mounted elsewhere.")
+	flag.Func("window", "Compute growth rates over only the samples this recent, such as 7d.", func(s string) (err error) {
+		opts.Window, err = parseAge(s)
+		return err
+	})
+	flag.Func("rate-mode", "How to compute growth rates: endpoints, from the first and last samples, or regression, fitting a line through them all. (default endpoints)", func(s string) (err error) {
+		opts.RateMode, err = parseRateMode(s)
+		return err
+	})
+	flag.BoolVar(&opts.NoCache, "nocache", false, "Don't reuse report results saved since the database last changed.")
+	flag.Func("scan-hidden", "Leave out (skip) dotfiles and dot-directories when scanning, or scan nothing else (only).  Files left out are then recorded as vanished.", func(s string) (err error) {
+		scanHidden, err = parseHidden(s)
+		return err
+	})
+	flag.Func("snapshots", "Leave out (skip) filesystem snapshots, such as .zfs/snapshot, .snapshot and btrfs snapshot subvolumes, when scanning, or record their files with the sample source snapshot (mark), for -rate-sources.", func(s string) (err error) {
+		scanSnapshots, err = parseSnapshots(s)
+		return err
+	})
+	flag.BoolVar(&recordAtime, "atime", false, "Record when files were last read (their atime) in each sample, for the unread command.")
+	flag.BoolVar(&recordDisk, "disk-usage", false, "Record the space each file takes on disk, after compression, in each sample, for -on-disk.")
+	flag.BoolVar(&recordShared, "reflinks", false, "Record how much of each file is in extents shared with other files, such as reflinked copies and snapshots, on Linux filesystems that can say, for the savings command.")
+	flag.BoolVar(&opts.OnDisk, "on-disk", false, "Rank and total files by the space they take on disk, where -disk-usage recorded it, rather than by their size.")
+	flag.BoolVar(&recordLinks, "symlinks", false, "Also record symlinks and where they lead, for -broken-links.  Those scanned without it are then recorded as vanished.")
+	flag.BoolVar(&scanPseudo, "pseudo", false, "Also scan pseudo filesystems, such as /proc and /sys, inside the directories given.")
+	flag.Float64Var(&sampleFraction, "sample", 0, "Walk only this fraction of the subdirectories -sample-depth levels down, such as 0.01, the same ones each time, and estimate the totals from them.")
+	flag.IntVar(&sampleDepth, "sample-depth", 2, "How many levels below each directory -sample picks subdirectories.")
+	flag.Int64Var(&throttleFiles, "throttle-files", 0, "Scan no more than this many files a second.")
+	flag.Var(&throttleBytes, "throttle-bytes", "Read no more than this many bytes a second for -hash, such as 10M.")
+	flag.DurationVar(&throttleSleep, "throttle-sleep", 0, "Pause this long after each batch of files recorded, such as 100ms.")
+	flag.BoolVar(&niceScan, "nice", false, "Run at the lowest CPU and, on Linux, I/O priority, so as not to slow anything else down.")
+	flag.IntVar(&filesPerBatch, "batch", filesPerBatch, "How many files a scan records in each transaction.")
+	flag.Func("synchronous", "How carefully each transaction is written to disk: off, normal, full or extra, as SQLite's synchronous pragma.  With the database in WAL mode, normal can lose the last transactions in a power failure, but never corrupts it. (default "+syncMode+")", func(s string) error {
+		switch s {
+		case "off", "normal", "full", "extra":
+			syncMode = s
+			return nil
+		}
+		return fmt.Errorf("must be off, normal, full or extra")
+	})
+	flag.BoolVar(&waitLock, "wait", false, "If another filebase is scanning the same directory, wait for it to finish instead of giving up.")
+	flag.BoolVar(&dryRunScan, "dry-run", false, "Walk the directories as a scan would and say what would be recorded, without touching the database.")
+	flag.StringVar(&manifestPath, "manifest", "", "After each scan, write how the scans went, their counts, totals, durations and errors, to this file as JSON.")
+	flag.BoolVar(&previewScan, "preview", false, "Before scanning each directory, walk it and show the files the scan would record as new, changed and vanished, and ask whether to go ahead.")
+	flag.BoolVar(&assumeYes, "yes", false, "With -preview, scan without asking.")
+	flag.BoolVar(&forceScan, "force", false, "Scan directories even if they were scanned more recently than their interval (see the interval command).")
 	flag.BoolVar(&noScan, "noscan", false, "Don't rescan.  Just use the existing database.")
 	flag.IntVar(&listSize, "list", 25, "How many files to list.")
+	flag.Func("sort", "Sort listed files by size, mtime, rate, path or samples, optionally followed by :asc or :desc.", func(s string) (err error) {
+		sortKey, err = parseSort(s)
+		return err
+	})
+	flag.IntVar(&opts.Offset, "offset", 0, "Skip this many files at the top of each list.")
+	flag.BoolVar(&listAll, "all", false, "List every file, instead of the number given by -list.")
+	flag.Func("format", "Output format for query results and reports: text, csv, json, html, markdown, or paths, just the path of each file listed, a line each. (default text)", setOutputFormat)
+	print0 := flag.Bool("print0", false, "List just the path of each file, each ended by a NUL rather than a newline, for xargs -0.  Short for -format paths0.")
+	flag.StringVar(&outputPath, "o", "", "Write reports to this file instead of stdout.")
+	flag.StringVar(&statusAddr, "status", "", "Serve the progress of the scan in progress as JSON at /status on this unix socket, or TCP address such as localhost:9133.")
+	flag.StringVar(&mailTo, "email-to", "", "Mail the reports to these comma separated addresses, as text and HTML, through the smtp server in the configuration file, instead of printing them.")
+	eventFormat := flag.String("events", "", "Write an event as scans see, add or find changed each file, find one vanished or hit an error: ndjson, a JSON object a line.")
+	eventsTo := flag.String("events-to", "", "Send -events to this unix socket or TCP host:port instead of stdout.")
+	flag.Func("columns", "Comma separated columns to list files with: path, size, bytes, mtime, mode, rate, samples, sampled, dir, note.", func(s string) (err error) {
+		columns, err = parseColumns(s)
+		return err
+	})
+	flag.BoolVar(&noColor, "no-color", false, "Don't color output on a terminal.")
+	flag.Func("units", "Show sizes in si (1k = 1000), iec (1Ki = 1024) or raw bytes. (default si)", setUnits)
+	flag.IntVar(&precision, "precision", precision, "Decimal places shown in sizes and rates.")
+	flag.BoolVar(&showBytes, "bytes", false, "Also show exact sizes in bytes.")
+	flag.StringVar(&thousandsMark, "thousands", thousandsMark, "Group the digits of sizes and rates in thousands with this, such as , or _.")
+	flag.StringVar(&decimalMark, "decimal", decimalMark, "The decimal mark in sizes and rates.")
+	flag.Func("locale", "Set -thousands and -decimal as in this locale, such as de_DE, or auto for the one in $LC_ALL, $LC_NUMERIC or $LANG.", setLocale)
+	flag.BoolVar(&fixedWidth, "fixed-width", false, "Pad sizes and rates to the same width, so they line up on the right.")
+	flag.BoolVar(&opts.Ties, "include-ties", false, "Also list files tied with the last one listed.")
+	flag.Usage = usage
 	flag.Parse()
+	if outputPath != "" {
+		f, err := os.Create(outputPath)
+		fatal(err)
+		defer f.Close()
+		stdout = f
+	}
+	terminal = outputPath == "" && isTerminal(os.Stdout)
+	colorize = terminal && !noColor && os.Getenv("NO_COLOR") == ""
+	if niceScan {
+		lowerPriority()
+	}
+	events = openEvents(*eventFormat, *eventsTo)
+	defer events.close()
+	defer func() { tsdb.flush() }()
+	if listAll {
+		listSize = -1
+	}
+	if *print0 {
+		outputFormat = "paths0"
+	}
+	if filesPerBatch < 1 {
+		usagef("-batch must be at least 1")
+	}
+	if sampleFraction < 0 || sampleFraction > 1 || sampleDepth < 1 {
+		usagef("-sample must be between 0 and 1, and -sample-depth at least 1")
+	}
 
-	cache = newFileDB(dbPath)
-	defer cache.close()
+	dirs := flag.Args()
+	if *profileName != "" {
+		profileDirs := applyProfile(*profileName)
+		if len(dirs) == 0 {
+			dirs = profileDirs
+		}
+	}
 
-	for _, dir := range flag.Args() {
-		dirid := cache.getDirID(dir)
+	cmd := commands[flag.Arg(0)]
+	if cmd == nil && dryRunScan {
+		for _, dir := range dirs {
+			dryRun(dir)
+		}
+		return nil
+	}
+	if mailTo != "" && cmd != nil {
+		usagef("-email-to mails the reports chosen by flags, such as -biggest, not those of commands")
+	}
 
-		if !noScan {
-			cache.scanDir(dirid)
+	if isRemoteDB(dbPath) {
+		if (cmd == nil && (!noScan || rebind)) || (cmd != nil && !cmd.readOnly && !cmd.noDB) {
+			usagef("a database fetched over HTTP can only be reported on.  Use -noscan, or a read-only command.")
+		}
+		if dbPath, err = fetchRemoteDB(dbPath); err != nil {
+			return err
+		}
+	}
+	if cmd == nil || !cmd.noDB {
+		if (cmd == nil && noScan && !rebind) || (cmd != nil && cmd.readOnly) {
+			cache, err = openReadOnlyDB(dbPath)
+		} else {
+			cache, err = newFileDB(dbPath)
 		}
+		if err != nil {
+			return err
+		}
+		defer cache.close()
+	}
+	if statusAddr != "" {
+		l, err := listenStatus(statusAddr)
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+	}
 
-		if doBiggest {
-			fmt.Println("*** BIGGEST FILES ***")
-			bigFiles := cache.getBiggest(dirid, listSize)
-			for _, bigFile := range bigFiles {
-				fmt.Println(bigFile.String())
-			}
-			fmt.Println()
+	if outputFormat == "html" && mailTo == "" {
+		startHTML()
+		defer endHTML()
+	}
+	if cmd != nil {
+		cmd.run(flag.Args()[1:])
+		return nil
+	}
+
+	remote := hostFilter != "" && hostFilter != localHost
+	if remote && !noScan {
+		usagef("directories on %s can't be scanned from %s.  Use -noscan to report on them.", hostFilter, localHost)
+	}
+
+	crossed := false
+	var dirids []int64
+	for _, dir := range dirs {
+		var dirid int64
+		if remote || cache.readOnly {
+			dirid, _ = cache.findDir(dir)
+		} else {
+			dirid = cache.getDirID(dir)
 		}
 
-		if doOldest {
-			fmt.Println("*** OLDEST FILES ***")
-			oldFiles := cache.getOldest(dirid, listSize)
-			for _, oldFile := range oldFiles {
-				fmt.Println(oldFile.String())
+		if !noScan {
+			if last, recent := cache.scannedRecently(dirid); recent && !forceScan {
+				fmt.Fprintf(stdout, "%s: not rescanning, last scanned %s ago.  Use -force to scan anyway.\n",
+					cache.getDirPath(dirid), time.Since(last).Round(time.Second))
+			} else if previewScan && !cache.confirmScan(dirid) {
+				// Report on what was recorded before, as if -noscan.
+			} else {
+				if err = cache.scanDir(dirid); err != nil {
+					return err
+				}
+				if err = cache.checkAlerts(dirid); err != nil {
+					return err
+				}
 			}
-			fmt.Println()
 		}
 
-		if doNewest {
-			fmt.Println("*** NEWEST FILES ***")
-			newFiles := cache.getNewest(dirid, listSize)
-			for _, newFile := range newFiles {
-				fmt.Println(newFile.String())
-			}
-			fmt.Println()
+		dirids = append(dirids, dirid)
+		if mailTo == "" {
+			printReports(dirid)
 		}
 
-		if doFastest {
-			fmt.Println("*** FASTEST GROWING FILES ***")
-			newFiles := cache.getFastest(dirid, listSize)
-			for _, fastFile := range newFiles {
-				fmt.Println(fastFile.String())
-			}
-			fmt.Println()
+		if cache.checkThresholds(dirid, opts) {
+			crossed = true
+		}
+	}
+
+	if mailTo != "" {
+		if err = mailReports(mailTo, dirids); err != nil {
+			return err
 		}
+	} else if allDirs {
+		printAllDirs()
 	}
 
+	if crossed {
+		return exitStatus(exitThreshold)
+	}
+	return nil
 }
 
-func (fdb *fileDB) scanDir(dirid int64) {
-	err := fdb.getFiles(dirid)
+// printReports prints the reports chosen by flags on dirid, but those
+// across all directories.
+func printReports(dirid int64) {
+	switch outputFormat {
+	case "html":
+		printHTMLDir(dirid)
+	case "markdown":
+		fmt.Fprintf(stdout, "# %s\n\n", cache.getDirPath(dirid))
+	}
+
+	if doBiggest && !allDirs {
+		printFiles(biggestReport, cache.getReport(dirid, biggestReport, listSize, opts))
+	}
+
+	if doOldest && !allDirs {
+		printFiles(oldestReport, cache.getReport(dirid, oldestReport, listSize, opts))
+	}
+
+	if doNewest && !allDirs {
+		printFiles(newestReport, cache.getReport(dirid, newestReport, listSize, opts))
+	}
+
+	if doFastest && !allDirs {
+		printFiles(fastestReport, cache.getReport(dirid, fastestReport, listSize, opts))
+	}
+
+	if doDirs {
+		printTotals("BIGGEST DIRECTORIES", cache.getDirTotals(dirid, listSize, int64(minTotal), minFiles, opts), true)
+	}
+
+	if doTypes {
+		printTotals("CONTENT TYPES", cache.getTypeTotals(dirid, listSize, opts), false)
+	}
+
+	if doChurn {
+		printChurn(dirid)
+	}
+
+	if doCounts {
+		printDirCounts(dirid)
+	}
+
+	if doJunk {
+		printJunk(dirid)
+	}
+
+	if doCategories {
+		printCategories(dirid)
+	}
+
+	if doEmpty {
+		printEmpty(dirid)
+	}
+
+	if doCapacity {
+		printCapacity(dirid)
+	}
+
+	if doUnreadable {
+		printUnreadable(dirid)
+	}
+
+	if doBroken {
+		printBrokenLinks(dirid)
+	}
+}
+
+// checkThresholds reports the first file in dirid over -fail-if-bigger and
+// the first over -fail-if-rate, if they were given, and tells whether
+// there were any.
+func (fdb *fileDB) checkThresholds(dirid int64, o reportOptions) (crossed bool) {
+	o.Offset = 0
+	o.Ties = false
+	if failBigger > 0 {
+		it := fdb.getReport(dirid, biggestReport, 1, o)
+		if it.Next() && it.File().size > int64(failBigger) {
+			f := it.File()
+			fmt.Fprintf(os.Stderr, "%s is %sB, over %sB\n", f.path, niceSize(f.size), niceSize(int64(failBigger)))
+			crossed = true
+		}
+		it.Close()
+	}
+	if failRate > 0 {
+		it := fdb.getReport(dirid, fastestReport, 1, o)
+		if it.Next() && it.File().rate*secondsPerDay > float64(failRate) {
+			f := it.File()
+			fmt.Fprintf(os.Stderr, "%s grows %sB/day, over %sB/day\n", f.path,
+				niceSizef(f.rate*secondsPerDay), niceSizef(float64(failRate)))
+			crossed = true
+		}
+		it.Close()
+	}
+	return
+}
+
+// scanDir scans dirid and records what it found.  An error reading the
+// root is logged, and the scan abandoned; an error recording anything is
+// returned, after waiting for the samples being inserted, and the lock
+// is released either way.
+func (fdb *fileDB) scanDir(dirid int64) (err error) {
+	defer catch(&err, "scanning "+fdb.getDirPath(dirid))
+
+	// Open the tsdb sink now, so a mistake configuring it stops the scan
+	// before anything is recorded.
+	getTSDB()
+
+	start := time.Now()
+	fdb.insertErr = nil
+	progress.begin(fdb.getDirPath(dirid))
+	defer progress.end()
+	scanid := fdb.beginScan(dirid, start)
+	defer fdb.unlockScan(dirid)
+	defer fdb.wg.Wait()
+
+	sample := newScanSample()
+	errs, err := fdb.getFiles(dirid, scanid, sample)
 	if err != nil {
-		return
+		// Leave everything as it was, rather than forget every file.
+		log.Print(err)
+		if manifestPath != "" {
+			logManifest(&manifestScan{Dir: fdb.getDirPath(dirid), Started: start.Format(time.RFC3339),
+				DurationSeconds: time.Since(start).Seconds(), Failed: err.Error()})
+		}
+		return nil
 	}
+	fdb.wg.Wait()
+	if fdb.insertErr != nil {
+		return fdb.insertErr
+	}
+
+	fdb.recordCapacity(dirid, scanid, fdb.getDirPath(dirid))
+	fdb.finishScan(dirid, scanid, start, errs, sample)
+	if manifestPath != "" {
+		logManifest(fdb.manifestScanned(dirid, scanid))
+	}
+	return nil
+}
+
+// beginScan locks dirid and records the start of a scan of it.  Files are
+// marked with the scan's id as they're seen, so those that weren't can be
+// told apart at the end, without holding anything open that would keep
+// others from reading the database meanwhile.  A scan that never finishes
+// is left without a finish time.
+func (fdb *fileDB) beginScan(dirid int64, start time.Time) (scanid int64) {
+	fatal(fdb.lockScan(dirid))
+	res, err := fdb.db.Exec("INSERT OR REPLACE INTO scan (dirid, started) VALUES (?,?)", dirid, start.Unix())
+	fatal(err)
+	scanid, err = res.LastInsertId()
+	fatal(err)
+	return
+}
+
+// finishScan waits for samples to be inserted, then records and forgets
+// files that weren't found, checks the new samples, records how the scan went, and
+// releases the lock.  sample is what a sampled scan walked, or nil.
+func (fdb *fileDB) finishScan(dirid, scanid int64, start time.Time, errs int, sample *scanSample) {
+	defer fdb.unlockScan(dirid)
 
 	fdb.wg.Wait()
-	_, err = fdb.db.Exec("DELETE FROM file WHERE dirid = ? AND fileid NOT IN (SELECT fileid FROM found)", dirid)
+	if sample != nil {
+		fdb.keepUnsampled(dirid, scanid, sample)
+	}
+	fdb.recordVanished(dirid, scanid)
+	if events != nil {
+		fdb.vanishedEvents(dirid, scanid)
+		events.flush()
+	}
+	fdb.unindexVanished(dirid, scanid)
+	res, err := fdb.db.Exec("DELETE FROM file WHERE dirid = ? AND lastscan IS NOT ?", dirid, scanid)
+	fatal(err)
+	removed, err := res.RowsAffected()
+	fatal(err)
+	fdb.pruneTree(dirid)
+	fdb.indexNew(dirid)
+
+	fdb.validateSamples(dirid, start)
+	fdb.recordScan(dirid, scanid, start, removed, errs)
+	if sample != nil {
+		fdb.recordEstimate(scanid, sample)
+	}
+	fdb.recordDirCounts(dirid, scanid)
+	fdb.recordDBSize(scanid)
+	sink := getTSDB()
+	sink.scanned(fdb, dirid, start)
+	sink.flush()
+	fmt.Fprintln(stdout, fdb.scanSummary(dirid, scanid))
+}
+
+// scanSummary describes a finished scan, compared with the one before.
+func (fdb *fileDB) scanSummary(dirid, scanid int64) string {
+	var started, files, bytes, added, removed, changed, errs int64
+	var duration float64
+	var fraction sql.NullFloat64
+	err := fdb.db.QueryRow(
+		`SELECT started, duration, files, bytes, added, removed, changed, errors, fraction FROM scan WHERE rowid = ?`,
+		scanid).Scan(&started, &duration, &files, &bytes, &added, &removed, &changed, &errs, &fraction)
+	fatal(err)
+
+	delta := ""
+	var prev sql.NullInt64
+	err = fdb.db.QueryRow(
+		`SELECT bytes FROM scan WHERE dirid = ? AND started < ? AND finished IS NOT NULL
+		ORDER BY started DESC LIMIT 1`, dirid, started).Scan(&prev)
+	if err != sql.ErrNoRows {
+		fatal(err)
+	}
+	if prev.Valid {
+		sign := "+"
+		d := bytes - prev.Int64
+		if d < 0 {
+			sign, d = "-", -d
+		}
+		delta = fmt.Sprintf(" (%s%sB)", sign, strings.TrimSpace(niceSize(d)))
+	}
+
+	summary := fmt.Sprintf("%s: %d files, %d new, %d changed, %d vanished, %sB%s in %v",
+		fdb.getDirPath(dirid), files, added, changed-added, removed, strings.TrimSpace(niceSize(bytes)), delta,
+		(time.Duration(duration*1000) * time.Millisecond).Round(time.Millisecond))
+	if errs > 0 {
+		summary += fmt.Sprintf(", %d errors", errs)
+	}
+	if fraction.Valid {
+		summary += fmt.Sprintf(", estimated from a %g%% sample", fraction.Float64*100)
+	}
+	return summary
+}
+
+// recordScan notes how long a scan took, what it found, how many files
+// were new, changed or gone since the scan before, and how many errors
+// there were.
+func (fdb *fileDB) recordScan(dirid, scanid int64, start time.Time, removed int64, errs int) {
+	_, err := fdb.db.Exec(
+		`UPDATE scan SET finished = ?, duration = ?, removed = ?, errors = ?,
+			(files, bytes, added, changed) = (
+			SELECT count(*), coalesce(sum(s.size), 0),
+				coalesce(sum(NOT EXISTS (SELECT 1 FROM sample AS prev
+					WHERE prev.fileid = s.fileid AND prev.sampletime < s.sampletime)), 0),
+				coalesce(sum(
+				(SELECT count(*) = 0 FROM sample AS prev
+					WHERE prev.fileid = s.fileid AND prev.sampletime < s.sampletime AND
+					prev.size = s.size AND prev.mtime = s.mtime AND
+					prev.sampletime = (SELECT max(sampletime) FROM sample
+						WHERE fileid = s.fileid AND sampletime < s.sampletime))), 0)
+			FROM file, sample AS s
+			WHERE file.dirid = ? AND file.lastscan = ? AND s.fileid = file.fileid AND
+				s.sampletime = (SELECT max(sampletime) FROM sample WHERE fileid = file.fileid) AND
+				s.sampletime >= ?)
+		WHERE rowid = ?`,
+		time.Now().Unix(), time.Since(start).Seconds(), removed, errs, dirid, scanid, start.Unix(), scanid)
 	fatal(err)
 }
 
 func canonical(dir string) (canonicalPath string) {
 	canonicalPath, err := filepath.Abs(dir)
-	if err != nil {
-		log.Fatal(err)
-	}
+	fatal(err)
 	canonicalPath, err = filepath.EvalSymlinks(canonicalPath)
-	if err != nil {
-		log.Fatal(err)
-	}
+	fatal(err)
 	return
 }
 
 func (fdb *fileDB) getDirID(dir string) (dirid int64) {
+	origPath, err := filepath.Abs(dir)
+	fatal(err)
 	canonicalPath := canonical(dir)
-	err := fdb.db.QueryRow("SELECT dirid FROM dir WHERE dirpath = ?", canonicalPath).Scan(&dirid)
+
+	uuid, relPath := fdb.anchorDir(dir, origPath, canonicalPath)
+
+	if oldPath, moved := fdb.retargeted(origPath, canonicalPath); moved && rebind {
+		fmt.Fprintf(stdout, "Moving the history of %s from %s to %s\n", dir, oldPath, canonicalPath)
+		fdb.rebindDir(oldPath, canonicalPath, origPath)
+	} else if moved {
+		fatal(fmt.Errorf("%s now leads to %s, but its history is recorded under %s.\n"+
+			"Use -rebind to move its history to the new path, or scan %s by that name to start a new history.",
+			dir, canonicalPath, oldPath, canonicalPath))
+	}
+
+	dirid = fdb.getDirIDFor(localHost, canonicalPath, origPath)
+	fdb.checkDevice(dirid, canonicalPath)
+	if anchorRoots && uuid != "" {
+		_, err = fdb.db.Exec("UPDATE dir SET fsuuid = ?, relpath = ? WHERE dirid = ?", uuid, relPath, dirid)
+		fatal(err)
+	}
+	return
+}
+
+// getDirIDFor registers canonicalPath on host as is, if need be,
+// remembering the path it was originally given as.  Directories recorded
+// before hosts were are claimed by the first host to use them.
+func (fdb *fileDB) getDirIDFor(host, canonicalPath, origPath string) (dirid int64) {
+	err := fdb.db.QueryRow("SELECT dirid FROM dir WHERE dirpath = ? AND "+onHost+" ORDER BY host IS NULL",
+		canonicalPath, host).Scan(&dirid)
 	if err == sql.ErrNoRows {
-		res, err := fdb.db.Exec("INSERT INTO dir (dirpath) VALUES (?)", canonicalPath)
+		res, err := fdb.db.Exec("INSERT INTO dir (dirpath, origpath, host) VALUES (?,?,?)", canonicalPath, origPath, host)
 		fatal(err)
 		dirid, err = res.LastInsertId()
 		fatal(err)
 	} else {
 		fatal(err)
+		_, err = fdb.db.Exec("UPDATE dir SET origpath = coalesce(origpath, ?), host = ? WHERE dirid = ?", origPath, host, dirid)
+		fatal(err)
 	}
 	return
 }
 
+// checkDevice records the device holding a directory being scanned, and
+// warns if it has changed, as when a filesystem that should be mounted
+// there isn't.
+func (fdb *fileDB) checkDevice(dirid int64, path string) {
+	dev, err := fsDevice(path)
+	if err != nil {
+		return
+	}
+	var old sql.NullInt64
+	fatal(fdb.db.QueryRow("SELECT device FROM dir WHERE dirid = ?", dirid).Scan(&old))
+	if old.Valid && old.Int64 != dev {
+		log.Printf("%s is on a different filesystem than when it was last scanned", path)
+	}
+	_, err = fdb.db.Exec("UPDATE dir SET device = ? WHERE dirid = ?", dev, dirid)
+	fatal(err)
+}
+
 func (fdb *fileDB) getDirPath(dirid int64) (canonicalPath string) {
 	err := fdb.db.QueryRow("SELECT dirpath FROM dir WHERE dirid = ?", dirid).Scan(&canonicalPath)
 	fatal(err)
 	return
 }
 
-func (fdb *fileDB) getFiles(dirid int64) (err error) {
-	canonicalPath := fdb.getDirPath(dirid)
+type insertJob struct {
+	now    time.Time
+	i      os.FileInfo
+	p      string
+	mime   string
+	hash   string
+	source string
+	// attrs are from analyzers, if the file was analyzed.
+	attrs map[string]string
+	// target is where a symlink leads, and broken whether nothing is
+	// there.
+	target string
+	broken bool
+	// shared is how much of the file is in shared extents, with
+	// -reflinks, if that's known.
+	shared interface{}
+
+	// err is a walk error to record, instead of a sample.
+	err error
+	// emptyDir marks p as an empty directory to record, instead of a
+	// sample.
+	emptyDir bool
+}
 
-	type insertJob struct {
-		now time.Time
-		i   os.FileInfo
-		p   string
-	}
+// startInserts starts a goroutine gathering samples of dirid into batches,
+// and handing each to the writer to insert.
+// Closing the returned channel commits the last batch; wait on fdb.wg
+// before relying on it.
+func (fdb *fileDB) startInserts(dirid, scanid int64) chan<- *insertJob {
 	infos := make(chan *insertJob)
-	defer close(infos)
+	root := fdb.getDirPath(dirid)
+	fdb.write(func(tx *batch) { fdb.preloadIDs(tx, dirid) })
 
 	fdb.wg.Add(1)
 	go func() {
 		defer fdb.wg.Done()
-
-		var i int
-
-		tx, err := fdb.db.Begin()
-		fatal(err)
-
+		// After a failure, the walk is let run to the end unrecorded,
+		// and scanDir returns the error.
+		defer func() {
+			for range infos {
+			}
+		}()
+		defer catch(&fdb.insertErr, "")
+
+		jobs := make([]*insertJob, 0, filesPerBatch)
+		flush := func() {
+			start := time.Now()
+			recorded := 0
+			fdb.write(func(tx *batch) {
+				for _, job := range jobs {
+					fdb.insertOneSample(dirid, scanid, root, tx, job)
+					if job.err == nil && !job.emptyDir {
+						recorded++
+					}
+				}
+			})
+			progress.commit(recorded, time.Since(start))
+			sink := getTSDB()
+			sink.samples(root, jobs)
+			sink.flush()
+			jobs = jobs[:0]
+		}
 		for info := range infos {
-
-			fdb.insertOneSample(dirid, tx, info.p, info.i, info.now)
-			i++
-			if i%filesPerBatch == 0 {
-				fmt.Print(".")
-				err = tx.Commit()
-				fatal(err)
-				tx, err = fdb.db.Begin()
-				fatal(err)
+			jobs = append(jobs, info)
+			if len(jobs) == filesPerBatch {
+				fmt.Fprint(stdout, ".")
+				flush()
+				events.flush()
+				time.Sleep(throttleSleep)
 			}
 		}
-		fmt.Println()
+		fmt.Fprintln(stdout)
 
-		err = tx.Commit()
-		fatal(err)
+		flush()
 	}()
 
-	filepath.Walk(canonicalPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			fmt.Println()
+	return infos
+}
+
+// getFiles walks dirid, sampling its files, and counts the errors along
+// the way.  Only failing to read the directory itself is an error.
+func (fdb *fileDB) getFiles(dirid, scanid int64, sample *scanSample) (errs int, err error) {
+	canonicalPath := fdb.getDirPath(dirid)
+
+	infos := fdb.startInserts(dirid, scanid)
+	defer close(infos)
+
+	var hashers *hashPool
+	if doHash {
+		hashers = startHashers(infos, hashWorkers)
+		defer hashers.close()
+	}
+
+	files, bytes := newPacer(throttleFiles), newPacer(int64(throttleBytes))
+	var w *walker
+	w = &walker{
+		file: func(path string, info os.FileInfo) {
+			progress.found()
+			files.done(1)
+			if sample != nil {
+				sample.add(treePath(canonicalPath, filepath.Dir(path)), info.Size())
+			}
+			job := &insertJob{now: time.Now(), i: info, p: path, source: scanSource(w, path)}
+			if doMime {
+				job.mime = sniffMime(path)
+			}
+			if recordShared {
+				if n, ok := fileShared(path); ok {
+					job.shared = n
+				}
+			}
+			if a := analyzersFor(info.Name()); len(a) > 0 && fdb.needsAnalysis(dirid, canonicalPath, path, info) {
+				job.attrs = analyzeFile(a, path, info)
+			}
+			if doHash && fdb.needsHash(dirid, canonicalPath, path, info) {
+				bytes.done(info.Size())
+				hashers.jobs <- job
+				return
+			}
+			infos <- job
+		},
+		failed: func(path string, err error) {
+			fmt.Fprintln(stdout)
 			log.Print(err)
-			return nil
+			errs++
+			infos <- &insertJob{now: time.Now(), p: path, err: err}
+		},
+		empty: func(path string) {
+			infos <- &insertJob{now: time.Now(), p: path, emptyDir: true}
+		},
+	}
+	if recordLinks {
+		w.link = func(path string, info os.FileInfo) {
+			progress.found()
+			files.done(1)
+			if sample != nil {
+				sample.add(treePath(canonicalPath, filepath.Dir(path)), info.Size())
+			}
+			target, err := os.Readlink(path)
+			if err != nil {
+				w.failed(path, err)
+				return
+			}
+			_, err = os.Stat(path)
+			infos <- &insertJob{now: time.Now(), i: info, p: path, source: scanSource(w, path), target: target, broken: os.IsNotExist(err)}
 		}
+	}
+	w.enter = func(path string) bool {
+		progress.entering(path)
+		return sample == nil || sample.enter(treePath(canonicalPath, path))
+	}
+	err = w.walk(canonicalPath)
+	return
+}
 
-		if info.Mode().IsRegular() {
-			infos <- &insertJob{now: time.Now(), i: info, p: path}
-		}
+// A batch is a transaction recording samples, with the statements it
+// uses prepared for it once, rather than again for each file.
+type batch struct {
+	*sql.Tx
+	stmts map[*sql.Stmt]*sql.Stmt
+}
 
-		return nil
-	})
+func (fdb *fileDB) beginBatch() *batch {
+	tx, err := fdb.db.Begin()
+	fatal(err)
+	return &batch{Tx: tx, stmts: make(map[*sql.Stmt]*sql.Stmt)}
+}
 
-	return
+// Stmt returns stmt prepared for the batch.
+func (b *batch) Stmt(stmt *sql.Stmt) *sql.Stmt {
+	s, ok := b.stmts[stmt]
+	if !ok {
+		s = b.Tx.Stmt(stmt)
+		b.stmts[stmt] = s
+	}
+	return s
 }
 
-func (fdb *fileDB) insertOneSample(dirid int64, tx *sql.Tx, path string, info os.FileInfo, now time.Time) {
+func (fdb *fileDB) insertOneSample(dirid, scanid int64, root string, tx *batch, job *insertJob) {
 	var err error
-	var fileid int64
+	path, info := job.p, job.i
 
-	err = tx.Stmt(fdb.getFileID).QueryRow(dirid, path).Scan(&fileid)
-	if err == sql.ErrNoRows {
-		res, err := tx.Stmt(fdb.insertFile).Exec(dirid, path)
+	if job.err != nil {
+		_, err = tx.Stmt(fdb.insertError).Exec(dirid, scanid, path, errorMessage(job.err), job.now.Unix())
 		fatal(err)
-
-		fileid, err = res.LastInsertId()
+		events.send(event{Event: "error", Time: job.now.Format(time.RFC3339), Dir: root, Path: path, Error: errorMessage(job.err)})
+		return
+	}
+	if job.emptyDir {
+		_, err = tx.Exec("INSERT INTO emptydir (dirid, scanid, path) VALUES (?,?,?)", dirid, scanid, path)
 		fatal(err)
+		return
+	}
 
-	} else {
-		fatal(err)
+	treeid := fdb.treeID(tx.Tx, dirid, treePath(root, filepath.Dir(path)))
+	name := filepath.Base(path)
+	fileid, known := fdb.fileIDs[fileKey{treeid, name}]
+	if !known {
+		fatal(tx.Stmt(fdb.upsertFile).QueryRow(dirid, treeid, name).Scan(&fileid))
 	}
 
-	_, err = tx.Stmt(fdb.insertSample).Exec(fileid, now.Unix(), info.Mode(), info.Size(), info.ModTime().Unix())
+	if events != nil {
+		fdb.sampleEvent(tx.Tx, fileid, root, job)
+	}
+	var atime interface{}
+	if recordAtime {
+		if t, ok := fileAtime(info); ok {
+			atime = t
+		}
+	}
+	var disk interface{}
+	if recordDisk {
+		if n, ok := fileDiskUsage(info); ok {
+			disk = n
+		}
+	}
+	var broken interface{}
+	if info.Mode()&os.ModeSymlink != 0 {
+		broken = job.broken
+		_, err = tx.Stmt(fdb.setLink).Exec(job.target, fileid)
+		fatal(err)
+	}
+	_, err = tx.Stmt(fdb.insertSample).Exec(fileid, job.now.Unix(), info.Mode(), info.Size(), info.ModTime().Unix(), job.source, atime, broken, disk)
 	fatal(err)
 
-	_, err = tx.Stmt(fdb.markFound).Exec(fileid)
+	_, err = tx.Stmt(fdb.markFound).Exec(scanid, fileid)
 	fatal(err)
 
+	if job.mime != "" {
+		_, err = tx.Stmt(fdb.setMime).Exec(job.mime, fileid)
+		fatal(err)
+	}
+
+	if job.attrs != nil {
+		fdb.setExtensions(tx.Tx, fileid, job)
+	}
+
+	if job.hash != "" {
+		_, err = tx.Stmt(fdb.setHash).Exec(job.hash, info.Size(), info.ModTime().Unix(), fileid)
+		fatal(err)
+	}
+
+	if id, ok := fileIdentity(info); ok {
+		nlink, _ := fileLinks(info)
+		_, err = tx.Stmt(fdb.setInode).Exec(int64(id.dev), int64(id.ino), int64(nlink), job.shared, fileid)
+		fatal(err)
+	}
+
+	if uid, ok := fileOwner(info); ok {
+		_, err = tx.Stmt(fdb.setOwner).Exec(uid, fileid)
+		fatal(err)
+	}
+
 	return
 }
 
@@ -268,47 +1121,151 @@ type fileDB struct {
 	db *sql.DB
 	wg sync.WaitGroup
 
-	getFileID    *sql.Stmt
-	insertFile   *sql.Stmt
+	// path is the database file, for backups.
+	path string
+
+	// readOnly is set when there's only reporting to do.  db is then just
+	// another read-only connection, and nothing is written, not even to
+	// the report cache.
+	readOnly bool
+
+	// ro is used for reports, on read-only connections of their own.
+	// With the database in WAL mode they see the last committed state,
+	// and run without waiting for, or holding up, a scan.
+	ro *sql.DB
+
+	upsertTree   *sql.Stmt
+	upsertFile   *sql.Stmt
 	insertSample *sql.Stmt
+	setMime      *sql.Stmt
+	setOwner     *sql.Stmt
+	setLink      *sql.Stmt
+	setInode     *sql.Stmt
+	getHashed    *sql.Stmt
+	getAnalyzed  *sql.Stmt
+	setHash      *sql.Stmt
 	markFound    *sql.Stmt
+	insertError  *sql.Stmt
+
+	// insertErr is what stopped the goroutine inserting samples, if
+	// anything did.
+	insertErr error
+
+	// treeIDs remembers the dirtree rows used by scans, and fileIDs the
+	// files.  Only writes run by the writer use them, but for importing
+	// an archive, and they're cleared whenever rows are deleted.
+	treeIDs map[treeKey]int64
+	fileIDs map[fileKey]int64
+
+	// writes hands writes to the writer goroutine.  See fdb.write.
+	writes chan writeRequest
 }
 
-func newFileDB(path string) (fdb *fileDB) {
-	var err error
+// openReadOnlyDB opens the database at path only for reading, so that
+// reports can be run from read-only media, or while another filebase is
+// writing to it, without changing anything.  The database must already be
+// up to date, as views and migrations can't be applied to it.
+func openReadOnlyDB(path string) (fdb *fileDB, err error) {
+	defer catch(&err, "opening "+path)
 
-	fdb = &fileDB{}
-	fdb.db, err = sql.Open("sqlite3", path)
-	if err != nil {
-		log.Fatal(err)
+	fdb = &fileDB{readOnly: true}
+	fdb.ro, err = sql.Open("sqlite3", dsn(path, "mode=ro&_query_only=1&_busy_timeout=10000"))
+	fatal(err)
+
+	// Reading a database in WAL mode takes a shared memory file beside
+	// it.  Where that can't be made, as on read-only media, nothing else
+	// can be writing to it, so it's read as immutable instead.
+	if _, err = fdb.ro.Exec("SELECT count(*) FROM sqlite_master"); err != nil {
+		fdb.ro.Close()
+		fdb.ro, err = sql.Open("sqlite3", dsn(path, "mode=ro&immutable=1&_query_only=1"))
+		fatal(err)
 	}
+	fdb.db = fdb.ro
+	fatal(fdb.checkVersion())
+	return
+}
+
+func newFileDB(path string) (fdb *fileDB, err error) {
+	defer catch(&err, "opening "+path)
 
-	_, err = fdb.db.Exec(schema)
+	fdb = &fileDB{path: path, treeIDs: make(map[treeKey]int64)}
+	// Foreign keys are enforced on every connection, not just the first,
+	// so that forgetting a file always forgets its samples too.
+	fdb.db, err = sql.Open("sqlite3", dsn(path, "_busy_timeout=10000&_journal_mode=WAL&_foreign_keys=1&_synchronous="+syncMode))
 	fatal(err)
 
-	fdb.getFileID, err = fdb.db.Prepare("SELECT fileid FROM file WHERE dirid = ? AND path = ?")
+	fdb.migrate()
+
+	_, err = fdb.db.Exec(views)
 	fatal(err)
 
-	fdb.insertFile, err = fdb.db.Prepare("INSERT INTO file (dirid, path) VALUES (?,?)")
+	fdb.ro, err = sql.Open("sqlite3", dsn(path, "mode=ro&_query_only=1&_busy_timeout=10000"))
+	fatal(err)
+
+	// The upserts find existing rows or add new ones in one statement.
+	// Conflicts "update" the row to what it was, since DO NOTHING would
+	// return no id.
+	fdb.upsertTree, err = fdb.db.Prepare(
+		`INSERT INTO dirtree (dirid, path) VALUES (?,?)
+		ON CONFLICT (dirid, path) DO UPDATE SET path = excluded.path RETURNING treeid`)
+	fatal(err)
+
+	fdb.upsertFile, err = fdb.db.Prepare(
+		`INSERT INTO file (dirid, treeid, name) VALUES (?,?,?)
+		ON CONFLICT (treeid, name) DO UPDATE SET name = excluded.name RETURNING fileid`)
 	fatal(err)
 
 	fdb.insertSample, err = fdb.db.Prepare(
-		"INSERT INTO sample (fileid, sampletime, mode, size, mtime) VALUES (?,?,?,?,?)")
+		"INSERT INTO sample (fileid, sampletime, mode, size, mtime, source, atime, broken, disk) VALUES (?,?,?,?,?,?,?,?,?)")
+	fatal(err)
+
+	fdb.setMime, err = fdb.db.Prepare("UPDATE file SET mimetype = ? WHERE fileid = ?")
 	fatal(err)
 
-	fdb.markFound, err = fdb.db.Prepare("INSERT INTO found VALUES (?)")
+	fdb.setOwner, err = fdb.db.Prepare("UPDATE file SET uid = ? WHERE fileid = ?")
 	fatal(err)
 
+	fdb.setLink, err = fdb.db.Prepare("UPDATE file SET linktarget = ? WHERE fileid = ?")
+	fatal(err)
+
+	fdb.setInode, err = fdb.db.Prepare("UPDATE file SET dev = ?, ino = ?, nlink = ?, shared = ? WHERE fileid = ?")
+	fatal(err)
+
+	fdb.getHashed, err = fdb.db.Prepare(
+		`SELECT hashsize, hashmtime FROM file, dirtree
+		WHERE dirtree.dirid = ? AND dirtree.path = ? AND file.treeid = dirtree.treeid AND file.name = ?`)
+	fatal(err)
+
+	fdb.getAnalyzed, err = fdb.db.Prepare(
+		`SELECT analyzedsize, analyzedmtime FROM file, dirtree
+		WHERE dirtree.dirid = ? AND dirtree.path = ? AND file.treeid = dirtree.treeid AND file.name = ?`)
+	fatal(err)
+
+	fdb.insertError, err = fdb.db.Prepare(
+		"INSERT INTO walkerror (dirid, scanid, path, message, sampletime) VALUES (?,?,?,?,?)")
+	fatal(err)
+
+	fdb.markFound, err = fdb.db.Prepare("UPDATE file SET lastscan = ? WHERE fileid = ?")
+	fatal(err)
+
+	fdb.setHash, err = fdb.db.Prepare("UPDATE file SET hash = ?, hashsize = ?, hashmtime = ? WHERE fileid = ?")
+	fatal(err)
+
+	fdb.startWriter()
 	return
 }
 
 type fileEnt struct {
-	path  string
-	when  time.Time
-	mode  int
-	size  int64
-	mtime time.Time
-	rate  float64
+	path string
+	// dir is the recorded directory holding the file, in reports across
+	// all of them.
+	dir     string
+	when    time.Time
+	mode    int
+	size    int64
+	mtime   time.Time
+	rate    float64
+	samples int64
 }
 
 const secondsPerDay = 3600 * 24
@@ -318,7 +1275,7 @@ func (f *fileEnt) String() string {
 	if f.rate != 0.0 {
 		rateString = fmt.Sprintf("%vB/day\t", niceSizef(f.rate*secondsPerDay))
 	}
-	return fmt.Sprintf("%v\t%o\t%v\t%s%v", f.mtime, f.mode, niceSize(f.size), rateString, f.path)
+	return fmt.Sprintf("%v\t%o\t%v\t%s%v", f.mtime, f.mode, sizeColumns(f.size), rateString, f.path)
 }
 
 func (f *fileEnt) Scan(r *sql.Rows) {
@@ -328,106 +1285,167 @@ func (f *fileEnt) Scan(r *sql.Rows) {
 	f.mtime = time.Unix(mtime, 0)
 }
 
-func rowsToResults(r *sql.Rows, n int) []fileEnt {
-	defer r.Close()
-
-	result := make([]fileEnt, n)
-	i := 0
-	for r.Next() && i < n {
-		result[i].Scan(r)
-		i++
+func (fdb *fileDB) close() {
+	fdb.wg.Wait()
+	if fdb.writes != nil {
+		close(fdb.writes)
 	}
-
-	return result[0:i]
+	fdb.ro.Close()
+	fdb.db.Close()
 }
 
-func (fdb *fileDB) getBiggest(dirid int64, n int) []fileEnt {
-	rows, err := fdb.db.Query(
-		`select path, sampletime, mode, size, mtime from file, sample 
-		where file.fileid=sample.fileid and 
-			file.dirid = ? and
-			sample.sampletime =	(
-				select max(sampletime) from sample where file.fileid=sample.fileid
-				)
-		order by sample.size DESC LIMIT ?`, dirid, n)
-	fatal(err)
+const suffixes = " kMGTP"
 
-	return rowsToResults(rows, n)
-}
+// iecSuffixes are used with -units iec, for powers of 1024.
+var iecSuffixes = []string{" ", "Ki", "Mi", "Gi", "Ti", "Pi"}
 
-func (fdb *fileDB) getOldest(dirid int64, n int) []fileEnt {
-	rows, err := fdb.db.Query(
-		`select path, sampletime, mode, size, mtime from file, sample 
-		where file.fileid=sample.fileid and 
-			file.dirid = ? and
-			sample.sampletime =	(
-				select max(sampletime) from sample where file.fileid=sample.fileid
-				)
-		order by sample.mtime ASC LIMIT ?`, dirid, n)
-	fatal(err)
+// niceSizef formats a size or rate with the -units suffix, for people.
+func niceSizef(n float64) string {
+	return padSize(formatSize(n))
+}
 
-	return rowsToResults(rows, n)
+func formatSize(n float64) string {
+	switch {
+	case n == 0.0:
+		return "0"
+	case n < 0:
+		// Shrinking files have negative rates.
+		return "-" + strings.TrimLeft(formatSize(-n), " ")
+	case math.IsNaN(n) || math.IsInf(n, 0):
+		return fmt.Sprint(n)
+	}
+	switch units {
+	case "raw":
+		return localNumber(fmt.Sprintf("%.0f", n))
+	case "iec":
+		p := int(math.Floor(math.Log2(n) / 10.0))
+		if p < 0 {
+			p = 0
+		}
+		if p >= len(iecSuffixes) {
+			return localNumber(fmt.Sprintf("%.0f", n))
+		}
+		return localNumber(fmt.Sprintf("%3.*f", precision, n/math.Exp2(10*float64(p)))) + iecSuffixes[p]
+	}
+	p := int(math.Floor(math.Log10(n) / 3.0))
+	if p < 0 {
+		p = 0
+	}
+	if p >= len(suffixes) {
+		return localNumber(fmt.Sprintf("%.0f", n))
+	}
+	return localNumber(fmt.Sprintf("%3.*f", precision, n/math.Pow10(3*p))) + string(suffixes[p])
 }
 
-func (fdb *fileDB) getNewest(dirid int64, n int) []fileEnt {
-	rows, err := fdb.db.Query(
-		`select path, sampletime, mode, size, mtime from file, sample 
-		where file.fileid=sample.fileid and 
-			file.dirid = ? and
-			sample.sampletime =	(
-				select max(sampletime) from sample where file.fileid=sample.fileid
-				)
-		order by sample.mtime DESC LIMIT ?`, dirid, n)
-	fatal(err)
+var unitNames = []string{"si", "iec", "raw"}
 
-	return rowsToResults(rows, n)
+func setUnits(s string) error {
+	for _, u := range unitNames {
+		if s == u {
+			units = s
+			return nil
+		}
+	}
+	return fmt.Errorf("units must be one of %s", strings.Join(unitNames, ", "))
 }
 
-func (fdb *fileDB) getFastest(dirid int64, n int) []fileEnt {
-	rows, err := fdb.db.Query(
-		`select path, sampletime, mode, size, mtime, rate
-  				from rates, file
-  				where rates.fileid = file.fileid and file.dirid = ? order by rate DESC limit ?;`, dirid, n)
-	fatal(err)
-	defer rows.Close()
+func niceSize(n int64) string {
+	return niceSizef(float64(n))
+}
 
-	result := make([]fileEnt, n)
-	i := 0
-	for rows.Next() && i < n {
-		var when, mtime int64
-		rows.Scan(&result[i].path, &when, &result[i].mode, &result[i].size, &mtime, &result[i].rate)
-		result[i].when = time.Unix(when, 0)
-		result[i].mtime = time.Unix(mtime, 0)
-		i++
+// sizeColumns is niceSize, followed by the exact size with -bytes.
+func sizeColumns(n int64) string {
+	if showBytes {
+		return fmt.Sprintf("%v\t%s", niceSize(n), localNumber(fmt.Sprint(n)))
 	}
+	return niceSize(n)
+}
+
+// byteSize is a flag.Value accepting sizes like "1G" or "512k", using the
+// same decimal suffixes that niceSize prints, or binary ones like "4GiB".
+type byteSize int64
 
-	return result[0:i]
+func (b *byteSize) String() string {
+	return niceSize(int64(*b))
 }
 
-func (fdb *fileDB) close() {
-	fdb.wg.Wait()
-	fdb.db.Close()
+// UnmarshalJSON accepts sizes in the configuration file either as numbers
+// of bytes or as strings like "10G".
+func (b *byteSize) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+		*b = byteSize(n)
+		return nil
+	}
+	return b.Set(s)
 }
 
-func fatal(err error) {
+func (b *byteSize) Set(s string) error {
+	n, err := parseSize(s)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	*b = byteSize(n)
+	return nil
 }
 
-const suffixes = " kMGTP"
+// byteRate is a flag.Value for growth rates like "1G/day", in bytes per
+// day.  The "/day" is optional.
+type byteRate float64
 
-func niceSizef(n float64) string {
-	if n == 0.0 {
-		return "0"
+func (r *byteRate) String() string {
+	return niceSizef(float64(*r)) + "/day"
+}
+
+func (r *byteRate) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n float64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+		*r = byteRate(n)
+		return nil
 	}
-	p := int(math.Floor(math.Log10(n) / 3.0))
-	if p >= len(suffixes) {
-		return fmt.Sprintf("%d", n)
+	return r.Set(s)
+}
+
+func (r *byteRate) Set(s string) error {
+	n, err := parseSize(strings.TrimSuffix(strings.TrimSpace(s), "/day"))
+	if err != nil {
+		return err
 	}
-	return fmt.Sprintf("%3.2f%c", n/math.Pow10(3*p), suffixes[p])
+	*r = byteRate(n)
+	return nil
 }
 
-func niceSize(n int64) string {
-	return niceSizef(float64(n))
+func parseSize(s string) (int64, error) {
+	num := strings.TrimSuffix(strings.TrimSpace(s), "B")
+	mult := 1.0
+	if n := len(num); n > 1 && num[n-1] == 'i' {
+		for p, suffix := range iecSuffixes {
+			if p > 0 && strings.EqualFold(num[n-2:], suffix) {
+				mult = math.Exp2(10 * float64(p))
+				num = num[:n-2]
+			}
+		}
+	} else if n > 0 {
+		c := num[n-1]
+		if c == 'K' {
+			c = 'k'
+		}
+		if p := strings.IndexByte(suffixes, c); p > 0 {
+			mult = math.Pow10(3 * p)
+			num = num[:n-1]
+		}
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(f * mult), nil
 }
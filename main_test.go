@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"100", 100, true},
+		{"100B", 100, true},
+		{" 7 ", 7, true},
+		{"1k", 1000, true},
+		{"1K", 1000, true},
+		{"1kB", 1000, true},
+		{"1.5M", 1500000, true},
+		{"2GB", 2000000000, true},
+		{"3T", 3000000000000, true},
+		{"1P", 1000000000000000, true},
+		{"1Ki", 1024, true},
+		{"1KiB", 1024, true},
+		{"1ki", 1024, true},
+		{"1.5Mi", 1572864, true},
+		{"2GiB", 2 << 30, true},
+		{"1Ti", 1 << 40, true},
+		{"", 0, false},
+		{"B", 0, false},
+		{"k", 0, false},
+		{"1X", 0, false},
+		{"1Xi", 0, false},
+		{"ten", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.s)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseSize(%q) error = %v, want ok %v", tt.s, err, tt.ok)
+			continue
+		}
+		if tt.ok && got != tt.want {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+// TestScanRoundTrip scans a tree into a new database, changes it and
+// scans it again, and checks what was recorded each time.
+func TestScanRoundTrip(t *testing.T) {
+	tmp := t.TempDir()
+	defer func(path string, cfg *config) { configPath, loadedConfig = path, cfg }(configPath, loadedConfig)
+	configPath, loadedConfig = filepath.Join(tmp, "none.json"), nil
+
+	root := filepath.Join(tmp, "tree")
+	write := func(rel string, size int) {
+		t.Helper()
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a", 10)
+	write("sub/b", 20)
+	write("sub/c", 30)
+
+	fdb, err := newFileDB(filepath.Join(tmp, "test.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fdb.close()
+	dirid := fdb.getDirID(root)
+	path := fdb.getDirPath(dirid)
+
+	scan := func() {
+		t.Helper()
+		// Samples are keyed by the second they're taken in.
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+		if err := fdb.scanDir(dirid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sizes := func() map[string]int64 {
+		result := make(map[string]int64)
+		for p, f := range fdb.latestFiles(dirid, path) {
+			result[p] = f.size
+		}
+		return result
+	}
+	counts := func() (files, added, changed, removed int64) {
+		t.Helper()
+		err := fdb.db.QueryRow(
+			`SELECT files, added, changed, removed FROM scan WHERE dirid = ?
+			ORDER BY started DESC, rowid DESC LIMIT 1`, dirid).Scan(&files, &added, &changed, &removed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	scan()
+	if got, want := sizes(), map[string]int64{"a": 10, "sub/b": 20, "sub/c": 30}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after the first scan, recorded %v, want %v", got, want)
+	}
+	if files, added, changed, removed := counts(); files != 3 || added != 3 || changed != 3 || removed != 0 {
+		t.Errorf("first scan counted %d files, %d added, %d changed, %d removed; want 3, 3, 3, 0", files, added, changed, removed)
+	}
+
+	write("a", 15)
+	write("sub/d", 5)
+	if err := os.Remove(filepath.Join(root, "sub/c")); err != nil {
+		t.Fatal(err)
+	}
+	scan()
+	if got, want := sizes(), map[string]int64{"a": 15, "sub/b": 20, "sub/d": 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after the second scan, recorded %v, want %v", got, want)
+	}
+	// New files are counted as changed too.
+	if files, added, changed, removed := counts(); files != 3 || added != 1 || changed != 2 || removed != 1 {
+		t.Errorf("second scan counted %d files, %d added, %d changed, %d removed; want 3, 1, 2, 1", files, added, changed, removed)
+	}
+
+	vanished := fdb.getVanished(dirid, time.Time{})
+	if len(vanished) != 1 || filepath.Base(vanished[0].path) != "c" || vanished[0].size != 30 {
+		t.Errorf("recorded as vanished %v, want sub/c of 30 bytes", vanished)
+	}
+	history := fdb.getHistory(dirid, filepath.Join(path, "a"))
+	if len(history) != 2 || history[0].size != 10 || history[1].size != 15 {
+		t.Errorf("history of a is %v, want 10 then 15 bytes", history)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// With -manifest, a JSON file describing how the scans went is written
+// after each one, for job schedulers to read without opening the database.
+// It holds the latest scan of each directory scanned since filebase
+// started, and is replaced whole, so readers never see half of it.
+
+// manifestErrors is how many of the paths a scan couldn't read are listed
+// in the manifest.  All of them are counted.
+const manifestErrors = 20
+
+type scanManifest struct {
+	Host    string          `json:"host"`
+	Written string          `json:"written"`
+	Scans   []*manifestScan `json:"scans"`
+}
+
+type manifestScan struct {
+	ScanID          int64   `json:"scan_id,omitempty"`
+	Dir             string  `json:"dir"`
+	Started         string  `json:"started"`
+	Finished        string  `json:"finished,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Files           int64   `json:"files"`
+	Bytes           int64   `json:"bytes"`
+	Added           int64   `json:"added"`
+	Changed         int64   `json:"changed"`
+	Vanished        int64   `json:"vanished"`
+	Errors          int64   `json:"errors"`
+	Sampled         float64 `json:"sampled,omitempty"`
+
+	// ErrorCounts counts the paths that couldn't be read by why.
+	ErrorCounts map[string]int64 `json:"error_counts,omitempty"`
+	ErrorPaths  []manifestError  `json:"error_paths,omitempty"`
+
+	// Failed is why the scan was abandoned, leaving everything as it was,
+	// if it was.
+	Failed string `json:"failed,omitempty"`
+}
+
+type manifestError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+var manifest struct {
+	mu    sync.Mutex
+	scans []*manifestScan
+}
+
+// manifestScanned describes scanid, of dirid, as finished.
+func (fdb *fileDB) manifestScanned(dirid, scanid int64) *manifestScan {
+	m := &manifestScan{ScanID: scanid, Dir: fdb.getDirPath(dirid)}
+	var started, finished int64
+	var fraction sql.NullFloat64
+	err := fdb.db.QueryRow(
+		`SELECT started, finished, duration, files, bytes, added, changed, removed, errors, fraction
+		FROM scan WHERE rowid = ?`, scanid).Scan(&started, &finished, &m.DurationSeconds,
+		&m.Files, &m.Bytes, &m.Added, &m.Changed, &m.Vanished, &m.Errors, &fraction)
+	fatal(err)
+	// The scan table counts new files as changed too.
+	m.Changed -= m.Added
+	m.Started = time.Unix(started, 0).Format(time.RFC3339)
+	m.Finished = time.Unix(finished, 0).Format(time.RFC3339)
+	m.Sampled = fraction.Float64
+
+	rows, err := fdb.db.Query("SELECT path, message FROM walkerror WHERE scanid = ? ORDER BY path", scanid)
+	fatal(err)
+	defer rows.Close()
+	for rows.Next() {
+		var e manifestError
+		fatal(rows.Scan(&e.Path, &e.Message))
+		if m.ErrorCounts == nil {
+			m.ErrorCounts = make(map[string]int64)
+		}
+		m.ErrorCounts[e.Message]++
+		if len(m.ErrorPaths) < manifestErrors {
+			m.ErrorPaths = append(m.ErrorPaths, e)
+		}
+	}
+	fatal(rows.Err())
+	return m
+}
+
+// writeManifest adds m to the -manifest, in place of any scan before of
+// the same directory, and writes it out.
+func writeManifest(m *manifestScan) error {
+	manifest.mu.Lock()
+	defer manifest.mu.Unlock()
+
+	replaced := false
+	for i, s := range manifest.scans {
+		if s.Dir == m.Dir {
+			manifest.scans[i], replaced = m, true
+		}
+	}
+	if !replaced {
+		manifest.scans = append(manifest.scans, m)
+	}
+
+	b, err := json.MarshalIndent(&scanManifest{localHost, time.Now().Format(time.RFC3339), manifest.scans}, "", "  ")
+	fatal(err)
+	tmp, err := os.CreateTemp(filepath.Dir(manifestPath), ".manifest-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = tmp.Chmod(0644); err == nil {
+		_, err = tmp.Write(append(b, '\n'))
+	}
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), manifestPath)
+}
+
+// logManifest writes m to the -manifest, logging rather than returning a
+// failure to, since the scan itself has gone ahead.
+func logManifest(m *manifestScan) {
+	if err := writeManifest(m); err != nil {
+		log.Printf("writing the manifest: %v", err)
+	}
+}
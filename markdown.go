@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// With -format markdown, reports are written as Markdown tables under a
+// heading each, to be pasted into a wiki, an issue or a review comment.
+
+// markdownCell escapes what would end a cell or start a new line.
+func markdownCell(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+func writeMarkdownRow(w io.Writer, cells []string) {
+	var b strings.Builder
+	b.WriteString("|")
+	for _, c := range cells {
+		b.WriteString(" ")
+		b.WriteString(markdownCell(c))
+		b.WriteString(" |")
+	}
+	fmt.Fprintln(w, b.String())
+}
+
+// markdownWriter is the rowWriter for -format markdown.
+type markdownWriter struct {
+	w     io.Writer
+	cells []string
+}
+
+func (m *markdownWriter) Header(cols []string) {
+	writeMarkdownRow(m.w, cols)
+	fmt.Fprintln(m.w, "|"+strings.Repeat(" --- |", len(cols)))
+}
+
+func (m *markdownWriter) Row(vals []interface{}) {
+	m.cells = m.cells[:0]
+	for _, v := range vals {
+		m.cells = append(m.cells, cellString(v))
+	}
+	writeMarkdownRow(m.w, m.cells)
+}
+
+func (m *markdownWriter) Flush() {}
+
+// printMarkdownTable prints the tab separated lines of a tableWriter as a
+// table, with blank headings since Markdown tables must have some.
+func printMarkdownTable(rows [][]string) {
+	cols := 0
+	for _, cells := range rows {
+		if len(cells) > cols {
+			cols = len(cells)
+		}
+	}
+	w := &markdownWriter{w: stdout}
+	w.Header(make([]string, cols))
+	for _, cells := range rows {
+		for len(cells) < cols {
+			cells = append(cells, "")
+		}
+		writeMarkdownRow(stdout, cells)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A database's schema_version is how many of the migrations have been
+// applied to it.  New ones go on the end and are never changed once
+// released, so that every database passes through the same steps.
+var migrations = []func(tx *sql.Tx){
+	baseline,
+	splitPaths,
+	relativePaths,
+	dirIntervals,
+	vanishedFiles,
+	baselines,
+	tags,
+	notes,
+	watches,
+	extensions,
+	sampledScans,
+	accessTimes,
+	symlinks,
+	dirLimits,
+	diskUsage,
+	vanishedOwners,
+	dbSizes,
+	linkCounts,
+	agentDirs,
+}
+
+// baseline brings a database up to the schema as it was when versioning
+// began.  Databases from before then record no version, and may have
+// any of the tables and columns added since the first release, so it
+// only creates those that are missing.
+func baseline(tx *sql.Tx) {
+	_, err := tx.Exec(schema)
+	fatal(err)
+	addColumn(tx, "dir", "origpath", "text")
+	addColumn(tx, "dir", "fsuuid", "text")
+	addColumn(tx, "dir", "relpath", "text")
+	addColumn(tx, "dir", "host", "text")
+	addColumn(tx, "dir", "device", "integer")
+	addColumn(tx, "file", "mimetype", "text")
+	addColumn(tx, "file", "uid", "integer")
+	addColumn(tx, "file", "hash", "text")
+	addColumn(tx, "file", "hashsize", "integer")
+	addColumn(tx, "file", "hashmtime", "integer")
+	addColumn(tx, "file", "lastscan", "integer")
+	addColumn(tx, "scan", "finished", "integer")
+	addColumn(tx, "scan", "bytes", "integer")
+	addColumn(tx, "scan", "added", "integer")
+	addColumn(tx, "scan", "removed", "integer")
+	addColumn(tx, "scan", "errors", "integer")
+	addColumn(tx, "sample", "source", "text NOT NULL DEFAULT 'scan'")
+	addColumn(tx, "sample", "invalid", "text")
+}
+
+// addColumn adds a column to a table unless it's already there.
+func addColumn(tx *sql.Tx, table, column, decl string) {
+	var n int
+	err := tx.QueryRow("SELECT count(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&n)
+	fatal(err)
+	if n == 0 {
+		_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl))
+		fatal(err)
+	}
+}
+
+// migrate applies the migrations a database hasn't had yet, all in one
+// transaction, so that a failure leaves it as it was.
+func (fdb *fileDB) migrate() {
+	_, err := fdb.db.Exec("CREATE TABLE IF NOT EXISTS schema_version (version integer NOT NULL)")
+	fatal(err)
+
+	tx, err := fdb.db.Begin()
+	fatal(err)
+	defer tx.Rollback()
+
+	// Take the write lock before reading the version, so that two
+	// filebases opening the database at once don't both migrate it.
+	_, err = tx.Exec("UPDATE schema_version SET version = version")
+	fatal(err)
+
+	var version int
+	err = tx.QueryRow("SELECT version FROM schema_version").Scan(&version)
+	if err == sql.ErrNoRows {
+		_, err = tx.Exec("INSERT INTO schema_version (version) VALUES (0)")
+	}
+	fatal(err)
+
+	if version > len(migrations) {
+		fatal(tooNew(version))
+	}
+	if version == len(migrations) {
+		return
+	}
+	var tables int
+	fatal(tx.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = 'dir'").Scan(&tables))
+	if tables > 0 {
+		fdb.backup("migrate")
+	}
+
+	for _, m := range migrations[version:] {
+		m(tx)
+	}
+	_, err = tx.Exec("UPDATE schema_version SET version = ?", len(migrations))
+	fatal(err)
+	fatal(tx.Commit())
+}
+
+func tooNew(version int) error {
+	return fmt.Errorf("database is at schema version %d, but this filebase only knows up to %d; upgrade filebase",
+		version, len(migrations))
+}
+
+// checkVersion makes sure a database opened read-only is up to date, since
+// it can't be migrated.
+func (fdb *fileDB) checkVersion() error {
+	var version int
+	err := fdb.ro.QueryRow("SELECT version FROM schema_version").Scan(&version)
+	if err != nil && !strings.Contains(err.Error(), "no such table") {
+		return err
+	}
+	if version > len(migrations) {
+		return tooNew(version)
+	}
+	if version < len(migrations) {
+		return errors.New("database is from an older filebase and must be upgraded before it can be read; run filebase on it once without -noscan")
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadFixture builds the old database in fixtures/name in a new file.
+func loadFixture(t *testing.T, name string) (path string) {
+	t.Helper()
+	script, err := fixtures.ReadFile("fixtures/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path = filepath.Join(t.TempDir(), "old.sqlite3")
+	old, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+	if _, err = old.Exec(string(script)); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// schemaVersion returns the schema version of the database at path, 0 if
+// it has none.
+func schemaVersion(t *testing.T, path string) (version int) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.QueryRow("SELECT version FROM schema_version").Scan(&version)
+	if err != nil && err != sql.ErrNoRows && !strings.Contains(err.Error(), "no such table") {
+		t.Fatal(err)
+	}
+	return
+}
+
+// TestMigrateFixtures brings each old database up to date, twice, and
+// checks the reports on it.
+func TestMigrateFixtures(t *testing.T) {
+	names, err := fs.Glob(fixtures, "fixtures/*.sql")
+	if err != nil || len(names) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+	for _, name := range names {
+		for _, problem := range checkFixture(name) {
+			t.Errorf("%s: %s", name, problem)
+		}
+
+		path := loadFixture(t, filepath.Base(name))
+		for i := 0; i < 2; i++ {
+			fdb, err := newFileDB(path)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			fdb.close()
+			if v := schemaVersion(t, path); v != len(migrations) {
+				t.Errorf("%s: opening it %d times left schema version %d, want %d", name, i+1, v, len(migrations))
+			}
+		}
+	}
+}
+
+// TestMigrateFailure checks that a failing migration leaves the database
+// as it was.
+func TestMigrateFailure(t *testing.T) {
+	path := loadFixture(t, "v0.sql")
+	defer func(m []func(tx *sql.Tx)) { migrations = m }(migrations)
+	failure := errors.New("migration failed")
+	migrations = append(migrations[:len(migrations):len(migrations)], func(tx *sql.Tx) { fatal(failure) })
+
+	if _, err := newFileDB(path); !errors.Is(err, failure) {
+		t.Fatalf("opening with a failing migration gave %v, want %v", err, failure)
+	}
+	if v := schemaVersion(t, path); v != 0 {
+		t.Errorf("failed migration left schema version %d, want 0", v)
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = 'dirtree'").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Error("failed migration left the dirtree table behind")
+	}
+}
+
+// TestMigrateTooNew checks that a database from a newer filebase isn't
+// opened.
+func TestMigrateTooNew(t *testing.T) {
+	path := loadFixture(t, "v0.sql")
+	fdb, err := newFileDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fdb.db.Exec("UPDATE schema_version SET version = ?", len(migrations)+1)
+	fdb.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newFileDB(path); err == nil || !strings.Contains(err.Error(), "upgrade filebase") {
+		t.Errorf("opening a newer database gave %v, want an error saying to upgrade", err)
+	}
+	if _, err := openReadOnlyDB(path); err == nil || !strings.Contains(err.Error(), "upgrade filebase") {
+		t.Errorf("opening a newer database read-only gave %v, want an error saying to upgrade", err)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+)
+
+// sniffMime classifies a file by its first bytes rather than its name.
+func sniffMime(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Print(err)
+		return ""
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		log.Print(err)
+		return ""
+	}
+
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(buf[:n]))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+func (fdb *fileDB) getTypeTotals(dirid int64, n int, o reportOptions) []totalEnt {
+	rows, err := fdb.ro.Query(
+		`select coalesce(mimetype, 'unknown'), sum(size), count(*) from filepaths as file, sample
+		where file.fileid=sample.fileid and
+			file.dirid = ?`+nameFilter+` and
+			sample.sampletime =	(
+				select max(sampletime) from sample where file.fileid=sample.fileid
+				)
+		group by mimetype`, o.filterArgs(dirid)...)
+	fatal(err)
+	defer rows.Close()
+
+	var result []totalEnt
+	for rows.Next() {
+		var t totalEnt
+		fatal(rows.Scan(&t.name, &t.size, &t.files))
+		result = append(result, t)
+	}
+	fatal(rows.Err())
+
+	return sortTotals(result, n, o)
+}
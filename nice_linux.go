@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// ioprioIdle is the idle I/O scheduling class, for ioprio_set, which gets
+// the disk only when nothing else wants it.
+const ioprioIdle = 3 << 13
+
+// lowerPriority lowers the CPU and I/O priority of each of the process's
+// threads.  They're set per thread on Linux, and threads started later
+// take them from the ones starting them.
+func lowerPriority() {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		log.Printf("-nice: %v", err)
+		return
+	}
+	for _, t := range tasks {
+		tid, err := strconv.Atoi(t.Name())
+		if err != nil {
+			continue
+		}
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, 19); err != nil {
+			log.Printf("-nice: %v", err)
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, 1, uintptr(tid), ioprioIdle); errno != 0 {
+			log.Printf("-nice: ioprio_set: %v", errno)
+		}
+	}
+}
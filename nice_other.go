@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+import "log"
+
+func lowerPriority() {
+	log.Print("-nice isn't supported on this system")
+}
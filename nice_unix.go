@@ -0,0 +1,16 @@
+//go:build darwin || freebsd
+
+package main
+
+import (
+	"log"
+	"syscall"
+)
+
+// lowerPriority lowers the process's CPU priority.  There's no portable
+// way to lower its I/O priority.
+func lowerPriority() {
+	if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, 19); err != nil {
+		log.Printf("-nice: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "note",
+		synopsis: "[-delete] [path [text...]]",
+		help:     "Attach a note to a file or directory, such as who owns it, to be shown with it and the files under it in reports.  Without text, show the note; without a path, list them all.",
+		run:      runNote,
+	})
+}
+
+// notes adds the table of notes.
+func notes(tx *sql.Tx) {
+	_, err := tx.Exec(`
+CREATE TABLE IF NOT EXISTS note (
+        path text PRIMARY KEY,
+        text text
+);`)
+	fatal(err)
+}
+
+func runNote(args []string) {
+	fs := commandFlags("note")
+	del := fs.Bool("delete", false, "Remove the note from path.")
+	parseFlags(fs, args)
+
+	if fs.NArg() == 0 {
+		w := newRowWriter(stdout)
+		w.Header([]string{"path", "note"})
+		for _, n := range cache.allNotes() {
+			w.Row([]interface{}{n[0], n[1]})
+		}
+		w.Flush()
+		return
+	}
+
+	_, path := cache.findDir(fs.Arg(0))
+	path = strings.TrimSuffix(path, "/")
+	switch {
+	case *del:
+		needArgs(fs, 1)
+		_, err := cache.db.Exec("DELETE FROM note WHERE path = ?", path)
+		fatal(err)
+		cache.changed()
+	case fs.NArg() == 1:
+		var text string
+		err := cache.db.QueryRow("SELECT text FROM note WHERE path = ?", path).Scan(&text)
+		if err == sql.ErrNoRows {
+			fatal(fmt.Errorf("%s has no note", path))
+		}
+		fatal(err)
+		fmt.Fprintln(stdout, text)
+	default:
+		_, err := cache.db.Exec("INSERT OR REPLACE INTO note (path, text) VALUES (?, ?)",
+			path, strings.Join(fs.Args()[1:], " "))
+		fatal(err)
+		cache.changed()
+	}
+}
+
+func (fdb *fileDB) allNotes() (result [][2]string) {
+	rows, err := fdb.ro.Query("SELECT path, text FROM note ORDER BY path")
+	fatal(err)
+	defer rows.Close()
+	for rows.Next() {
+		var n [2]string
+		fatal(rows.Scan(&n[0], &n[1]))
+		result = append(result, n)
+	}
+	fatal(rows.Err())
+	return
+}
+
+// loadedNotes holds every note, by path, once noteFor has needed them.
+var loadedNotes map[string]string
+
+// noteFor returns the note on path, or else on the nearest directory
+// above it that has one.
+func noteFor(path string) string {
+	if loadedNotes == nil {
+		loadedNotes = make(map[string]string)
+		for _, n := range cache.allNotes() {
+			loadedNotes[n[0]] = n[1]
+		}
+	}
+	if len(loadedNotes) == 0 {
+		return ""
+	}
+	for p := path; ; p = filepath.Dir(p) {
+		if text, ok := loadedNotes[p]; ok {
+			return text
+		}
+		if p == "/" || p == "." {
+			return ""
+		}
+	}
+}
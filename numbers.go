@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Numbers shown to people can have their digits grouped in thousands, and
+// a decimal mark other than ".", set with -thousands and -decimal, or both
+// at once from a locale with -locale.  -fixed-width pads sizes and rates
+// to the same width, so they line up on the right.  Numbers in csv and
+// json are left alone, for other programs to read.
+var (
+	thousandsMark string
+	decimalMark   = "."
+	fixedWidth    bool
+)
+
+// localeMarks are the thousands and decimal marks of languages, and of
+// the few countries that differ from the rest speaking theirs.  Those
+// grouping with spaces use no-break ones, so numbers don't come apart.
+var localeMarks = map[string][2]string{
+	"en":    {",", "."},
+	"zh":    {",", "."},
+	"ja":    {",", "."},
+	"ko":    {",", "."},
+	"de":    {".", ","},
+	"es":    {".", ","},
+	"it":    {".", ","},
+	"nl":    {".", ","},
+	"pt":    {".", ","},
+	"da":    {".", ","},
+	"id":    {".", ","},
+	"tr":    {".", ","},
+	"fr":    {"\u00a0", ","},
+	"ru":    {"\u00a0", ","},
+	"uk":    {"\u00a0", ","},
+	"pl":    {"\u00a0", ","},
+	"cs":    {"\u00a0", ","},
+	"sv":    {"\u00a0", ","},
+	"fi":    {"\u00a0", ","},
+	"nb":    {"\u00a0", ","},
+	"de_CH": {"'", "."},
+}
+
+// setLocale sets the thousands and decimal marks from a locale name such
+// as de_DE.UTF-8, or from $LC_ALL, $LC_NUMERIC or $LANG given "auto".
+// C and POSIX leave numbers ungrouped, and other locales it doesn't know
+// are an error.
+func setLocale(s string) error {
+	if s == "auto" {
+		s = ""
+		for _, v := range []string{"LC_ALL", "LC_NUMERIC", "LANG"} {
+			if s = os.Getenv(v); s != "" {
+				break
+			}
+		}
+	}
+	if i := strings.IndexAny(s, ".@"); i >= 0 {
+		s = s[:i]
+	}
+	thousandsMark, decimalMark = "", "."
+	if s == "" || s == "C" || s == "POSIX" {
+		return nil
+	}
+	marks, ok := localeMarks[s]
+	if !ok {
+		lang := strings.ToLower(strings.SplitN(strings.Replace(s, "-", "_", 1), "_", 2)[0])
+		if marks, ok = localeMarks[lang]; !ok {
+			return fmt.Errorf("unknown locale %q", s)
+		}
+	}
+	thousandsMark, decimalMark = marks[0], marks[1]
+	return nil
+}
+
+// localNumber puts the -thousands and -decimal marks into s, a number as
+// Go formats it.
+func localNumber(s string) string {
+	if thousandsMark == "" && decimalMark == "." {
+		return s
+	}
+	start := len(s) - len(strings.TrimLeft(s, " -+"))
+	end := strings.IndexByte(s, '.')
+	if end < 0 {
+		end = len(s)
+	}
+	var b strings.Builder
+	b.WriteString(s[:start])
+	for i := start; i < end; i++ {
+		if i > start && (end-i)%3 == 0 {
+			b.WriteString(thousandsMark)
+		}
+		b.WriteByte(s[i])
+	}
+	if end < len(s) {
+		b.WriteString(decimalMark)
+		b.WriteString(s[end+1:])
+	}
+	return b.String()
+}
+
+// sizeWidth is how wide -fixed-width makes sizes and rates: the widest
+// number before a suffix, the suffix, and a minus sign.
+func sizeWidth() int {
+	digits, suffix := 3, 1
+	switch units {
+	case "iec":
+		digits, suffix = 4, 2
+	case "raw":
+		digits, suffix = 18, 0
+	}
+	w := 1 + digits + (digits-1)/3*utf8.RuneCountInString(thousandsMark) + suffix
+	if precision > 0 {
+		w += utf8.RuneCountInString(decimalMark) + precision
+	}
+	return w
+}
+
+// padSize pads s, a size or rate, on the left to sizeWidth with
+// -fixed-width.
+func padSize(s string) string {
+	if !fixedWidth {
+		return s
+	}
+	if n := sizeWidth() - utf8.RuneCountInString(s); n > 0 {
+		return strings.Repeat(" ", n) + s
+	}
+	return s
+}
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestLocalNumber(t *testing.T) {
+	tests := []struct {
+		thousands, decimal string
+		s, want            string
+	}{
+		{"", ".", "1234567.89", "1234567.89"},
+		{",", ".", "0", "0"},
+		{",", ".", "999", "999"},
+		{",", ".", "1000", "1,000"},
+		{",", ".", "1234567", "1,234,567"},
+		{",", ".", "1234567.891", "1,234,567.891"},
+		{",", ".", "-1234.5", "-1,234.5"},
+		{",", ".", "+123456", "+123,456"},
+		{",", ".", "  12345", "  12,345"},
+		{".", ",", "1234567.89", "1.234.567,89"},
+		{"", ",", "1234.5", "1234,5"},
+		{"\u00a0", ",", "-12345.6", "-12\u00a0345,6"},
+		{"'", ".", "100000", "100'000"},
+	}
+	defer func(t, d string) { thousandsMark, decimalMark = t, d }(thousandsMark, decimalMark)
+	for _, tt := range tests {
+		thousandsMark, decimalMark = tt.thousands, tt.decimal
+		if got := localNumber(tt.s); got != tt.want {
+			t.Errorf("localNumber(%q) with %q and %q = %q, want %q", tt.s, tt.thousands, tt.decimal, got, tt.want)
+		}
+	}
+}
+
+func TestSetLocale(t *testing.T) {
+	tests := []struct {
+		locale             string
+		thousands, decimal string
+		ok                 bool
+	}{
+		{"C", "", ".", true},
+		{"POSIX", "", ".", true},
+		{"en_US.UTF-8", ",", ".", true},
+		{"de_DE", ".", ",", true},
+		{"de_CH.UTF-8", "'", ".", true},
+		{"fr_FR@euro", "\u00a0", ",", true},
+		{"pt-BR", ".", ",", true},
+		{"xx_YY", "", "", false},
+	}
+	defer func(t, d string) { thousandsMark, decimalMark = t, d }(thousandsMark, decimalMark)
+	for _, tt := range tests {
+		err := setLocale(tt.locale)
+		if (err == nil) != tt.ok {
+			t.Errorf("setLocale(%q) error = %v, want ok %v", tt.locale, err, tt.ok)
+			continue
+		}
+		if tt.ok && (thousandsMark != tt.thousands || decimalMark != tt.decimal) {
+			t.Errorf("setLocale(%q) set %q and %q, want %q and %q", tt.locale, thousandsMark, decimalMark, tt.thousands, tt.decimal)
+		}
+	}
+}
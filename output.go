@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+)
+
+var outputFormats = []string{"text", "csv", "json", "html", "markdown", "paths", "paths0"}
+
+// stdout is buffered by the rowWriters themselves.
+var stdout io.Writer = os.Stdout
+
+func setOutputFormat(s string) error {
+	for _, f := range outputFormats {
+		if s == f {
+			outputFormat = s
+			return nil
+		}
+	}
+	return fmt.Errorf("format must be one of %s", strings.Join(outputFormats, ", "))
+}
+
+// pathsOnly tells whether the -format lists nothing but paths.
+func pathsOnly() bool {
+	return outputFormat == "paths" || outputFormat == "paths0"
+}
+
+// printTitle prints the heading of a report, but for the formats meant
+// for programs.
+func printTitle(title string) {
+	switch outputFormat {
+	case "paths", "paths0", "csv", "json":
+		return
+	case "html":
+		fmt.Fprintf(stdout, "<h2>%s</h2>\n", html.EscapeString(title))
+		return
+	case "markdown":
+		fmt.Fprintf(stdout, "## %s\n\n", title)
+		return
+	}
+	fmt.Fprintf(stdout, "*** %s ***\n", title)
+}
+
+// A rowWriter prints a header and rows of values in the chosen -format.
+type rowWriter interface {
+	Header(cols []string)
+	Row(vals []interface{})
+	Flush()
+}
+
+func newRowWriter(w io.Writer) rowWriter {
+	switch outputFormat {
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(w)}
+	case "json":
+		return &jsonWriter{w: bufio.NewWriter(w)}
+	case "html":
+		return &htmlWriter{w: w}
+	case "markdown":
+		return &markdownWriter{w: w}
+	case "paths", "paths0":
+		return &pathWriter{w: bufio.NewWriter(w), col: -1}
+	default:
+		return &textWriter{w: bufio.NewWriter(w)}
+	}
+}
+
+// cellString formats one value the way it's shown in text and csv output.
+func cellString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+type textWriter struct {
+	w *bufio.Writer
+}
+
+func (t *textWriter) Header(cols []string) {
+	fmt.Fprintln(t.w, strings.Join(cols, "\t"))
+}
+
+func (t *textWriter) Row(vals []interface{}) {
+	for i, v := range vals {
+		if i > 0 {
+			t.w.WriteByte('\t')
+		}
+		t.w.WriteString(cellString(v))
+	}
+	t.w.WriteByte('\n')
+}
+
+func (t *textWriter) Flush() {
+	fatal(t.w.Flush())
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) Header(cols []string) {
+	fatal(c.w.Write(cols))
+}
+
+func (c *csvWriter) Row(vals []interface{}) {
+	rec := make([]string, len(vals))
+	for i, v := range vals {
+		rec[i] = cellString(v)
+	}
+	fatal(c.w.Write(rec))
+}
+
+func (c *csvWriter) Flush() {
+	c.w.Flush()
+	fatal(c.w.Error())
+}
+
+// jsonWriter writes an array with an object per row, keyed by column, or
+// without a header, an array of cells per row.
+type jsonWriter struct {
+	w    *bufio.Writer
+	cols []string
+	n    int
+}
+
+func (j *jsonWriter) Header(cols []string) {
+	j.cols = cols
+}
+
+func (j *jsonWriter) Row(vals []interface{}) {
+	if j.n == 0 {
+		j.w.WriteString("[\n")
+	} else {
+		j.w.WriteString(",\n")
+	}
+	j.n++
+
+	if j.cols == nil {
+		b, err := json.Marshal(vals)
+		fatal(err)
+		j.w.Write(b)
+		return
+	}
+	j.w.WriteByte('{')
+	for i, v := range vals {
+		if i > 0 {
+			j.w.WriteByte(',')
+		}
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		k, err := json.Marshal(j.cols[i])
+		fatal(err)
+		e, err := json.Marshal(v)
+		fatal(err)
+		j.w.Write(k)
+		j.w.WriteByte(':')
+		j.w.Write(e)
+	}
+	j.w.WriteByte('}')
+}
+
+func (j *jsonWriter) Flush() {
+	if j.n == 0 {
+		j.w.WriteString("[")
+	}
+	j.w.WriteString("\n]\n")
+	fatal(j.w.Flush())
+}
+
+// pathWriter writes just the path column of each row, for -format paths,
+// to hand to xargs, tar or rsync.
+type pathWriter struct {
+	w   *bufio.Writer
+	col int
+}
+
+func (p *pathWriter) Header(cols []string) {
+	for i, c := range cols {
+		if c == "path" {
+			p.col = i
+			return
+		}
+	}
+	fatal(fmt.Errorf("-format %s needs a report that lists paths", outputFormat))
+}
+
+func (p *pathWriter) Row(vals []interface{}) {
+	writePath(p.w, cellString(vals[p.col]))
+}
+
+func (p *pathWriter) Flush() {
+	fatal(p.w.Flush())
+}
+
+// writePath writes path alone, for -format paths or paths0.
+func writePath(w io.Writer, path string) {
+	end := "\n"
+	if outputFormat == "paths0" {
+		end = "\x00"
+	}
+	_, err := io.WriteString(w, path+end)
+	fatal(err)
+}
+
+// endReport leaves a blank line after a report, but for the formats meant
+// for programs.
+func endReport() {
+	switch outputFormat {
+	case "paths", "paths0", "csv", "json":
+		return
+	}
+	fmt.Fprintln(stdout)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+func fileOwner(info os.FileInfo) (uid int64, ok bool) {
+	return 0, false
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "perms",
+		synopsis: "[-since age] [-risky] <dir>",
+		help:     "List files whose permissions changed from one sample to the next, with the modes before and after, most recent first.  -risky lists only those that became world-writable, setuid or setgid.",
+		run:      runPerms,
+		readOnly: true,
+	})
+}
+
+// permBits are the parts of a mode compared for permission changes.
+const permBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+type permChange struct {
+	path          string
+	when          time.Time
+	before, after os.FileMode
+}
+
+// risks names what a change newly allows that it's worth worrying about.
+func (c *permChange) risks() (risks []string) {
+	gained := c.after &^ c.before
+	if gained&0002 != 0 {
+		risks = append(risks, "world-writable")
+	}
+	if gained&os.ModeSetuid != 0 {
+		risks = append(risks, "setuid")
+	}
+	if gained&os.ModeSetgid != 0 {
+		risks = append(risks, "setgid")
+	}
+	return
+}
+
+func runPerms(args []string) {
+	fs := commandFlags("perms")
+	since := fs.String("since", "", "Only list changes this recent, such as 30d.")
+	risky := fs.Bool("risky", false, "Only list files that became world-writable, setuid or setgid.")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	var cutoff time.Time
+	if *since != "" {
+		age, err := parseAge(*since)
+		if err != nil {
+			usagef("invalid -since %q", *since)
+		}
+		cutoff = time.Now().Add(-age)
+	}
+
+	dirid, _ := cache.findDir(fs.Arg(0))
+	w := newRowWriter(stdout)
+	w.Header([]string{"time", "before", "after", "risk", "path"})
+	for _, c := range cache.getPermChanges(dirid, cutoff, opts) {
+		risks := c.risks()
+		if *risky && len(risks) == 0 {
+			continue
+		}
+		w.Row([]interface{}{c.when.Format(time.RFC3339), c.before.String(), c.after.String(), strings.Join(risks, ","), c.path})
+	}
+	w.Flush()
+}
+
+// getPermChanges finds the samples of files in dirid taken since cutoff
+// whose permissions differ from the sample before, most recent first.
+func (fdb *fileDB) getPermChanges(dirid int64, cutoff time.Time, o reportOptions) (result []permChange) {
+	rows, err := fdb.ro.Query(
+		`select path, c.sampletime, c.prev, c.mode
+		from filepaths as file,
+			(select sample.fileid, sampletime, mode,
+					lag(mode) over (partition by sample.fileid order by sampletime) as prev
+				from sample, file
+				where sample.fileid = file.fileid and file.dirid = ? and invalid is null) as c
+		where c.fileid = file.fileid and file.dirid = ?`+nameFilter+` and
+			c.prev is not null and (c.mode & ?) != (c.prev & ?) and c.sampletime >= ?
+		order by c.sampletime desc, path`,
+		append([]interface{}{dirid}, o.filterArgs(dirid, int64(permBits), int64(permBits), cutoff.Unix())...)...)
+	fatal(err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var c permChange
+		var when, before, after int64
+		fatal(rows.Scan(&c.path, &when, &before, &after))
+		c.when, c.before, c.after = time.Unix(when, 0), os.FileMode(before), os.FileMode(after)
+		result = append(result, c)
+	}
+	fatal(rows.Err())
+	return
+}
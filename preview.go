@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// With -preview, each directory is walked first without recording
+// anything, and what the scan would add, change and find vanished is
+// compared with the database and shown, before asking whether to go ahead.
+// -yes goes ahead without asking, as it must when there's no terminal to
+// ask on.  The scan then walks the directory again, so anything changing
+// in between is recorded as it is then.
+
+// previewChange is a file the scan would record as new, changed or
+// vanished, with its size, or how much it changed by.
+type previewChange struct {
+	path string
+	size int64
+}
+
+type previewEnt struct {
+	root                  string
+	added, changed, gone  []previewChange
+	unchanged, errs       int
+	addedBytes, goneBytes int64
+	changedBytes          int64
+	skipped               []string
+}
+
+// preview walks dirid as a scan would, and compares what it finds with the
+// latest samples of its files.
+func (fdb *fileDB) preview(dirid int64) *previewEnt {
+	p := &previewEnt{root: fdb.getDirPath(dirid)}
+	known := fdb.latestFiles(dirid, p.root)
+
+	found := func(path string, info os.FileInfo) {
+		rel := treePath(p.root, path)
+		old, ok := known[rel]
+		delete(known, rel)
+		switch {
+		case !ok:
+			p.added = append(p.added, previewChange{path, info.Size()})
+			p.addedBytes += info.Size()
+		case old.size != info.Size() || old.mtime != info.ModTime().Unix():
+			p.changed = append(p.changed, previewChange{path, info.Size() - old.size})
+			p.changedBytes += info.Size() - old.size
+		default:
+			p.unchanged++
+		}
+	}
+	w := &walker{
+		file: found,
+		failed: func(path string, err error) {
+			log.Print(err)
+			p.errs++
+		},
+		skipped: func(path string) {
+			p.skipped = append(p.skipped, path)
+		},
+	}
+	if recordLinks {
+		w.link = found
+	}
+	if err := w.walk(p.root); err != nil {
+		// The scan would be abandoned too, leaving everything as it was.
+		log.Print(err)
+		return nil
+	}
+
+	for rel, f := range known {
+		p.gone = append(p.gone, previewChange{strings.TrimSuffix(p.root, "/") + "/" + rel, f.size})
+		p.goneBytes += f.size
+	}
+	return p
+}
+
+func (p *previewEnt) print() {
+	fmt.Fprintf(stdout, "*** PREVIEW OF %s ***\n", p.root)
+	fmt.Fprintf(stdout, "Would record %d new files, %sB\n", len(p.added), niceSize(p.addedBytes))
+	p.printChanges(p.added)
+	fmt.Fprintf(stdout, "Would record %d changed files, %sB\n", len(p.changed), niceSize(p.changedBytes))
+	p.printChanges(p.changed)
+	fmt.Fprintf(stdout, "Would record %d vanished files, %sB\n", len(p.gone), niceSize(p.goneBytes))
+	p.printChanges(p.gone)
+	fmt.Fprintf(stdout, "%d files unchanged", p.unchanged)
+	if p.errs > 0 {
+		fmt.Fprintf(stdout, ", with %d errors", p.errs)
+	}
+	fmt.Fprintln(stdout)
+	for _, s := range p.skipped {
+		fmt.Fprintf(stdout, "Would skip %s\n", s)
+	}
+}
+
+// printChanges lists the biggest of changes, dryRunSample of them.
+func (p *previewEnt) printChanges(changes []previewChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i].size, changes[j].size
+		if a < 0 {
+			a = -a
+		}
+		if b < 0 {
+			b = -b
+		}
+		if a != b {
+			return a > b
+		}
+		return changes[i].path < changes[j].path
+	})
+	for i, c := range changes {
+		if i == dryRunSample {
+			fmt.Fprintf(stdout, "\tand %d more\n", len(changes)-i)
+			break
+		}
+		fmt.Fprintf(stdout, "\t%sB\t%s\n", niceSize(c.size), c.path)
+	}
+}
+
+// confirmScan previews the scan of dirid, and says whether to go ahead
+// with it: with -yes, or if the answer to asking on the terminal is yes.
+func (fdb *fileDB) confirmScan(dirid int64) bool {
+	p := fdb.preview(dirid)
+	if p == nil {
+		return false
+	}
+	p.print()
+	if assumeYes {
+		return true
+	}
+	if !isTerminal(os.Stdin) {
+		fmt.Fprintf(stdout, "%s: not scanning.  Use -yes to scan without asking.\n", p.root)
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "Record the scan of %s? [y/N] ", p.root)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	fmt.Fprintf(stdout, "%s: not scanning.\n", p.root)
+	return false
+}
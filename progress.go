@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// While a scan runs, progress keeps what it has done so far, so a scan
+// hours long can be told from one stuck on a dead mount.  -status serves it
+// as JSON on a unix socket or TCP address, and the daemon's -listen serves
+// it at /status too.
+
+// scanProgress is what the scan in progress has done.  The walk and the
+// goroutine inserting samples update it as they go.
+type scanProgress struct {
+	mu sync.Mutex
+
+	dir        string
+	started    time.Time
+	walking    string
+	walked     int64
+	recorded   int64
+	batches    int64
+	lastCommit time.Duration
+	committed  time.Time
+}
+
+var progress scanProgress
+
+// scanStatus is the JSON served for the scan in progress, or with only
+// Scanning false when there's none.
+type scanStatus struct {
+	Scanning bool   `json:"scanning"`
+	Dir      string `json:"dir,omitempty"`
+	Started  string `json:"started,omitempty"`
+	Walking  string `json:"walking,omitempty"`
+	Walked   int64  `json:"walked,omitempty"`
+	Recorded int64  `json:"recorded,omitempty"`
+
+	// Queued is how many files found haven't been recorded yet.
+	Queued       int64   `json:"queued,omitempty"`
+	FilesPerSec  float64 `json:"files_per_sec,omitempty"`
+	Batches      int64   `json:"batches,omitempty"`
+	LastCommitMS float64 `json:"last_commit_ms,omitempty"`
+	LastCommit   string  `json:"last_commit,omitempty"`
+}
+
+func (p *scanProgress) begin(dir string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dir, p.started, p.walking = dir, time.Now(), ""
+	p.walked, p.recorded, p.batches = 0, 0, 0
+	p.lastCommit, p.committed = 0, time.Time{}
+}
+
+func (p *scanProgress) end() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dir = ""
+}
+
+func (p *scanProgress) entering(dir string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.walking = dir
+}
+
+func (p *scanProgress) found() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.walked++
+}
+
+// commit notes a batch of files recorded, and how long writing it took.
+func (p *scanProgress) commit(files int, took time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recorded += int64(files)
+	p.batches++
+	p.lastCommit, p.committed = took, time.Now()
+}
+
+// count returns how many files the scan in progress has found and
+// recorded, which goes up as long as it's getting somewhere, and whether
+// there is one.
+func (p *scanProgress) count() (n int64, scanning bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.walked + p.recorded + p.batches, p.dir != ""
+}
+
+func (p *scanProgress) status() scanStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.dir == "" {
+		return scanStatus{}
+	}
+	s := scanStatus{
+		Scanning: true,
+		Dir:      p.dir,
+		Started:  p.started.Format(time.RFC3339),
+		Walking:  p.walking,
+		Walked:   p.walked,
+		Recorded: p.recorded,
+		Queued:   p.walked - p.recorded,
+		Batches:  p.batches,
+	}
+	if elapsed := time.Since(p.started).Seconds(); elapsed > 0 {
+		s.FilesPerSec = float64(p.recorded) / elapsed
+	}
+	if p.batches > 0 {
+		s.LastCommitMS = float64(p.lastCommit) / float64(time.Millisecond)
+		s.LastCommit = p.committed.Format(time.RFC3339)
+	}
+	return s
+}
+
+// serveStatus serves the progress of the scan in progress as JSON.
+func serveStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progress.status())
+}
+
+// listenStatus serves /status on addr in the background: a unix socket if
+// it's a path, or else a TCP address such as localhost:9133.  Closing the
+// listener stops it, and removes the socket.
+func listenStatus(addr string) (net.Listener, error) {
+	network := "tcp"
+	if strings.Contains(addr, "/") {
+		network = "unix"
+		// A socket left by a filebase that didn't exit cleanly.
+		if info, err := os.Lstat(addr); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(addr)
+		}
+	}
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", serveStatus)
+	go http.Serve(l, mux)
+	return l, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+// Pseudo filesystems like /proc hold no real files, and stat-ing what's in
+// them can hang, so scans skip them unless -pseudo is given.
+
+// pseudoPaths are skipped wherever they are, even if nothing is mounted
+// on them.
+var pseudoPaths = []string{"/proc", "/sys", "/dev", "/run"}
+
+// pseudoTypes are the filesystem types whose mount points are skipped.
+var pseudoTypes = map[string]bool{
+	"autofs":      true,
+	"binfmt_misc": true,
+	"bpf":         true,
+	"cgroup":      true,
+	"cgroup2":     true,
+	"configfs":    true,
+	"debugfs":     true,
+	"devfs":       true,
+	"devpts":      true,
+	"devtmpfs":    true,
+	"efivarfs":    true,
+	"fusectl":     true,
+	"hugetlbfs":   true,
+	"mqueue":      true,
+	"nsfs":        true,
+	"proc":        true,
+	"pstore":      true,
+	"rpc_pipefs":  true,
+	"securityfs":  true,
+	"selinuxfs":   true,
+	"sysfs":       true,
+	"tracefs":     true,
+}
+
+// skipDirs returns the directories a scan of root shouldn't enter.  root
+// itself is never skipped, so a pseudo filesystem can still be scanned by
+// asking for it.
+func skipDirs(root string) map[string]bool {
+	skip := make(map[string]bool)
+	if scanPseudo {
+		return skip
+	}
+	for _, p := range pseudoPaths {
+		skip[p] = true
+	}
+	for _, p := range pseudoMounts() {
+		skip[p] = true
+	}
+	delete(skip, root)
+	return skip
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package main
+
+func pseudoMounts() []string {
+	return nil
+}
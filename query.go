@@ -0,0 +1,79 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "query",
+		synopsis: "define <name> <sql> | run <name> [arg...] | list | delete <name>",
+		help:     "Save queries under a name and run them later with arguments.",
+		run:      runQuery,
+	})
+}
+
+func runQuery(args []string) {
+	fs := commandFlags("query")
+	parseFlags(fs, args)
+	if fs.NArg() == 0 {
+		badUsage(fs)
+	}
+
+	switch sub, rest := fs.Arg(0), fs.Args()[1:]; {
+	case sub == "define" && len(rest) == 2:
+		_, err := cache.db.Exec("INSERT OR REPLACE INTO namedquery (name, query) VALUES (?,?)", rest[0], rest[1])
+		fatal(err)
+
+	case sub == "run" && len(rest) >= 1:
+		var query string
+		err := cache.db.QueryRow("SELECT query FROM namedquery WHERE name = ?", rest[0]).Scan(&query)
+		if err == sql.ErrNoRows {
+			fatal(fmt.Errorf("no query named %q", rest[0]))
+		}
+		fatal(err)
+
+		db := openReadOnly()
+		defer db.Close()
+		printQuery(db, query, queryArgs(rest[1:])...)
+
+	case sub == "list" && len(rest) == 0:
+		printQuery(cache.db, "SELECT name, query FROM namedquery ORDER BY name")
+
+	case sub == "delete" && len(rest) == 1:
+		_, err := cache.db.Exec("DELETE FROM namedquery WHERE name = ?", rest[0])
+		fatal(err)
+
+	default:
+		badUsage(fs)
+	}
+}
+
+// queryArgs turns command line arguments into query parameters.  Arguments
+// of the form name=value fill :name parameters, and the rest fill ?1, ?2
+// and so on.  Numbers are passed as numbers so they work with LIMIT.
+func queryArgs(args []string) (params []interface{}) {
+	for _, arg := range args {
+		name, value, named := strings.Cut(arg, "=")
+		if !named {
+			value = arg
+		}
+
+		var v interface{} = value
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			v = i
+		} else if f, err := strconv.ParseFloat(value, 64); err == nil {
+			v = f
+		}
+
+		if named {
+			params = append(params, sql.Named(name, v))
+		} else {
+			params = append(params, v)
+		}
+	}
+	return
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+)
+
+// Soft quotas are set by owner in the configuration file.  The quota
+// command reports who is over theirs, and can write each of them a message
+// listing their biggest files, ready to be mailed.
+
+const defaultQuotaMail = `To: {{.Address}}
+{{if .From}}From: {{.From}}
+{{end}}Subject: {{.Root}}: {{.Used}} used, over your {{.Quota}} quota
+
+Hello {{.Owner}},
+
+You are using {{.Used}} in {{.Root}}, which is over your soft quota of
+{{.Quota}}.  Your biggest files there are:
+
+{{range .Files}}	{{.Size}}	{{.Path}}
+{{end}}
+Please remove or archive whatever you no longer need.
+`
+
+type ownerUsage struct {
+	uid   int64
+	owner string
+	size  int64
+	files int64
+	quota int64
+}
+
+type quotaMail struct {
+	Owner   string
+	Address string
+	From    string
+	Root    string
+	Used    string
+	Quota   string
+	Files   []quotaFile
+}
+
+type quotaFile struct {
+	Size string
+	Path string
+}
+
+func init() {
+	addCommand(&command{
+		name:     "quota",
+		synopsis: "[-top n] -mail <maildir> <dir> | <dir>...",
+		help:     "Show owners over their soft quotas in the configuration file, and optionally write them each a message.",
+		run:      runQuota,
+		readOnly: true,
+	})
+}
+
+func runQuota(args []string) {
+	fs := commandFlags("quota")
+	mailDir := fs.String("mail", "", "Write a message to each owner over quota into this directory.")
+	top := fs.Int("top", 10, "How many of their biggest files to list in each message.")
+	parseFlags(fs, args)
+	if fs.NArg() == 0 || (*mailDir != "" && fs.NArg() != 1) {
+		badUsage(fs)
+	}
+
+	cfg := getConfig()
+	if len(cfg.Quotas) == 0 {
+		fatal(fmt.Errorf("no quotas are set in %s", configPath))
+	}
+
+	var tmpl *template.Template
+	if *mailDir != "" {
+		tmpl = quotaTemplate(cfg)
+		fatal(os.MkdirAll(*mailDir, 0755))
+	}
+
+	for _, dir := range fs.Args() {
+		dirid, _ := cache.findDir(dir)
+		root := cache.getDirPath(dirid)
+
+		printTitle("OWNERS OVER QUOTA IN " + root)
+		t := newTableWriter()
+		for _, u := range cache.getOwnerUsage(dirid, opts) {
+			if u.quota == 0 || u.size <= u.quota {
+				continue
+			}
+			t.Line(fmt.Sprintf("%v\t%v\t%d\t%s", sizeColumns(u.size), niceSize(u.quota), u.files, u.owner), "")
+			if tmpl != nil {
+				writeQuotaMail(tmpl, cfg, *mailDir, root, dirid, u, *top)
+			}
+		}
+		t.Flush()
+		fmt.Fprintln(stdout)
+	}
+}
+
+// getOwnerUsage totals the latest size of every file in dirid by owner,
+// with their quotas, biggest first.
+func (fdb *fileDB) getOwnerUsage(dirid int64, o reportOptions) []ownerUsage {
+	rows, err := fdb.ro.Query(
+		`select file.uid, sum(size), count(*) from filepaths as file, sample
+		where file.fileid=sample.fileid and
+			file.dirid = ?`+nameFilter+` and file.uid is not null and
+			sample.sampletime =	(
+				select max(sampletime) from sample where file.fileid=sample.fileid and invalid is null
+				)
+		group by file.uid`, o.filterArgs(dirid)...)
+	fatal(err)
+	defer rows.Close()
+
+	quotas := getConfig().Quotas
+	var result []ownerUsage
+	for rows.Next() {
+		var u ownerUsage
+		fatal(rows.Scan(&u.uid, &u.size, &u.files))
+		u.owner = ownerName(u.uid)
+		if q, ok := quotas[u.owner]; ok {
+			u.quota = int64(q)
+		} else {
+			u.quota = int64(quotas["*"])
+		}
+		result = append(result, u)
+	}
+	fatal(rows.Err())
+
+	sort.Slice(result, func(i, j int) bool { return result[i].size > result[j].size })
+	return result
+}
+
+func quotaTemplate(cfg *config) *template.Template {
+	text := defaultQuotaMail
+	if cfg.Mail.Template != "" {
+		b, err := os.ReadFile(cfg.Mail.Template)
+		fatal(err)
+		text = string(b)
+	}
+	tmpl, err := template.New("quota").Parse(text)
+	if err != nil {
+		fatal(fmt.Errorf("%s: %w", cfg.Mail.Template, err))
+	}
+	return tmpl
+}
+
+// writeQuotaMail writes dir/owner.eml, telling an owner about their
+// biggest files under root.
+func writeQuotaMail(tmpl *template.Template, cfg *config, dir, root string, dirid int64, u ownerUsage, top int) {
+	m := &quotaMail{
+		Owner:   u.owner,
+		Address: u.owner,
+		From:    cfg.Mail.From,
+		Root:    root,
+		Used:    niceSize(u.size),
+		Quota:   niceSize(u.quota),
+	}
+	if cfg.Mail.Domain != "" {
+		m.Address += "@" + cfg.Mail.Domain
+	}
+
+	o := opts
+	o.Owners = []int64{u.uid}
+	o.Offset = 0
+	files := cache.getReport(dirid, biggestReport, top, o)
+	for files.Next() {
+		f := files.File()
+		m.Files = append(m.Files, quotaFile{niceSize(f.size), f.path})
+	}
+
+	out, err := os.Create(filepath.Join(dir, u.owner+".eml"))
+	fatal(err)
+	defer out.Close()
+	fatal(tmpl.Execute(out, m))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// fsIocFiemap is FS_IOC_FIEMAP, which maps a file's extents.
+	fsIocFiemap       = 0xc020660b
+	fiemapExtentLast  = 0x1
+	fiemapExtentShare = 0x2000
+	// fiemapBatch is how many extents are asked for at a time.
+	fiemapBatch = 64
+)
+
+type fiemapExtent struct {
+	logical  uint64
+	physical uint64
+	length   uint64
+	_        [2]uint64
+	flags    uint32
+	_        [3]uint32
+}
+
+type fiemap struct {
+	start         uint64
+	length        uint64
+	flags         uint32
+	mappedExtents uint32
+	extentCount   uint32
+	_             uint32
+	extents       [fiemapBatch]fiemapExtent
+}
+
+// fileShared returns how many bytes of the file at path are in extents
+// shared with other files, as reflinked copies and snapshots share them,
+// if its filesystem can say.
+func fileShared(path string) (shared int64, ok bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	m := fiemap{length: ^uint64(0), extentCount: fiemapBatch}
+	for {
+		m.mappedExtents = 0
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), fsIocFiemap, uintptr(unsafe.Pointer(&m))); errno != 0 {
+			return 0, false
+		}
+		if m.mappedExtents == 0 {
+			return shared, true
+		}
+		for _, e := range m.extents[:m.mappedExtents] {
+			if e.flags&fiemapExtentShare != 0 {
+				shared += int64(e.length)
+			}
+			if e.flags&fiemapExtentLast != 0 {
+				return shared, true
+			}
+		}
+		last := m.extents[m.mappedExtents-1]
+		m.start = last.logical + last.length
+	}
+}
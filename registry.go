@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "dirs",
+		synopsis: "list | remove <dir>... | move <old> <new>",
+		help:     "List the recorded directories, how they were named and when they were scanned, or remove directories with all their history.  move gives a directory a new path, such as where its volume is now mounted, keeping its history.",
+		run:      runDirs,
+	})
+	addCommand(&command{
+		name:     "forget",
+		synopsis: "<path>...",
+		help:     "Remove what has been recorded about files, or about everything under directories, within recorded directories.  Files that are still there come back at the next scan, as new ones.",
+		run:      runForget,
+	})
+}
+
+func runDirs(args []string) {
+	fs := commandFlags("dirs")
+	parseFlags(fs, args)
+
+	switch fs.Arg(0) {
+	case "list":
+		needArgs(fs, 1)
+		w := newRowWriter(stdout)
+		w.Header([]string{"dir", "host", "given_as", "scans", "first_scan", "last_scan"})
+		for _, d := range cache.listDirs() {
+			w.Row([]interface{}{d.path, d.host, d.origPath, d.scans, scanTime(d.first), scanTime(d.last)})
+		}
+		w.Flush()
+	case "remove":
+		if fs.NArg() < 2 {
+			badUsage(fs)
+		}
+		for _, dir := range fs.Args()[1:] {
+			dirid, path := cache.findDir(dir)
+			root := cache.getDirPath(dirid)
+			if strings.TrimSuffix(path, "/") != strings.TrimSuffix(root, "/") {
+				fatal(fmt.Errorf("%s is under %s; use forget to remove part of a directory", path, root))
+			}
+			files := cache.removeDir(dirid)
+			fmt.Fprintf(stdout, "Removed %s and %d files\n", root, files)
+		}
+	case "move":
+		needArgs(fs, 3)
+		dirid, path := cache.findDir(fs.Arg(1))
+		root := cache.getDirPath(dirid)
+		if strings.TrimSuffix(path, "/") != strings.TrimSuffix(root, "/") {
+			fatal(fmt.Errorf("%s is under %s; only whole directories can be moved", path, root))
+		}
+		newPath, err := filepath.Abs(fs.Arg(2))
+		fatal(err)
+		if resolved, err := filepath.EvalSymlinks(newPath); err == nil {
+			newPath = resolved
+		}
+		if other, ok := cache.lookupDir(localHost, newPath); ok && cache.getDirPath(other) == newPath {
+			fatal(fmt.Errorf("%s is already recorded", newPath))
+		}
+		cache.moveDir(dirid, newPath, newPath)
+		fmt.Fprintf(stdout, "Moved %s to %s\n", root, newPath)
+	default:
+		badUsage(fs)
+	}
+}
+
+// scanTime formats a time from the scan table, or nothing for never.
+func scanTime(t int64) string {
+	if t == 0 {
+		return ""
+	}
+	return time.Unix(t, 0).Format(time.RFC3339)
+}
+
+type dirEnt struct {
+	path, host, origPath string
+	scans, first, last   int64
+}
+
+// listDirs returns the directories on the -host, or all of them.
+func (fdb *fileDB) listDirs() (result []dirEnt) {
+	rows, err := fdb.db.Query(
+		`SELECT dirpath, coalesce(host, ''), coalesce(origpath, ''), count(scan.rowid),
+			coalesce(min(scan.started), 0), coalesce(max(scan.started), 0)
+		FROM dir LEFT JOIN scan ON scan.dirid = dir.dirid
+		WHERE `+forHost+`
+		GROUP BY dir.dirid
+		ORDER BY dirpath, host`, forHostArgs()...)
+	fatal(err)
+	defer rows.Close()
+	for rows.Next() {
+		var d dirEnt
+		fatal(rows.Scan(&d.path, &d.host, &d.origPath, &d.scans, &d.first, &d.last))
+		result = append(result, d)
+	}
+	fatal(rows.Err())
+	return
+}
+
+// removeDir deletes dirid and, by the foreign keys, everything recorded
+// about it, and returns how many files it held.  Watched files under it
+// are no longer watched.
+func (fdb *fileDB) removeDir(dirid int64) (files int64) {
+	fatal(fdb.lockScan(dirid))
+	defer fdb.unlockScan(dirid)
+	root := fdb.getDirPath(dirid)
+	fdb.backup("remove")
+
+	tx, err := fdb.db.Begin()
+	fatal(err)
+	defer tx.Rollback()
+	fatal(tx.QueryRow("SELECT count(*) FROM file WHERE dirid = ?", dirid).Scan(&files))
+	if fdb.hasPathIndex() {
+		_, err = tx.Exec("DELETE FROM pathindex WHERE rowid IN (SELECT fileid FROM file WHERE dirid = ?)", dirid)
+		fatal(err)
+	}
+	_, err = tx.Exec("DELETE FROM watch WHERE path = ? OR substr(path, 1, length(?) + 1) = ? || '/'",
+		underPathArgs(root)...)
+	fatal(err)
+	_, err = tx.Exec("DELETE FROM dir WHERE dirid = ?", dirid)
+	fatal(err)
+	fatal(tx.Commit())
+	fdb.changed()
+	return
+}
+
+// moveDir gives dirid a new path, and origPath as the path it was given
+// as.  Its files are recorded relative to it, so they go with it, but
+// tags, notes and watches are by full path and are moved along.  The
+// device is forgotten, so that the next scan doesn't warn that it has
+// changed.
+func (fdb *fileDB) moveDir(dirid int64, newPath, origPath string) {
+	fatal(fdb.lockScan(dirid))
+	defer fdb.unlockScan(dirid)
+	oldPath := strings.TrimSuffix(fdb.getDirPath(dirid), "/")
+
+	tx, err := fdb.db.Begin()
+	fatal(err)
+	defer tx.Rollback()
+	_, err = tx.Exec("UPDATE dir SET dirpath = ?, origpath = ?, device = NULL WHERE dirid = ?", newPath, origPath, dirid)
+	fatal(err)
+	for _, table := range []string{"tag", "note", "watch"} {
+		_, err = tx.Exec(fmt.Sprintf(
+			`UPDATE %s SET path = ? || substr(path, length(?) + 1)
+			WHERE path = ? OR substr(path, 1, length(?) + 1) = ? || '/'`, table),
+			append([]interface{}{strings.TrimSuffix(newPath, "/"), oldPath}, underPathArgs(oldPath)...)...)
+		fatal(err)
+	}
+	if fdb.hasPathIndex() {
+		_, err = tx.Exec("DELETE FROM pathindex WHERE rowid IN (SELECT fileid FROM file WHERE dirid = ?)", dirid)
+		fatal(err)
+	}
+	fatal(tx.Commit())
+	fdb.indexNew(dirid)
+	fdb.changed()
+}
+
+func runForget(args []string) {
+	fs := commandFlags("forget")
+	parseFlags(fs, args)
+	if fs.NArg() == 0 {
+		badUsage(fs)
+	}
+
+	for _, p := range fs.Args() {
+		dirid, path := cache.findDir(p)
+		files := cache.forget(dirid, path)
+		fmt.Fprintf(stdout, "Forgot %d files under %s\n", files, path)
+	}
+}
+
+// forget deletes the files at or below path in dirid, with their samples
+// and any record of their vanishing, and returns how many there were.
+func (fdb *fileDB) forget(dirid int64, path string) (files int64) {
+	fatal(fdb.lockScan(dirid))
+	defer fdb.unlockScan(dirid)
+	fdb.backup("forget")
+
+	tx, err := fdb.db.Begin()
+	fatal(err)
+	defer tx.Rollback()
+	matching := "SELECT fileid FROM filepaths AS file WHERE file.dirid = ? AND " + underPath
+	args := append([]interface{}{dirid}, underPathArgs(path)...)
+	if fdb.hasPathIndex() {
+		_, err = tx.Exec("DELETE FROM pathindex WHERE rowid IN ("+matching+")", args...)
+		fatal(err)
+	}
+	res, err := tx.Exec("DELETE FROM file WHERE fileid IN ("+matching+")", args...)
+	fatal(err)
+	files, err = res.RowsAffected()
+	fatal(err)
+
+	rel := treePath(fdb.getDirPath(dirid), path)
+	_, err = tx.Exec("DELETE FROM vanished WHERE dirid = ? AND (? = '' OR path = ? OR substr(path, 1, length(?) + 1) = ? || '/')",
+		dirid, rel, rel, rel, rel)
+	fatal(err)
+	fatal(tx.Commit())
+
+	fdb.pruneTree(dirid)
+	fdb.changed()
+	return
+}
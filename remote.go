@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A database given to -db as an http or https URL, such as one a host
+// publishes to object storage, is fetched into the user's cache directory
+// and reported on from there, read-only.  The copy is kept with the
+// ETag and Last-Modified the server sent, and fetched again only when the
+// server says it has changed.
+
+// isRemoteDB tells whether path is a URL rather than a file.
+func isRemoteDB(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// fetchRemoteDB returns the path of an up to date copy of the database at
+// url.
+func fetchRemoteDB(url string) (path string, err error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	cacheDir = filepath.Join(cacheDir, "filebase")
+	if err = os.MkdirAll(cacheDir, 0700); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(url))
+	path = filepath.Join(cacheDir, hex.EncodeToString(sum[:8])+".sqlite3")
+	validators := path + ".etag"
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err == nil {
+		if v, err := os.ReadFile(validators); err == nil {
+			etag, modified, _ := strings.Cut(string(v), "\n")
+			if etag != "" {
+				req.Header.Set("If-None-Match", etag)
+			}
+			if modified != "" {
+				req.Header.Set("If-Modified-Since", modified)
+			}
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return path, nil
+	case resp.StatusCode/100 != 2:
+		return "", fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	// The copy is replaced whole, so a failed fetch leaves the old one.
+	tmp, err := os.CreateTemp(cacheDir, "fetch-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("%s: %w", url, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		os.Remove(path + suffix)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	v := resp.Header.Get("ETag") + "\n" + resp.Header.Get("Last-Modified")
+	if err = os.WriteFile(validators, []byte(v), 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
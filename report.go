@@ -0,0 +1,331 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reportOptions are the settings shared by all reports.  They are passed
+// by value and never changed once the flags are parsed, so reports with
+// different options can run at once.
+type reportOptions struct {
+	Matches     []string
+	Excludes    []string
+	ExcludeTags []string
+	Owners      []int64
+	Tags        []string
+	Hidden      string
+	Sources     []string
+	Window      time.Duration
+	RateMode    string
+	OnDisk      bool
+	Offset      int
+	Ties        bool
+	NoCache     bool `json:"-"`
+}
+
+// A reportKind is one of the file reports, defined by what it ranks files
+// by.
+type reportKind struct {
+	title string
+	order string
+	tie   func(a, b *fileEnt) bool
+}
+
+var (
+	biggestReport = &reportKind{"BIGGEST FILES", "size DESC", sameSize}
+	oldestReport  = &reportKind{"OLDEST FILES", "mtime ASC", sameMtime}
+	newestReport  = &reportKind{"NEWEST FILES", "mtime DESC", sameMtime}
+	fastestReport = &reportKind{"FASTEST GROWING FILES", "rate DESC", sameRate}
+)
+
+// Functions telling whether two files tie for a place in a report.
+func sameSize(a, b *fileEnt) bool  { return a.size == b.size }
+func sameMtime(a, b *fileEnt) bool { return a.mtime.Equal(b.mtime) }
+func sameRate(a, b *fileEnt) bool  { return a.rate == b.rate }
+
+// rateModes are the ways a -rate-mode can compute growth rates.
+// endpoints compares the first and last samples, as the rates view does.
+// regression fits a least-squares line through all the samples, so that
+// one odd sample, like a log caught just after it was truncated, can't
+// swing the rate much.
+var rateModes = []string{"endpoints", "regression"}
+
+// minRateSpan is the least time a file's samples must span to give it a
+// growth rate.  Over less, a few bytes between scans a second apart would
+// look like a file growing by megabytes a day.
+var minRateSpan = time.Hour
+
+func parseRateMode(s string) (string, error) {
+	for _, m := range rateModes {
+		if s == m {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("rate mode must be one of %s", strings.Join(rateModes, ", "))
+}
+
+// endpointSamples and regressionSamples find, for each file, the times of
+// its first and last samples, how many there are, and for regression the
+// slope of the line through them.  The first sample is the earliest in the
+// -window, if there are any there.
+const (
+	endpointSamples = `
+		select sample.fileid, max(sampletime) as maxtime,
+				coalesce(min(case when sampletime >= ? then sampletime end), max(sampletime)) as mintime,
+				count(*) as samples
+			from sample, file
+			where sample.fileid = file.fileid and file.dirid = ? and invalid is null and
+				(? = 0 or source in (select value from json_each(?)))
+			group by sample.fileid`
+
+	regressionSamples = `
+		select fileid, max(sampletime) as maxtime,
+				coalesce(min(case when inwindow then sampletime end), max(sampletime)) as mintime,
+				count(*) as samples,
+				sum(dt * dsize) / sum(dt * dt) as slope
+			from (select fileid, sampletime, inwindow,
+					case when inwindow then sampletime - avg(case when inwindow then sampletime end) over f end as dt,
+					case when inwindow then size - avg(case when inwindow then size end) over f end as dsize
+				from (select sample.fileid, sampletime, sample.size as size, sampletime >= ? as inwindow
+					from sample, file
+					where sample.fileid = file.fileid and file.dirid = ? and invalid is null and
+						(? = 0 or source in (select value from json_each(?))))
+				window f as (partition by fileid))
+			group by fileid`
+)
+
+// reportQuery finds the latest sample of each file, with its growth rate
+// computed by the -rate-mode over all its samples, or those in the
+// -window.  Invalid samples, and those from sources not in -rate-sources,
+// are left out.  Its arguments come from reportOptions.reportArgs.
+func (o reportOptions) reportQuery() string {
+	return o.reportQueryWith("")
+}
+
+// reportQueryWith is reportQuery with more columns after the others, which
+// can refer to file.
+func (o reportOptions) reportQueryWith(cols string) string {
+	// With -on-disk, sizes are the space taken on disk where it's known.
+	size := func(s string) string { return s + ".size" }
+	if o.OnDisk {
+		size = func(s string) string { return "coalesce(" + s + ".disk, " + s + ".size)" }
+	}
+	rate, samples := "("+size("last")+" - "+size("first")+") / cast(t.maxtime - t.mintime AS real)", endpointSamples
+	if o.RateMode == "regression" {
+		rate, samples = "t.slope", strings.Replace(regressionSamples, "sample.size", size("sample"), 1)
+	}
+
+	return `
+select path, last.sampletime, last.mode, ` + size("last") + ` as size, last.mtime,
+		case when t.maxtime - t.mintime >= ` + fmt.Sprint(int64(minRateSpan/time.Second)) + ` then ` + rate + ` end as rate,
+		t.samples` + cols + `
+	from filepaths as file,
+		(` + samples + `) as t,
+		sample as first, sample as last
+	where file.fileid = t.fileid and file.dirid = ?` + nameFilter + ` and
+		first.fileid = t.fileid and first.sampletime = t.mintime and
+		last.fileid = t.fileid and last.sampletime = t.maxtime`
+}
+
+// since returns when the -window starts, or 0 without one.
+func (o reportOptions) since() int64 {
+	if o.Window > 0 {
+		return time.Now().Add(-o.Window).Unix()
+	}
+	return 0
+}
+
+// reportArgs builds the arguments for reportQuery, followed by rest.
+func (o reportOptions) reportArgs(dirid int64, rest ...interface{}) []interface{} {
+	args := []interface{}{o.since(), dirid, len(o.Sources), jsonList(o.Sources)}
+	return append(args, o.filterArgs(dirid, rest...)...)
+}
+
+// getReport ranks the files in dirid for a report and returns the top n.
+func (fdb *fileDB) getReport(dirid int64, kind *reportKind, n int, o reportOptions) *fileIter {
+	// Unlimited reports are streamed rather than cached.
+	if o.NoCache || n < 0 {
+		return fdb.queryReport(dirid, kind, n, o)
+	}
+
+	key := fdb.reportKey(kind, dirid, n, o)
+	if files, ok := fdb.cachedReport(key); ok {
+		return &fileIter{files: files}
+	}
+
+	var files []fileEnt
+	it := fdb.queryReport(dirid, kind, n, o)
+	for it.Next() {
+		files = append(files, *it.File())
+	}
+	fdb.cacheReport(key, files)
+	return &fileIter{files: files}
+}
+
+func (fdb *fileDB) queryReport(dirid int64, kind *reportKind, n int, o reportOptions) *fileIter {
+	args := o.reportArgs(dirid, o.limit(n), o.Offset)
+
+	rows, err := fdb.ro.Query(`select * from (`+o.reportQuery()+`)
+	order by `+kind.order+`, path limit ? offset ?`, args...)
+	fatal(err)
+
+	return newFileIter(rows, n, o.Ties, kind.tie)
+}
+
+// printFiles prints a report's files, reordered by -sort if it was given.
+// Titles aren't printed with csv and json output, so that it can be parsed.
+func printFiles(kind *reportKind, files *fileIter) {
+	if outputFormat != "csv" && outputFormat != "json" {
+		printTitle(kind.title)
+	}
+
+	w := newFileWriter()
+	if sortKey == nil {
+		for files.Next() {
+			w.Write(files.File())
+		}
+	} else {
+		var all []fileEnt
+		for files.Next() {
+			all = append(all, *files.File())
+		}
+		sortKey.sort(all)
+		for i := range all {
+			w.Write(&all[i])
+		}
+	}
+	w.Flush()
+
+	if outputFormat == "text" || outputFormat == "markdown" {
+		fmt.Fprintln(stdout)
+	}
+}
+
+// reportSort is a -sort order for listed files.
+type reportSort struct {
+	less func(a, b *fileEnt) bool
+	desc bool
+}
+
+var sortKeys = map[string]struct {
+	less func(a, b *fileEnt) bool
+	desc bool
+}{
+	"size":    {func(a, b *fileEnt) bool { return a.size < b.size }, true},
+	"mtime":   {func(a, b *fileEnt) bool { return a.mtime.Before(b.mtime) }, false},
+	"rate":    {func(a, b *fileEnt) bool { return a.rate < b.rate }, true},
+	"path":    {func(a, b *fileEnt) bool { return a.path < b.path }, false},
+	"samples": {func(a, b *fileEnt) bool { return a.samples < b.samples }, true},
+}
+
+func parseSort(s string) (*reportSort, error) {
+	name, dir, _ := strings.Cut(s, ":")
+	key, ok := sortKeys[name]
+	if !ok {
+		return nil, fmt.Errorf("can't sort by %q", name)
+	}
+
+	rs := &reportSort{less: key.less, desc: key.desc}
+	switch dir {
+	case "":
+	case "asc":
+		rs.desc = false
+	case "desc":
+		rs.desc = true
+	default:
+		return nil, fmt.Errorf("sort direction must be asc or desc, not %q", dir)
+	}
+	return rs, nil
+}
+
+func (rs *reportSort) sort(files []fileEnt) {
+	sort.SliceStable(files, func(i, j int) bool {
+		if rs.desc {
+			return rs.less(&files[j], &files[i])
+		}
+		return rs.less(&files[i], &files[j])
+	})
+}
+
+// limit is the LIMIT for a query of the top n files, where n < 0 means
+// all of them.  With -include-ties there is none, and the fileIter decides
+// where to stop.
+func (o reportOptions) limit(n int) int {
+	if o.Ties || n < 0 {
+		return -1
+	}
+	return n
+}
+
+// fileIter streams the files of a report from its query, stopping after n
+// of them (plus any ties with the last, with -include-ties), or never if
+// n < 0.  Without a query, it goes through a list of files.
+type fileIter struct {
+	files []fileEnt
+	rows  *sql.Rows
+	n     int
+	count int
+	ties  bool
+	tie   func(a, b *fileEnt) bool
+	cur   fileEnt
+	next  fileEnt
+}
+
+func newFileIter(rows *sql.Rows, n int, ties bool, tie func(a, b *fileEnt) bool) *fileIter {
+	return &fileIter{rows: rows, n: n, ties: ties, tie: tie}
+}
+
+// Next advances to the next file, and closes the query when there are no
+// more.
+func (it *fileIter) Next() bool {
+	if it.rows == nil {
+		if it.count >= len(it.files) {
+			return false
+		}
+		it.cur = it.files[it.count]
+		it.count++
+		return true
+	}
+
+	if !it.rows.Next() {
+		fatal(it.rows.Err())
+		it.Close()
+		return false
+	}
+
+	it.next = fileEnt{}
+	it.next.ScanReport(it.rows)
+
+	if it.n >= 0 && it.count >= it.n && !(it.ties && it.count > 0 && it.tie(&it.cur, &it.next)) {
+		it.Close()
+		return false
+	}
+
+	it.cur = it.next
+	it.count++
+	return true
+}
+
+func (it *fileIter) File() *fileEnt {
+	return &it.cur
+}
+
+func (it *fileIter) Close() {
+	if it.rows != nil {
+		it.rows.Close()
+	}
+}
+
+// ScanReport reads a row of reportQuery.
+func (f *fileEnt) ScanReport(r *sql.Rows) {
+	var when, mtime int64
+	var rate sql.NullFloat64
+	fatal(r.Scan(&f.path, &when, &f.mode, &f.size, &mtime, &rate, &f.samples))
+	f.when = time.Unix(when, 0)
+	f.mtime = time.Unix(mtime, 0)
+	f.rate = rate.Float64
+}
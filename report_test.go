@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSort(t *testing.T) {
+	files := []fileEnt{
+		{path: "b", size: 2, mtime: time.Unix(300, 0), rate: 0.5, samples: 1},
+		{path: "c", size: 3, mtime: time.Unix(100, 0), rate: -1, samples: 3},
+		{path: "a", size: 1, mtime: time.Unix(200, 0), rate: 2, samples: 2},
+	}
+	tests := []struct {
+		s     string
+		order string
+		ok    bool
+	}{
+		{"size", "cba", true},
+		{"size:asc", "abc", true},
+		{"size:desc", "cba", true},
+		{"mtime", "cab", true},
+		{"mtime:desc", "bac", true},
+		{"rate", "abc", true},
+		{"path", "abc", true},
+		{"path:desc", "cba", true},
+		{"samples", "cab", true},
+		{"owner", "", false},
+		{"size:up", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		rs, err := parseSort(tt.s)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseSort(%q) error = %v, want ok %v", tt.s, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		sorted := append([]fileEnt(nil), files...)
+		rs.sort(sorted)
+		order := ""
+		for _, f := range sorted {
+			order += f.path
+		}
+		if order != tt.order {
+			t.Errorf("sorting by %q gave %s, want %s", tt.s, order, tt.order)
+		}
+	}
+}
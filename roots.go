@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "roots",
+		synopsis: "",
+		help:     "Show how each recorded directory was named, what it resolves to now, and the symlinks in between.",
+		run:      runRoots,
+		readOnly: true,
+	})
+}
+
+// retargeted tells whether origPath was recorded as leading somewhere
+// other than canonicalPath, because a symlink along the way has changed.
+func (fdb *fileDB) retargeted(origPath, canonicalPath string) (oldPath string, moved bool) {
+	err := fdb.db.QueryRow(
+		`SELECT dirpath FROM dir WHERE origpath = ? AND dirpath != ? AND `+onHost+` AND
+		NOT EXISTS (SELECT 1 FROM dir WHERE dirpath = ? AND `+onHost+`)`,
+		origPath, canonicalPath, localHost, canonicalPath, localHost).Scan(&oldPath)
+	if err == sql.ErrNoRows {
+		return "", false
+	}
+	fatal(err)
+	return oldPath, true
+}
+
+func runRoots(args []string) {
+	fs := commandFlags("roots")
+	parseFlags(fs, args)
+	needArgs(fs, 0)
+
+	rows, err := cache.db.Query("SELECT dirpath, coalesce(origpath, ''), coalesce(host, '') FROM dir WHERE "+forHost+" ORDER BY dirpath, host",
+		forHostArgs()...)
+	fatal(err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var dirpath, origPath, host string
+		fatal(rows.Scan(&dirpath, &origPath, &host))
+
+		fmt.Fprintln(stdout, dirpath)
+		if host != "" {
+			fmt.Fprintf(stdout, "\thost:\t\t%s\n", host)
+		}
+		// Symlinks can only be followed on the directory's own host.
+		if origPath == "" || strings.Contains(origPath, ":/") || (host != "" && host != localHost) {
+			continue
+		}
+		fmt.Fprintf(stdout, "\tgiven as:\t%s\n", origPath)
+		for _, hop := range symlinkHops(origPath) {
+			fmt.Fprintf(stdout, "\tsymlink:\t%s\n", hop)
+		}
+
+		now, err := filepath.EvalSymlinks(origPath)
+		switch {
+		case err != nil:
+			fmt.Fprintf(stdout, "\tstatus:\t\tmissing (%v)\n", err)
+		case now != dirpath:
+			fmt.Fprintf(stdout, "\tstatus:\t\tretargeted, now leads to %s\n", now)
+			fmt.Fprintf(stdout, "\t\t\tscan it with -rebind to move its history to the new path\n")
+		default:
+			fmt.Fprintf(stdout, "\tstatus:\t\tok\n")
+		}
+	}
+	fatal(rows.Err())
+}
+
+// symlinkHops lists each symlink followed while resolving path.
+func symlinkHops(path string) (hops []string) {
+	cur := "/"
+	for _, part := range strings.Split(filepath.Clean(path), "/") {
+		if part == "" {
+			continue
+		}
+		next := filepath.Join(cur, part)
+		for i := 0; i < 40; i++ {
+			fi, err := os.Lstat(next)
+			if err != nil {
+				return
+			}
+			if fi.Mode()&os.ModeSymlink == 0 {
+				break
+			}
+			target, err := os.Readlink(next)
+			if err != nil {
+				return
+			}
+			hops = append(hops, next+" -> "+target)
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(next), target)
+			}
+			next = filepath.Clean(target)
+		}
+		cur = next
+	}
+	return
+}
+
+// rebindDir moves the directory at oldPath to newPath, still given as
+// origPath, with everything recorded about it, as moveDir does.
+func (fdb *fileDB) rebindDir(oldPath, newPath, origPath string) {
+	var dirid int64
+	fatal(fdb.db.QueryRow("SELECT dirid FROM dir WHERE dirpath = ? AND "+onHost, oldPath, localHost).Scan(&dirid))
+	fdb.moveDir(dirid, newPath, origPath)
+}
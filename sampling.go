@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"math"
+	"strings"
+)
+
+// With -sample, scans walk only a fraction of the subdirectories
+// -sample-depth levels below the directory, and scale up what they find
+// there to estimate the totals, for trees too big to walk often.  The
+// subdirectories are picked by a hash of their paths, so the same ones
+// are walked every time and their growth can be followed.  Files in the
+// rest are neither sampled nor forgotten.
+
+// A scanSample is the part of a directory a sampled scan walks.
+type scanSample struct {
+	fraction float64
+	depth    int
+
+	// skipped are the dirtree paths of the subdirectories left out.
+	skipped []string
+
+	// Files above depth are all walked, and those below it sampled.
+	files, bytes               int64
+	sampledFiles, sampledBytes int64
+}
+
+// newScanSample returns the sample -sample asks for, or nil for all of
+// it.
+func newScanSample() *scanSample {
+	if sampleFraction <= 0 || sampleFraction >= 1 {
+		return nil
+	}
+	return &scanSample{fraction: sampleFraction, depth: sampleDepth}
+}
+
+// sampledScans adds the fraction walked by each scan, which is NULL for
+// those that walked everything.
+func sampledScans(tx *sql.Tx) {
+	addColumn(tx, "scan", "fraction", "real")
+}
+
+func treeDepth(path string) int {
+	if path == "" {
+		return 0
+	}
+	return strings.Count(path, "/") + 1
+}
+
+// enter tells whether to walk the directory at a dirtree path.
+func (s *scanSample) enter(path string) bool {
+	if treeDepth(path) != s.depth {
+		return true
+	}
+	h := sha256.Sum256([]byte(path))
+	if float64(binary.BigEndian.Uint64(h[:])) < s.fraction*math.MaxUint64 {
+		return true
+	}
+	s.skipped = append(s.skipped, path)
+	return false
+}
+
+// add counts a file in the directory at a dirtree path.
+func (s *scanSample) add(dir string, size int64) {
+	if treeDepth(dir) >= s.depth {
+		s.sampledFiles++
+		s.sampledBytes += size
+	} else {
+		s.files++
+		s.bytes += size
+	}
+}
+
+// keepUnsampled marks the files recorded in the subdirectories a sampled
+// scan skipped as found by it, so they aren't taken for vanished.
+func (fdb *fileDB) keepUnsampled(dirid, scanid int64, s *scanSample) {
+	tx, err := fdb.db.Begin()
+	fatal(err)
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(
+		`UPDATE file SET lastscan = ? WHERE treeid IN (
+			SELECT treeid FROM dirtree WHERE dirid = ? AND (path = ? OR (path > ? || '/' AND path < ? || '0')))`)
+	fatal(err)
+	for _, path := range s.skipped {
+		_, err = stmt.Exec(scanid, dirid, path, path, path)
+		fatal(err)
+	}
+	fatal(tx.Commit())
+}
+
+// recordEstimate replaces the totals of a sampled scan with those scaled
+// up from the sample.
+func (fdb *fileDB) recordEstimate(scanid int64, s *scanSample) {
+	files := s.files + int64(math.Round(float64(s.sampledFiles)/s.fraction))
+	bytes := s.bytes + int64(math.Round(float64(s.sampledBytes)/s.fraction))
+	_, err := fdb.db.Exec("UPDATE scan SET files = ?, bytes = ?, fraction = ? WHERE rowid = ?", files, bytes, s.fraction, scanid)
+	fatal(err)
+}
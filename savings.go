@@ -0,0 +1,175 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "savings",
+		synopsis: "<dir>",
+		help:     "Estimate the space under dir already saved by hard links, and by extents shared with reflinked copies (see -reflinks), and how much more deduplicating the identical files left (see -hash) would save, listing the biggest sets of them.",
+		run:      runSavings,
+		readOnly: true,
+	})
+}
+
+// linkCounts adds each file's device and inode, how many hard links it
+// has, and with -reflinks how much of it is in extents shared with other
+// files, as of its latest sample.
+func linkCounts(tx *sql.Tx) {
+	addColumn(tx, "file", "dev", "integer")
+	addColumn(tx, "file", "ino", "integer")
+	addColumn(tx, "file", "nlink", "integer")
+	addColumn(tx, "file", "shared", "integer")
+}
+
+// savingsFile is the latest sample of a file, with what's known of what it
+// shares with others.
+type savingsFile struct {
+	path   string
+	size   int64
+	hash   sql.NullString
+	id     inode
+	known  bool
+	nlink  int64
+	shared int64
+}
+
+// dupSet is a set of files with the same contents but on separate inodes,
+// which deduplicating would make into one.
+type dupSet struct {
+	size  int64
+	paths []string
+	// more is the space deduplicating them would save.
+	more int64
+}
+
+type savingsEnt struct {
+	linkedFiles int64
+	linked      int64
+	// outside counts the files here with hard links outside dir too.
+	outside int64
+	shared  int64
+	dups    []*dupSet
+	more    int64
+}
+
+func runSavings(args []string) {
+	fs := commandFlags("savings")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	dirid, root := cache.findDir(fs.Arg(0))
+	s := savings(cache.getSavingsFiles(dirid, opts))
+
+	if outputFormat != "csv" && outputFormat != "json" {
+		printTitle("SAVINGS UNDER " + root)
+		fmt.Fprintf(stdout, "Hard links save %sB in %d files", strings.TrimSpace(niceSize(s.linked)), s.linkedFiles)
+		if s.outside > 0 {
+			fmt.Fprintf(stdout, ", and %d files have links outside it too", s.outside)
+		}
+		fmt.Fprintf(stdout, "\nShared extents, of reflinks and snapshots, save %sB\n", strings.TrimSpace(niceSize(s.shared)))
+		fmt.Fprintf(stdout, "Deduplicating %d sets of identical files would save %sB more\n", len(s.dups), strings.TrimSpace(niceSize(s.more)))
+	}
+	w := newRowWriter(stdout)
+	w.Header([]string{"saves", "size", "copies", "path"})
+	for i, d := range s.dups {
+		if listSize >= 0 && i >= listSize {
+			break
+		}
+		more, size := interface{}(d.more), interface{}(d.size)
+		if outputFormat == "text" || outputFormat == "markdown" || outputFormat == "html" {
+			more = strings.TrimSpace(niceSize(d.more)) + "B"
+			size = strings.TrimSpace(niceSize(d.size)) + "B"
+		}
+		w.Row([]interface{}{more, size, len(d.paths), d.paths[0]})
+	}
+	w.Flush()
+}
+
+// savings works out what files save by sharing, and what identical files
+// not yet sharing would.  A file on an inode seen before saves its whole
+// size.  Reflinked extents are counted once, with the file they're in,
+// which undercounts when they're shared with files outside dir, and
+// overcounts when only snapshots share them.
+func savings(files []savingsFile) *savingsEnt {
+	s := &savingsEnt{}
+	inodes, links := make(map[inode]int64), make(map[inode]int64)
+	byHash := make(map[string]*dupSet)
+	for _, f := range files {
+		if f.known {
+			inodes[f.id]++
+			links[f.id] = f.nlink
+			if inodes[f.id] > 1 {
+				s.linkedFiles++
+				s.linked += f.size
+				continue
+			}
+		}
+		s.shared += f.shared
+
+		if !f.hash.Valid || f.size == 0 {
+			continue
+		}
+		key := fmt.Sprintf("%s:%d", f.hash.String, f.size)
+		d := byHash[key]
+		if d == nil {
+			d = &dupSet{size: f.size}
+			byHash[key] = d
+		} else {
+			// Only what isn't already shared would be saved.
+			d.more += f.size - f.shared
+		}
+		d.paths = append(d.paths, f.path)
+	}
+	for id, n := range inodes {
+		if links[id] > n {
+			s.outside++
+		}
+	}
+
+	for _, d := range byHash {
+		if len(d.paths) > 1 && d.more > 0 {
+			s.dups = append(s.dups, d)
+			s.more += d.more
+		}
+	}
+	sort.Slice(s.dups, func(i, j int) bool {
+		if s.dups[i].more != s.dups[j].more {
+			return s.dups[i].more > s.dups[j].more
+		}
+		return s.dups[i].paths[0] < s.dups[j].paths[0]
+	})
+	return s
+}
+
+// getSavingsFiles lists the latest sample of each file in dirid, with its
+// hash if that's of its contents as they are, and its inode.
+func (fdb *fileDB) getSavingsFiles(dirid int64, o reportOptions) (result []savingsFile) {
+	rows, err := fdb.ro.Query(
+		`select path, size, hash, dev, ino, nlink, shared from (`+o.reportQueryWith(`,
+			case when file.hashsize = last.size and file.hashmtime = last.mtime then file.hash end as hash,
+			file.dev as dev, file.ino as ino, file.nlink as nlink, coalesce(file.shared, 0) as shared`)+`)
+		order by path`,
+		o.reportArgs(dirid)...)
+	fatal(err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var f savingsFile
+		var dev, ino, nlink sql.NullInt64
+		fatal(rows.Scan(&f.path, &f.size, &f.hash, &dev, &ino, &nlink, &f.shared))
+		f.id, f.known = inode{uint64(dev.Int64), uint64(ino.Int64)}, dev.Valid && ino.Valid
+		f.nlink = nlink.Int64
+		if f.shared > f.size {
+			f.shared = f.size
+		}
+		result = append(result, f)
+	}
+	fatal(rows.Err())
+	return
+}
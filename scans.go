@@ -0,0 +1,66 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"time"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "scans",
+		synopsis: "<dir>",
+		help:     "List the recent scans of dir: when, how long, what they found and changed, and how many errors they hit.",
+		run:      runScans,
+		readOnly: true,
+	})
+}
+
+func runScans(args []string) {
+	fs := commandFlags("scans")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	dirid, _ := cache.findDir(fs.Arg(0))
+	rows, err := cache.ro.Query(
+		`SELECT started, finished, duration, files, bytes, added, removed, changed, errors, fraction
+		FROM scan WHERE dirid = ? ORDER BY started DESC LIMIT ?`, dirid, listSize)
+	fatal(err)
+	defer rows.Close()
+
+	w := newRowWriter(stdout)
+	w.Header([]string{"started", "finished", "seconds", "files", "bytes", "added", "removed", "changed", "errors", "sampled"})
+	for rows.Next() {
+		var started int64
+		var finished, files, bytes, added, removed, changed, errs sql.NullInt64
+		var duration, fraction sql.NullFloat64
+		fatal(rows.Scan(&started, &finished, &duration, &files, &bytes, &added, &removed, &changed, &errs, &fraction))
+
+		end := "incomplete"
+		if finished.Valid {
+			end = time.Unix(finished.Int64, 0).Format(time.RFC3339)
+		}
+		w.Row([]interface{}{time.Unix(started, 0).Format(time.RFC3339), end,
+			nullFloat(duration, 3), nullInt(files), nullInt(bytes), nullInt(added),
+			nullInt(removed), nullInt(changed), nullInt(errs), nullFloat(fraction, 4)})
+	}
+	fatal(rows.Err())
+	w.Flush()
+}
+
+// nullInt and nullFloat turn missing values, such as those of scans
+// recorded by older versions, into empty cells.
+func nullInt(n sql.NullInt64) interface{} {
+	if !n.Valid {
+		return nil
+	}
+	return n.Int64
+}
+
+func nullFloat(f sql.NullFloat64, places int) interface{} {
+	if !f.Valid {
+		return nil
+	}
+	p := math.Pow10(places)
+	return math.Round(f.Float64*p) / p
+}
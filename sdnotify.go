@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Under systemd, with Type=notify, the daemon says when it's ready and
+// what it's doing, and pings the watchdog if WatchdogSec is set.
+
+// sdNotify sends a state change to systemd, if it's listening.
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	addr := &net.UnixAddr{Name: socket, Net: "unixgram"}
+	if socket[0] == '@' {
+		// An abstract socket.
+		addr.Name = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.Write([]byte(state))
+}
+
+// watchdogInterval is how often to ping systemd's watchdog, half the
+// interval it asks for, or 0 if it isn't watching this process.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// sdWatchdog pings systemd's watchdog every interval while a scan is
+// getting somewhere, finding or recording files, so that one stuck is
+// restarted.  The daemon pings it itself while idle.
+func sdWatchdog(interval time.Duration) {
+	last := int64(-1)
+	for range time.Tick(interval) {
+		if n, scanning := progress.count(); scanning && n != last {
+			sdNotify("WATCHDOG=1")
+			last = n
+		}
+	}
+}
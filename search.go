@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "search",
+		synopsis: "<words>",
+		help:     "List the files whose paths contain all the words, biggest first, using the path index (see db index).  A word ending in * matches any word it begins, and words in double quotes must be next to each other.",
+		run:      runSearch,
+		readOnly: true,
+	})
+}
+
+// The path index is a full-text index of every file's path, keyed by
+// fileid, for finding files by name among millions far quicker than LIKE
+// can.  It's optional, since it about doubles the size of the database;
+// once made, scans keep it up to date.
+
+// hasPathIndex tells whether the path index has been made.
+func (fdb *fileDB) hasPathIndex() bool {
+	var n int
+	fatal(fdb.ro.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = 'pathindex'").Scan(&n))
+	return n > 0
+}
+
+// buildPathIndex makes the path index afresh.
+func (fdb *fileDB) buildPathIndex() (files int64) {
+	tx, err := fdb.db.Begin()
+	fatal(err)
+	defer tx.Rollback()
+	_, err = tx.Exec("DROP TABLE IF EXISTS pathindex")
+	fatal(err)
+	_, err = tx.Exec(fmt.Sprintf("CREATE VIRTUAL TABLE pathindex USING %s(path)", ftsModule))
+	fatal(err)
+	res, err := tx.Exec("INSERT INTO pathindex (rowid, path) SELECT fileid, path FROM filepaths")
+	fatal(err)
+	files, err = res.RowsAffected()
+	fatal(err)
+	fatal(tx.Commit())
+	return
+}
+
+func (fdb *fileDB) dropPathIndex() {
+	_, err := fdb.db.Exec("DROP TABLE IF EXISTS pathindex")
+	fatal(err)
+}
+
+func runIndex(drop bool) {
+	var err error
+	cache, err = newFileDB(dbPath)
+	fatal(err)
+	defer cache.close()
+	if drop {
+		cache.dropPathIndex()
+		return
+	}
+	fmt.Fprintf(stdout, "Indexed %d paths\n", cache.buildPathIndex())
+}
+
+// unindexVanished removes the files in dirid that scanid didn't find from
+// the path index, if there is one, before they're deleted.
+func (fdb *fileDB) unindexVanished(dirid, scanid int64) {
+	if !fdb.hasPathIndex() {
+		return
+	}
+	_, err := fdb.db.Exec(
+		"DELETE FROM pathindex WHERE rowid IN (SELECT fileid FROM file WHERE dirid = ? AND lastscan IS NOT ?)",
+		dirid, scanid)
+	fatal(err)
+}
+
+// indexNew adds the files in dirid that aren't in the path index yet, if
+// there is one.
+func (fdb *fileDB) indexNew(dirid int64) {
+	if !fdb.hasPathIndex() {
+		return
+	}
+	_, err := fdb.db.Exec(
+		`INSERT INTO pathindex (rowid, path) SELECT fileid, path FROM filepaths
+		WHERE dirid = ? AND fileid NOT IN (SELECT rowid FROM pathindex)`, dirid)
+	fatal(err)
+}
+
+func runSearch(args []string) {
+	fs := commandFlags("search")
+	parseFlags(fs, args)
+	if fs.NArg() == 0 {
+		badUsage(fs)
+	}
+	if !cache.hasPathIndex() {
+		fatal(fmt.Errorf("there's no path index to search; make one with \"filebase db index\""))
+	}
+
+	qargs := append([]interface{}{strings.Join(fs.Args(), " ")}, forHostArgs()...)
+	rows, err := cache.ro.Query(
+		`select file.path, sampletime, mode, size, mtime from pathindex, filepaths as file, sample, dir
+		where pathindex match ? and file.fileid = pathindex.rowid and
+			dir.dirid = file.dirid and `+forHost+` and
+			file.fileid = sample.fileid and
+			sample.sampletime =	(
+				select max(sampletime) from sample where file.fileid=sample.fileid and invalid is null
+				)
+		order by size desc, file.path
+		limit ?`, append(qargs, listSize)...)
+	fatal(err)
+	defer rows.Close()
+
+	w := newFileWriter()
+	for rows.Next() {
+		var f fileEnt
+		f.Scan(rows)
+		w.Write(&f)
+	}
+	fatal(rows.Err())
+	w.Flush()
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "selftest",
+		synopsis: "",
+		help:     "Build a synthetic tree, scan it repeatedly while changing it, and check and time the results.",
+		run:      runSelftest,
+		noDB:     true,
+	})
+}
+
+// simTree is a synthetic directory tree, along with what filebase should
+// have recorded about it after the latest scan.
+type simTree struct {
+	root  string
+	rnd   *rand.Rand
+	dirs  int
+	size  int64
+	next  int
+	files map[string]int64
+
+	// grown holds every file that has grown since it was first scanned.
+	grown map[string]bool
+}
+
+func runSelftest(args []string) {
+	fs := commandFlags("selftest")
+	nFiles := fs.Int("files", 10000, "Number of files to start with.")
+	nDirs := fs.Int("dirs", 100, "Number of directories to spread them over.")
+	scans := fs.Int("scans", 3, "Number of scans to run.")
+	change := fs.Float64("change", 0.05, "Fraction of files grown, and of files deleted, and new files created, between scans.")
+	maxSize := byteSize(1e6)
+	fs.Var(&maxSize, "size", "Largest file to create.  Files are sparse, so this costs no space.")
+	where := fs.String("dir", os.TempDir(), "Where to build the tree.")
+	keep := fs.Bool("keep", false, "Keep the tree and its database afterwards.")
+	seed := fs.Int64("seed", 1, "Random seed, to repeat a run.")
+	parseFlags(fs, args)
+	needArgs(fs, 0)
+
+	tmp, err := os.MkdirTemp(*where, "filebase-selftest-")
+	fatal(err)
+	if *keep {
+		fmt.Fprintln(stdout, "Keeping", tmp)
+	} else {
+		defer os.RemoveAll(tmp)
+	}
+
+	sim := &simTree{
+		root:  filepath.Join(tmp, "tree"),
+		rnd:   rand.New(rand.NewSource(*seed)),
+		dirs:  *nDirs,
+		size:  int64(maxSize),
+		files: make(map[string]int64),
+		grown: make(map[string]bool),
+	}
+	fatal(os.Mkdir(sim.root, 0755))
+
+	start := time.Now()
+	for i := 0; i < *nFiles; i++ {
+		sim.create()
+	}
+	fmt.Fprintf(stdout, "Created %d files in %v\n", *nFiles, time.Since(start).Round(time.Millisecond))
+
+	fdb, err := newFileDB(filepath.Join(tmp, "selftest.sqlite3"))
+	fatal(err)
+	defer fdb.close()
+	dirid := fdb.getDirID(sim.root)
+
+	// The scans are only seconds apart.
+	minRateSpan = time.Second
+
+	failed := false
+	for scan := 1; scan <= *scans; scan++ {
+		if scan > 1 {
+			sim.change(*change)
+		}
+
+		// Samples are keyed by the second they're taken in.
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+		start := time.Now()
+		fatal(fdb.scanDir(dirid))
+		elapsed := time.Since(start)
+		fmt.Fprintf(stdout, "Scan %d: %d files in %v (%.0f files/sec)\n",
+			scan, len(sim.files), elapsed.Round(time.Millisecond), float64(len(sim.files))/elapsed.Seconds())
+
+		for _, problem := range sim.check(fdb, dirid) {
+			fmt.Fprintf(stdout, "\tFAIL: %s\n", problem)
+			failed = true
+		}
+	}
+
+	if failed {
+		fatal(exitStatus(1))
+	}
+	fmt.Fprintln(stdout, "PASS")
+}
+
+func (sim *simTree) create() {
+	dir := filepath.Join(sim.root, fmt.Sprintf("d%03d", sim.rnd.Intn(sim.dirs)))
+	fatal(os.MkdirAll(dir, 0755))
+	path := filepath.Join(dir, fmt.Sprintf("f%07d", sim.next))
+	sim.next++
+	sim.resize(path, sim.rnd.Int63n(sim.size+1))
+}
+
+func (sim *simTree) resize(path string, size int64) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	fatal(err)
+	fatal(f.Truncate(size))
+	fatal(f.Close())
+	sim.files[path] = size
+}
+
+// change grows, deletes and creates a fraction of the files each.
+func (sim *simTree) change(fraction float64) {
+	n := int(float64(len(sim.files)) * fraction)
+
+	paths := make([]string, 0, len(sim.files))
+	for path := range sim.files {
+		paths = append(paths, path)
+	}
+	sim.rnd.Shuffle(len(paths), func(i, j int) { paths[i], paths[j] = paths[j], paths[i] })
+
+	for _, path := range paths[:n] {
+		sim.resize(path, sim.files[path]+1+sim.rnd.Int63n(sim.size+1))
+		sim.grown[path] = true
+	}
+	for _, path := range paths[n : 2*n] {
+		fatal(os.Remove(path))
+		delete(sim.files, path)
+		delete(sim.grown, path)
+	}
+	for i := 0; i < n; i++ {
+		sim.create()
+	}
+}
+
+// check compares what was recorded with what's on disk.
+func (sim *simTree) check(fdb *fileDB, dirid int64) (problems []string) {
+	var total int64
+	for _, size := range sim.files {
+		total += size
+	}
+
+	var files, bytes int64
+	err := fdb.db.QueryRow(
+		`SELECT count(*), coalesce(sum(size), 0) FROM file, sample
+		WHERE file.fileid = sample.fileid AND file.dirid = ? AND
+		sampletime = (SELECT max(sampletime) FROM sample WHERE sample.fileid = file.fileid)`,
+		dirid).Scan(&files, &bytes)
+	fatal(err)
+	if files != int64(len(sim.files)) {
+		problems = append(problems, fmt.Sprintf("recorded %d files, expected %d", files, len(sim.files)))
+	}
+	if bytes != total {
+		problems = append(problems, fmt.Sprintf("recorded %d bytes, expected %d", bytes, total))
+	}
+
+	if len(sim.grown) == 0 {
+		return
+	}
+	fastest := fdb.getReport(dirid, fastestReport, len(sim.grown), reportOptions{NoCache: true})
+	for fastest.Next() {
+		if f := fastest.File(); !sim.grown[f.path] {
+			problems = append(problems, fmt.Sprintf("%s ranked as growing at %.0f bytes/sec, but didn't grow", f.path, f.rate))
+		}
+	}
+	return
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "shared",
+		synopsis: "<dir> <dir>",
+		help:     "List the biggest files found under both dirs, by name and size, such as copies kept in an archive.",
+		run:      runShared,
+		readOnly: true,
+	})
+}
+
+// copyKey is what two files must share to be taken for copies.
+type copyKey struct {
+	name string
+	size int64
+}
+
+func runShared(args []string) {
+	fs := commandFlags("shared")
+	parseFlags(fs, args)
+	needArgs(fs, 2)
+
+	dirA, pathA := cache.findDir(fs.Arg(0))
+	dirB, pathB := cache.findDir(fs.Arg(1))
+
+	others := make(map[copyKey][]string)
+	for _, f := range cache.filesUnder(dirB, pathB) {
+		k := copyKey{filepath.Base(f.path), f.size}
+		others[k] = append(others[k], f.path)
+	}
+
+	printTitle("BIGGEST SHARED FILES")
+	t := newTableWriter()
+	listed := 0
+	for _, f := range cache.filesUnder(dirA, pathA) {
+		if listSize >= 0 && listed >= listSize {
+			break
+		}
+		copies := others[copyKey{filepath.Base(f.path), f.size}]
+		for _, other := range copies {
+			if other != f.path {
+				t.File(f.path, fmt.Sprintf("%v\t%s\t%s", sizeColumns(f.size), f.path, other), "")
+			}
+		}
+		if len(copies) > 0 {
+			listed++
+		}
+	}
+	t.Flush()
+	endReport()
+}
+
+// filesUnder returns the latest sample of each file below path, biggest
+// first.
+func (fdb *fileDB) filesUnder(dirid int64, path string) []fileEnt {
+	args := append([]interface{}{dirid}, underPathArgs(path)...)
+	rows, err := fdb.ro.Query(
+		`select path, sampletime, mode, size, mtime from filepaths as file, sample
+		where file.fileid=sample.fileid and
+			file.dirid = ? and `+underPath+` and size > 0 and
+			sample.sampletime =	(
+				select max(sampletime) from sample where file.fileid=sample.fileid and invalid is null
+				)
+		order by size desc, path`, args...)
+	fatal(err)
+	defer rows.Close()
+
+	var result []fileEnt
+	for rows.Next() {
+		var f fileEnt
+		f.Scan(rows)
+		result = append(result, f)
+	}
+	fatal(rows.Err())
+	return result
+}
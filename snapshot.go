@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Filesystem snapshots show every file again under another path, once for
+// each snapshot, so scanning them multiplies the space a directory seems
+// to take.  -snapshots skip leaves them out of scans, and -snapshots mark
+// records their files with the source "snapshot", so that -rate-sources
+// can leave them out of reports instead.  Snapshots are found by name,
+// as with ZFS's .zfs/snapshot, NetApp's .snapshot and snapper's
+// .snapshots, and on Linux as btrfs subvolumes made from another.
+const (
+	snapshotsSkip = "skip"
+	snapshotsMark = "mark"
+)
+
+func parseSnapshots(s string) (string, error) {
+	if s != snapshotsSkip && s != snapshotsMark {
+		return "", fmt.Errorf("%q isn't skip or mark", s)
+	}
+	return s, nil
+}
+
+// snapshotDir tells whether the directory at path holds snapshots, or is
+// one.
+func snapshotDir(path string, info os.FileInfo) bool {
+	switch info.Name() {
+	case ".snapshot", ".snapshots":
+		return true
+	case "snapshot":
+		if filepath.Base(filepath.Dir(path)) == ".zfs" {
+			return true
+		}
+	}
+	return btrfsSnapshot(path, info)
+}
+
+// inSnapshot tells whether path is below one of the snapshot directories
+// in roots.
+func inSnapshot(roots []string, path string) bool {
+	for _, r := range roots {
+		if strings.HasPrefix(path, r+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// scanSource is the source of a scan's sample of the file at path.
+func scanSource(w *walker, path string) string {
+	if inSnapshot(w.snapshots, path) {
+		return sourceSnapshot
+	}
+	return sourceScan
+}
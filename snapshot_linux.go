@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	btrfsMagic = 0x9123683e
+	// btrfsSubvolRoot is the inode number of the top of every subvolume.
+	btrfsSubvolRoot = 256
+	// btrfsGetSubvolInfo is BTRFS_IOC_GET_SUBVOL_INFO, which needs no
+	// privileges.
+	btrfsGetSubvolInfo = 0x81f8943c
+)
+
+// btrfsSubvolInfo is struct btrfs_ioctl_get_subvol_info_args, as far as
+// parent_uuid, padded to its full size.
+type btrfsSubvolInfo struct {
+	treeID     uint64
+	name       [256]byte
+	parentID   uint64
+	dirID      uint64
+	generation uint64
+	flags      uint64
+	uuid       [16]byte
+	parentUUID [16]byte
+	rest       [176]byte
+}
+
+// btrfsSnapshot tells whether the directory at path is the top of a btrfs
+// subvolume made as a snapshot of another, which is what gives it a
+// parent uuid.
+func btrfsSnapshot(path string, info os.FileInfo) bool {
+	if st, ok := info.Sys().(*syscall.Stat_t); !ok || st.Ino != btrfsSubvolRoot {
+		return false
+	}
+	var fs syscall.Statfs_t
+	if syscall.Statfs(path, &fs) != nil || fs.Type != btrfsMagic {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	var args btrfsSubvolInfo
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), btrfsGetSubvolInfo, uintptr(unsafe.Pointer(&args))); errno != 0 {
+		return false
+	}
+	return args.parentUUID != [16]byte{}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+func btrfsSnapshot(path string, info os.FileInfo) bool {
+	return false
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Sample sources, recorded with each sample so that samples from less
+// trustworthy ingestion paths can be told apart.
+const (
+	sourceScan   = "scan"
+	sourceWatch  = "watch"
+	sourceImport = "import"
+	sourceAgent  = "agent"
+	// sourceSnapshot is a scan's sample of a file in a snapshot, with
+	// -snapshots mark.
+	sourceSnapshot = "snapshot"
+)
+
+var knownSources = []string{sourceScan, sourceWatch, sourceImport, sourceAgent, sourceSnapshot}
+
+func parseSources(s string) (sources []string, err error) {
+	for _, src := range strings.Split(s, ",") {
+		src = strings.TrimSpace(src)
+		if src == "" {
+			continue
+		}
+		known := false
+		for _, k := range knownSources {
+			known = known || src == k
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown sample source %q", src)
+		}
+		sources = append(sources, src)
+	}
+	return
+}
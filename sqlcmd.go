@@ -0,0 +1,69 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "sql",
+		synopsis: "<query>",
+		help:     "Run a query against a read-only connection to the database and print the results.",
+		run:      runSQL,
+		noDB:     true,
+	})
+}
+
+// readOnlyDSN opens path so that nothing can be written to it, by this
+// connection or through ATTACH.
+func readOnlyDSN(path string) string {
+	return dsn(path, "mode=ro&_query_only=1")
+}
+
+// dsn is a URI naming the database at path, with the given parameters.
+func dsn(path, params string) string {
+	escaped := strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(path)
+	return "file:" + escaped + "?" + params
+}
+
+func runSQL(args []string) {
+	fs := commandFlags("sql")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	db := openReadOnly()
+	defer db.Close()
+
+	printQuery(db, fs.Arg(0))
+}
+
+func openReadOnly() *sql.DB {
+	db, err := sql.Open("sqlite3", readOnlyDSN(dbPath))
+	fatal(err)
+	return db
+}
+
+// printQuery prints the results of any query in the chosen -format.
+func printQuery(db *sql.DB, query string, args ...interface{}) {
+	rows, err := db.Query(query, args...)
+	fatal(err)
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	fatal(err)
+
+	w := newRowWriter(stdout)
+	w.Header(cols)
+	vals := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	for rows.Next() {
+		fatal(rows.Scan(ptrs...))
+		w.Row(vals)
+	}
+	fatal(rows.Err())
+	w.Flush()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"time"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "stale",
+		synopsis: "[-bigger size] [-older age] [-paths] <dir>",
+		help:     "List big files that haven't been modified in a long time, the candidates for archiving.",
+		run:      runStale,
+		readOnly: true,
+	})
+}
+
+var staleReport = &reportKind{"STALE LARGE FILES", "size DESC", sameSize}
+
+func runStale(args []string) {
+	fs := commandFlags("stale")
+	bigger := byteSize(1e9)
+	fs.Var(&bigger, "bigger", "Only list files at least this big.")
+	older := fs.String("older", "180d", "Only list files last modified at least this long ago.")
+	paths := fs.Bool("paths", false, "Print only the paths, one per line, such as for xargs.  Use -all to get every one.")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	age, err := parseAge(*older)
+	if err != nil {
+		usagef("invalid -older %q", *older)
+	}
+
+	dirid, _ := cache.findDir(fs.Arg(0))
+	files := cache.queryStale(dirid, int64(bigger), time.Now().Add(-age), listSize, opts)
+	if !*paths {
+		printFiles(staleReport, files)
+		return
+	}
+
+	w := bufio.NewWriter(stdout)
+	for files.Next() {
+		fmt.Fprintln(w, files.File().path)
+	}
+	fatal(w.Flush())
+}
+
+// queryStale ranks the files in dirid at least minSize bytes and last
+// modified before cutoff, biggest first.
+func (fdb *fileDB) queryStale(dirid, minSize int64, cutoff time.Time, n int, o reportOptions) *fileIter {
+	args := o.reportArgs(dirid, minSize, cutoff.Unix(), o.limit(n), o.Offset)
+
+	rows, err := fdb.ro.Query(`select * from (`+o.reportQuery()+`)
+	where size >= ? and mtime < ?
+	order by `+staleReport.order+`, path limit ? offset ?`, args...)
+	fatal(err)
+
+	return newFileIter(rows, n, o.Ties, staleReport.tie)
+}
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+import "errors"
+
+func fsCapacity(path string) (c capacity, err error) {
+	return c, errors.New("filesystem capacity is not supported on this platform")
+}
+
+func fsDevice(path string) (int64, error) {
+	return 0, errors.New("device numbers are not supported on this platform")
+}
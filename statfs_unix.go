@@ -0,0 +1,28 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import "syscall"
+
+// fsCapacity finds the size of the filesystem holding path, and how much
+// of it is free to ordinary users, in bytes and in inodes.
+func fsCapacity(path string) (c capacity, err error) {
+	var st syscall.Statfs_t
+	if err = syscall.Statfs(path, &st); err != nil {
+		return
+	}
+	c.total = int64(st.Blocks) * int64(st.Bsize)
+	c.free = int64(st.Bavail) * int64(st.Bsize)
+	c.inodes = int64(st.Files)
+	c.freeInodes = int64(st.Ffree)
+	return
+}
+
+// fsDevice finds the device number of the filesystem holding path.
+func fsDevice(path string) (int64, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Dev), nil
+}
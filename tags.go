@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "tag",
+		synopsis: "add <tag> <path>... | remove <tag> <path>... | list [tag]",
+		help:     "Label files and directories, and everything under the directories, so that reports can pick them out with -tag or leave them out with -exclude-tag.",
+		run:      runTag,
+	})
+}
+
+// tags adds the table of tagged paths.
+func tags(tx *sql.Tx) {
+	_, err := tx.Exec(`
+CREATE TABLE IF NOT EXISTS tag (
+        name text,
+        path text,
+        PRIMARY KEY (name, path)
+);`)
+	fatal(err)
+}
+
+// tagFilter is the part of nameFilter applying -tag and -exclude-tag.
+const tagFilter = `
+			and (? = 0 or exists (select 1 from tag, json_each(?) as want
+				where tag.name = want.value and
+					(file.path = tag.path or substr(file.path, 1, length(tag.path) + 1) = tag.path || '/')))
+			and not exists (select 1 from tag, json_each(?) as unwanted
+				where tag.name = unwanted.value and
+					(file.path = tag.path or substr(file.path, 1, length(tag.path) + 1) = tag.path || '/'))`
+
+func runTag(args []string) {
+	fs := commandFlags("tag")
+	parseFlags(fs, args)
+
+	switch fs.Arg(0) {
+	case "add", "remove":
+		if fs.NArg() < 3 {
+			badUsage(fs)
+		}
+		name := fs.Arg(1)
+		for _, p := range fs.Args()[2:] {
+			_, path := cache.findDir(p)
+			path = strings.TrimSuffix(path, "/")
+			if fs.Arg(0) == "add" {
+				cache.addTag(name, path)
+			} else if !cache.removeTag(name, path) {
+				fmt.Fprintf(os.Stderr, "%s isn't tagged %s\n", path, name)
+			}
+		}
+		cache.changed()
+	case "list":
+		if fs.NArg() > 2 {
+			badUsage(fs)
+		}
+		w := newRowWriter(stdout)
+		w.Header([]string{"tag", "path"})
+		for _, t := range cache.listTags(fs.Arg(1)) {
+			w.Row([]interface{}{t[0], t[1]})
+		}
+		w.Flush()
+	default:
+		badUsage(fs)
+	}
+}
+
+func (fdb *fileDB) addTag(name, path string) {
+	_, err := fdb.db.Exec("INSERT OR IGNORE INTO tag (name, path) VALUES (?, ?)", name, path)
+	fatal(err)
+}
+
+func (fdb *fileDB) removeTag(name, path string) bool {
+	res, err := fdb.db.Exec("DELETE FROM tag WHERE name = ? AND path = ?", name, path)
+	fatal(err)
+	n, err := res.RowsAffected()
+	fatal(err)
+	return n > 0
+}
+
+// listTags returns the tagged paths, with their tags, for one tag or all.
+func (fdb *fileDB) listTags(name string) (result [][2]string) {
+	rows, err := fdb.db.Query("SELECT name, path FROM tag WHERE ? = '' OR name = ? ORDER BY name, path", name, name)
+	fatal(err)
+	defer rows.Close()
+	for rows.Next() {
+		var t [2]string
+		fatal(rows.Scan(&t[0], &t[1]))
+		result = append(result, t)
+	}
+	fatal(rows.Err())
+	return
+}
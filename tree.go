@@ -0,0 +1,178 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+)
+
+// Files are recorded by name within a row of dirtree for the directory
+// holding them, rather than by full path, which saves a lot of space in
+// deep trees, and lets directories be totalled up with a join.  dirtree
+// paths are relative to the scanned directory, with "" for the directory
+// itself, so that when it moves only its dir row has to change.  The
+// filepaths view puts full paths back together.
+
+type treeKey struct {
+	dirid int64
+	path  string
+}
+
+// treePath is the dirtree path of dir, within the scanned directory root.
+func treePath(root, dir string) string {
+	rel, err := filepath.Rel(root, dir)
+	fatal(err)
+	if rel == "." {
+		return ""
+	}
+	return rel
+}
+
+// treeID finds the dirtree row for the directory at path, within dirid,
+// adding one if need be.
+func (fdb *fileDB) treeID(tx *sql.Tx, dirid int64, path string) (treeid int64) {
+	key := treeKey{dirid, path}
+	if treeid, ok := fdb.treeIDs[key]; ok {
+		return treeid
+	}
+
+	fatal(tx.Stmt(fdb.upsertTree).QueryRow(dirid, path).Scan(&treeid))
+	fdb.treeIDs[key] = treeid
+	return
+}
+
+// pruneTree deletes the dirtree rows in dirid that no longer hold any
+// files.
+func (fdb *fileDB) pruneTree(dirid int64) {
+	fdb.write(func(tx *batch) {
+		_, err := tx.Exec(
+			"DELETE FROM dirtree WHERE dirid = ? AND NOT EXISTS (SELECT 1 FROM file WHERE file.treeid = dirtree.treeid)",
+			dirid)
+		fatal(err)
+		fdb.forgetIDs()
+	})
+}
+
+// forgetIDs clears the ids remembered by treeID and preloadIDs, whose rows
+// may have gone.
+func (fdb *fileDB) forgetIDs() {
+	fdb.treeIDs = make(map[treeKey]int64)
+	fdb.fileIDs = nil
+}
+
+type fileKey struct {
+	treeid int64
+	name   string
+}
+
+// maxPreloaded is the most files whose ids preloadIDs keeps in memory,
+// about 100MB worth.  Files beyond that are looked up one at a time.
+const maxPreloaded = 1 << 20
+
+// preloadIDs reads the ids of the directories and files in dirid in one go
+// before a scan, which is much quicker than looking each one up as it's
+// found.  Every file is looked up once per scan, so there's no point
+// keeping the most recently used ones instead when there are too many.
+func (fdb *fileDB) preloadIDs(tx *batch, dirid int64) {
+	fdb.forgetIDs()
+	rows, err := tx.Query("SELECT treeid, path FROM dirtree WHERE dirid = ?", dirid)
+	fatal(err)
+	for rows.Next() {
+		var treeid int64
+		var path string
+		fatal(rows.Scan(&treeid, &path))
+		fdb.treeIDs[treeKey{dirid, path}] = treeid
+	}
+	fatal(rows.Err())
+	rows.Close()
+
+	fdb.fileIDs = make(map[fileKey]int64)
+	rows, err = tx.Query("SELECT fileid, treeid, name FROM file WHERE dirid = ? LIMIT ?", dirid, maxPreloaded)
+	fatal(err)
+	defer rows.Close()
+	for rows.Next() {
+		var fileid int64
+		var key fileKey
+		fatal(rows.Scan(&fileid, &key.treeid, &key.name))
+		fdb.fileIDs[key] = fileid
+	}
+	fatal(rows.Err())
+}
+
+// splitPaths moves files from full paths to names within dirtree rows.
+func splitPaths(tx *sql.Tx) {
+	_, err := tx.Exec(`
+CREATE TABLE IF NOT EXISTS dirtree (
+        treeid integer PRIMARY KEY,
+        dirid integer,
+        path text,
+        FOREIGN KEY (dirid) REFERENCES dir(dirid) ON UPDATE RESTRICT ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS dirtreepath ON dirtree(dirid, path);`)
+	fatal(err)
+	addColumn(tx, "file", "treeid", "integer REFERENCES dirtree(treeid) ON UPDATE RESTRICT ON DELETE CASCADE")
+	addColumn(tx, "file", "name", "text")
+
+	type oldFile struct {
+		fileid, dirid int64
+		path          string
+	}
+	var files []oldFile
+	rows, err := tx.Query("SELECT fileid, dirid, path FROM file")
+	fatal(err)
+	for rows.Next() {
+		var f oldFile
+		fatal(rows.Scan(&f.fileid, &f.dirid, &f.path))
+		files = append(files, f)
+	}
+	fatal(rows.Err())
+	rows.Close()
+
+	trees := make(map[treeKey]int64)
+	for _, f := range files {
+		key := treeKey{f.dirid, filepath.Dir(f.path)}
+		treeid, ok := trees[key]
+		if !ok {
+			res, err := tx.Exec("INSERT INTO dirtree (dirid, path) VALUES (?,?)", key.dirid, key.path)
+			fatal(err)
+			treeid, err = res.LastInsertId()
+			fatal(err)
+			trees[key] = treeid
+		}
+		_, err = tx.Exec("UPDATE file SET treeid = ?, name = ? WHERE fileid = ?", treeid, filepath.Base(f.path), f.fileid)
+		fatal(err)
+	}
+
+	_, err = tx.Exec(`
+DROP INDEX IF EXISTS filediridpath;
+ALTER TABLE file DROP COLUMN path;
+CREATE UNIQUE INDEX IF NOT EXISTS filetreename ON file(treeid, name);`)
+	fatal(err)
+}
+
+// relativePaths makes dirtree paths, and the directory paths recorded with
+// file counts, relative to the scanned directory.
+func relativePaths(tx *sql.Tx) {
+	for _, table := range []string{"dirtree", "dircount"} {
+		type row struct {
+			rowid      int64
+			root, path string
+		}
+		var all []row
+		rows, err := tx.Query(fmt.Sprintf(
+			"SELECT %[1]s.rowid, dir.dirpath, %[1]s.path FROM %[1]s, dir WHERE %[1]s.dirid = dir.dirid", table))
+		fatal(err)
+		for rows.Next() {
+			var r row
+			fatal(rows.Scan(&r.rowid, &r.root, &r.path))
+			all = append(all, r)
+		}
+		fatal(rows.Err())
+		rows.Close()
+
+		for _, r := range all {
+			_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET path = ? WHERE rowid = ?", table), treePath(r.root, r.path), r.rowid)
+			fatal(err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "treemap",
+		synopsis: "[-as json|folded] <dir>",
+		help:     "Write the latest size of everything under dir as a tree: nested JSON for d3 treemaps, or folded stacks for flamegraph.pl.",
+		run:      runTreemap,
+		readOnly: true,
+	})
+}
+
+// A treeNode is a directory or file in a treemap.  Directories have
+// children, and files a value, as d3.hierarchy expects.
+type treeNode struct {
+	Name     string      `json:"name"`
+	Value    int64       `json:"value,omitempty"`
+	Children []*treeNode `json:"children,omitempty"`
+
+	size  int64
+	index map[string]*treeNode
+}
+
+func (n *treeNode) child(name string) *treeNode {
+	if n.index == nil {
+		n.index = make(map[string]*treeNode)
+	}
+	c := n.index[name]
+	if c == nil {
+		c = &treeNode{Name: name}
+		n.index[name] = c
+		n.Children = append(n.Children, c)
+	}
+	return c
+}
+
+// sort puts each directory's biggest entries first.
+func (n *treeNode) sort() {
+	sort.Slice(n.Children, func(i, j int) bool {
+		if n.Children[i].size != n.Children[j].size {
+			return n.Children[i].size > n.Children[j].size
+		}
+		return n.Children[i].Name < n.Children[j].Name
+	})
+	for _, c := range n.Children {
+		c.sort()
+	}
+}
+
+func runTreemap(args []string) {
+	fs := commandFlags("treemap")
+	as := fs.String("as", "json", "Output json or folded stacks.")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+	if *as != "json" && *as != "folded" {
+		usagef("-as must be json or folded")
+	}
+
+	dirid, path := cache.findDir(fs.Arg(0))
+	root := strings.TrimSuffix(path, "/")
+	w := bufio.NewWriter(stdout)
+	defer func() { fatal(w.Flush()) }()
+
+	tree := &treeNode{Name: path}
+	for _, f := range cache.filesUnder(dirid, path) {
+		rel := strings.TrimPrefix(strings.TrimPrefix(f.path, root), "/")
+		if *as == "folded" {
+			fmt.Fprintf(w, "%s;%s %d\n", path, strings.ReplaceAll(rel, "/", ";"), f.size)
+			continue
+		}
+
+		n := tree
+		n.size += f.size
+		for _, name := range strings.Split(rel, "/") {
+			n = n.child(name)
+			n.size += f.size
+		}
+		n.Value = f.size
+	}
+	if *as == "folded" {
+		return
+	}
+
+	tree.sort()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	fatal(enc.Encode(tree))
+}
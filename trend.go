@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "trend",
+		synopsis: "[-interval d] [-gaps gap|interpolate] <dir>",
+		help:     "Chart the total size of dir over time, from its samples.",
+		run:      runTrend,
+		readOnly: true,
+	})
+}
+
+// trendWidth is the length of the longest bar in a text chart.
+const trendWidth = 50
+
+// A trendPoint is the total size of a directory during one interval.
+// Intervals without any samples are either left empty, or filled in by
+// interpolating between their neighbors, with -gaps.
+type trendPoint struct {
+	when     time.Time
+	size     int64
+	files    int64
+	sampled  bool
+	estimate bool
+}
+
+func runTrend(args []string) {
+	fs := commandFlags("trend")
+	interval := fs.String("interval", "1d", "Length of each step of the chart, such as 6h or 7d.")
+	gaps := fs.String("gaps", "gap", "How to show intervals without samples: gap leaves them empty, interpolate estimates them.")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	step, err := parseAge(*interval)
+	if err != nil || step < time.Second {
+		usagef("invalid -interval %q", *interval)
+	}
+	if *gaps != "gap" && *gaps != "interpolate" {
+		usagef("-gaps must be gap or interpolate")
+	}
+
+	dirid, path := cache.findDir(fs.Arg(0))
+	points := cache.getTrend(dirid, path, step)
+	if *gaps == "interpolate" {
+		interpolate(points)
+	}
+
+	if outputFormat != "text" {
+		w := newRowWriter(stdout)
+		w.Header([]string{"time", "bytes", "files", "estimate"})
+		for _, p := range points {
+			if !p.sampled && !p.estimate {
+				w.Row([]interface{}{p.when.Format(time.RFC3339), nil, nil, false})
+				continue
+			}
+			w.Row([]interface{}{p.when.Format(time.RFC3339), p.size, p.files, p.estimate})
+		}
+		w.Flush()
+		return
+	}
+
+	var max int64
+	for _, p := range points {
+		if p.size > max {
+			max = p.size
+		}
+	}
+	printTitle("SIZE OF " + path)
+	t := newTableWriter()
+	for _, p := range points {
+		when := p.when.Format("2006-01-02 15:04")
+		switch {
+		case p.estimate:
+			t.Line(fmt.Sprintf("%s\t~%v\t%s", when, niceSize(p.size), bar(p.size, max, "-")), colorDim)
+		case p.sampled:
+			t.Line(fmt.Sprintf("%s\t%v\t%s", when, niceSize(p.size), bar(p.size, max, "#")), "")
+		default:
+			t.Line(fmt.Sprintf("%s\t\tno samples", when), colorDim)
+		}
+	}
+	t.Flush()
+	fmt.Fprintln(stdout)
+}
+
+func bar(n, max int64, c string) string {
+	if max <= 0 {
+		return ""
+	}
+	return strings.Repeat(c, int(n*trendWidth/max))
+}
+
+// getTrend totals the latest sample of each file below path in each
+// interval of length step, from the first sample to the last.
+func (fdb *fileDB) getTrend(dirid int64, path string, step time.Duration) []trendPoint {
+	secs := int64(step / time.Second)
+	args := []interface{}{secs, dirid}
+	args = append(args, underPathArgs(path)...)
+	args = append(args, secs, secs)
+	rows, err := fdb.ro.Query(
+		`select sample.sampletime / ? as bucket, sum(size), count(*) from filepaths as file, sample
+		where file.fileid=sample.fileid and
+			file.dirid = ? and `+underPath+` and sample.invalid is null and
+			sample.sampletime = (
+				select max(s.sampletime) from sample as s
+				where s.fileid = sample.fileid and s.invalid is null and
+					s.sampletime / ? = sample.sampletime / ?
+				)
+		group by bucket
+		order by bucket`, args...)
+	fatal(err)
+	defer rows.Close()
+
+	var points []trendPoint
+	for rows.Next() {
+		var bucket, size, files int64
+		fatal(rows.Scan(&bucket, &size, &files))
+		when := time.Unix(bucket*secs, 0)
+		for len(points) > 0 && points[len(points)-1].when.Add(step).Before(when) {
+			points = append(points, trendPoint{when: points[len(points)-1].when.Add(step)})
+		}
+		points = append(points, trendPoint{when: when, size: size, files: files, sampled: true})
+	}
+	fatal(rows.Err())
+	return points
+}
+
+// interpolate fills in the intervals without samples along straight lines
+// between the sampled ones on either side.
+func interpolate(points []trendPoint) {
+	last := -1
+	for i := range points {
+		if !points[i].sampled {
+			continue
+		}
+		if last >= 0 && i-last > 1 {
+			a, b := points[last], points[i]
+			for j := last + 1; j < i; j++ {
+				f := float64(j-last) / float64(i-last)
+				points[j].size = a.size + int64(f*float64(b.size-a.size))
+				points[j].files = a.files + int64(f*float64(b.files-a.files))
+				points[j].estimate = true
+			}
+		}
+		last = i
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// With "tsdb" in the configuration file, the totals of each directory
+// scanned, and with samples set the sample of each file too, are posted
+// to a time-series database as they're recorded, as InfluxDB line
+// protocol in the same form export writes it.  InfluxDB and
+// VictoriaMetrics take it directly, and Telegraf's influxdb_listener can
+// pass it on to TimescaleDB and others.
+
+type tsdbConfig struct {
+	// URL is where lines are posted, such as
+	// http://localhost:8086/api/v2/write?org=o&bucket=b for InfluxDB 2 or
+	// http://localhost:8428/write for VictoriaMetrics.
+	URL string `json:"url"`
+	// Token is sent as InfluxDB 2 expects it, and Username and Password,
+	// if set, as basic authentication.
+	Token    string `json:"token"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// Samples forwards every file's sample, and not only the totals of
+	// each directory at each scan.
+	Samples bool `json:"samples"`
+}
+
+// tsdbBacklog is how much is kept to post again while the database can't
+// be reached, after which it's thrown away.
+const tsdbBacklog = 64 << 20
+
+// tsdbRetry is how long after failing to post it's tried again, so that
+// scans aren't held up waiting on a database that's down.
+const tsdbRetry = time.Minute
+
+// tsdb is where samples are forwarded, or nil without "tsdb" in the
+// configuration file.  Use getTSDB, which opens it when it's first needed.
+var (
+	tsdb     *tsdbSink
+	tsdbOnce sync.Once
+)
+
+func getTSDB() *tsdbSink {
+	tsdbOnce.Do(func() { tsdb = openTSDB() })
+	return tsdb
+}
+
+type tsdbSink struct {
+	cfg    *tsdbConfig
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	failed time.Time
+}
+
+func openTSDB() *tsdbSink {
+	cfg := getConfig().TSDB
+	if cfg == nil || cfg.URL == "" {
+		return nil
+	}
+	if _, err := url.ParseRequestURI(cfg.URL); err != nil {
+		fatal(fmt.Errorf("tsdb: %v", err))
+	}
+	return &tsdbSink{cfg: cfg}
+}
+
+// samples adds the samples of jobs recorded under root, if every sample
+// is forwarded.
+func (t *tsdbSink) samples(root string, jobs []*insertJob) {
+	if t == nil || !t.cfg.Samples {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	w := bufio.NewWriter(&t.buf)
+	for _, job := range jobs {
+		if job.i == nil {
+			continue
+		}
+		s := series{measurement: "filebase_file", tags: [][2]string{{"dir", root}, {"path", job.p}, {"source", job.source}}}
+		s.points = []seriesPoint{{job.now, []seriesField{{"bytes", job.i.Size()}}}}
+		writeInfluxSeries(w, s)
+	}
+	fatal(w.Flush())
+}
+
+// scanned adds the totals of dirid at scans since start.
+func (t *tsdbSink) scanned(fdb *fileDB, dirid int64, start time.Time) {
+	if t == nil {
+		return
+	}
+	s := fdb.dirSeries(dirid, start)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	w := bufio.NewWriter(&t.buf)
+	writeInfluxSeries(w, s)
+	fatal(w.Flush())
+}
+
+// flush posts what's been added.  Failing to is logged, and it's posted
+// again with a flush after tsdbRetry.
+func (t *tsdbSink) flush() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.buf.Len() == 0 || time.Since(t.failed) < tsdbRetry {
+		return
+	}
+	if err := t.post(t.buf.Bytes()); err != nil {
+		log.Printf("tsdb: %v", err)
+		t.failed = time.Now()
+		if t.buf.Len() > tsdbBacklog {
+			log.Printf("tsdb: dropping %sB of samples", niceSize(int64(t.buf.Len())))
+			t.buf.Reset()
+		}
+		return
+	}
+	t.buf.Reset()
+}
+
+func (t *tsdbSink) post(body []byte) error {
+	req, err := http.NewRequest("POST", t.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if t.cfg.Token != "" {
+		req.Header.Set("Authorization", "Token "+t.cfg.Token)
+	}
+	if t.cfg.Username != "" {
+		req.SetBasicAuth(t.cfg.Username, t.cfg.Password)
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", t.cfg.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"os"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "unread",
+		synopsis: "[-bigger size] [-paths] <dir>",
+		help:     "List big files that haven't been read since they were first recorded, the strongest candidates for archiving.  This needs scans with -atime, on a filesystem that keeps atime up to date (relatime is enough, noatime isn't).  Scans with -hash or -mime read files themselves, which counts.",
+		run:      runUnread,
+		readOnly: true,
+	})
+}
+
+// accessTimes adds when each file was last read as of each sample, which
+// is NULL unless scanned with -atime.
+func accessTimes(tx *sql.Tx) {
+	addColumn(tx, "sample", "atime", "integer")
+}
+
+var unreadReport = &reportKind{"UNREAD LARGE FILES", "size DESC", sameSize}
+
+func runUnread(args []string) {
+	fs := commandFlags("unread")
+	bigger := byteSize(1e9)
+	fs.Var(&bigger, "bigger", "Only list files at least this big.")
+	paths := fs.Bool("paths", false, "Print only the paths, one per line, such as for xargs.  Use -all to get every one.")
+	parseFlags(fs, args)
+	needArgs(fs, 1)
+
+	dirid, _ := cache.findDir(fs.Arg(0))
+	if root := cache.getDirPath(dirid); noatimeMount(root) {
+		fmt.Fprintf(os.Stderr, "%s is mounted noatime, so reading files doesn't show\n", root)
+	}
+	files := cache.queryUnread(dirid, int64(bigger), listSize, opts)
+	if !*paths {
+		printFiles(unreadReport, files)
+		return
+	}
+
+	w := bufio.NewWriter(stdout)
+	for files.Next() {
+		fmt.Fprintln(w, files.File().path)
+	}
+	fatal(w.Flush())
+}
+
+// queryUnread ranks the files in dirid at least minSize bytes whose atime
+// has stayed before the first sample recording it, biggest first.
+func (fdb *fileDB) queryUnread(dirid, minSize int64, n int, o reportOptions) *fileIter {
+	args := o.reportArgs(dirid, minSize, dirid, o.limit(n), o.Offset)
+
+	rows, err := fdb.ro.Query(`select * from (`+o.reportQuery()+`)
+	where size >= ? and path in (
+		select path from filepaths where dirid = ? and fileid in (
+			select fileid from sample where atime is not null
+			group by fileid having max(atime) < min(sampletime)))
+	order by `+unreadReport.order+`, path limit ? offset ?`, args...)
+	fatal(err)
+
+	return newFileIter(rows, n, o.Ties, unreadReport.tie)
+}
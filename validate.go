@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Samples that could not have happened are marked invalid, with a reason,
+// and left out of growth rates.  They usually come from a clock that was
+// wrong on the scanning machine or on a file server.
+const (
+	// maxClockSkew is how far into the future a time may be before it's
+	// considered impossible.
+	maxClockSkew = 24 * time.Hour
+
+	// maxMtimeRewind is how far a file's mtime may move backwards between
+	// samples.  Restores and "touch -d" legitimately rewind it, but not by
+	// decades.
+	maxMtimeRewind = 10 * 365 * 24 * time.Hour
+)
+
+// validateSamplesSQL checks the samples of dirid ?1 taken since ?2, each
+// against the one before.  Only the files sampled since then are looked
+// at, from their last sample before it, so a scan doesn't go over the
+// whole history.
+const validateSamplesSQL = `
+WITH recent AS (
+	SELECT file.fileid,
+		(SELECT max(sampletime) FROM sample WHERE sample.fileid = file.fileid AND sampletime < ?2) AS prevtime
+	FROM file
+	WHERE file.dirid = ?1 AND EXISTS (SELECT 1 FROM sample WHERE sample.fileid = file.fileid AND sampletime >= ?2)
+),
+seq AS (
+	SELECT sample.rowid AS id, sampletime, size, mtime,
+		lag(sampletime) OVER w AS prevtime,
+		lag(mtime) OVER w AS prevmtime
+	FROM sample, recent
+	WHERE sample.fileid = recent.fileid AND sample.sampletime >= coalesce(recent.prevtime, ?2)
+	WINDOW w AS (PARTITION BY sample.fileid ORDER BY sample.rowid)
+),
+checked AS (
+	SELECT id, sampletime,
+		CASE
+			WHEN size < 0 THEN 'negative size'
+			WHEN sampletime < prevtime THEN 'sample time went backwards'
+			WHEN sampletime > ?3 + ?4 THEN 'sample time in the future'
+			WHEN mtime > sampletime + ?4 THEN 'mtime after sample time'
+			WHEN prevmtime - mtime > ?5 THEN 'mtime went backwards'
+		END AS reason
+	FROM seq
+)
+UPDATE sample SET invalid = (SELECT reason FROM checked WHERE id = sample.rowid)
+WHERE rowid IN (SELECT id FROM checked WHERE sampletime >= ?2)`
+
+// validateSamples checks samples of dirid taken since the given time.
+func (fdb *fileDB) validateSamples(dirid int64, since time.Time) {
+	_, err := fdb.db.Exec(validateSamplesSQL, dirid, since.Unix(), time.Now().Unix(),
+		int64(maxClockSkew/time.Second), int64(maxMtimeRewind/time.Second))
+	fatal(err)
+}
+
+func init() {
+	addCommand(&command{
+		name:     "repair",
+		synopsis: "[dir...]",
+		help:     "Recheck every sample for impossible values and list the ones left out of growth rates.",
+		run:      runRepair,
+	})
+}
+
+func runRepair(args []string) {
+	fs := commandFlags("repair")
+	del := fs.Bool("delete", false, "Delete invalid samples instead of just marking them.")
+	parseFlags(fs, args)
+
+	var dirids []int64
+	if fs.NArg() == 0 {
+		dirids = cache.allDirIDs()
+	}
+	for _, dir := range fs.Args() {
+		dirid, _ := cache.findDir(dir)
+		dirids = append(dirids, dirid)
+	}
+
+	for _, dirid := range dirids {
+		cache.validateSamples(dirid, time.Unix(0, 0))
+		cache.changed()
+
+		rows, err := cache.db.Query(
+			`select path, sampletime, size, mtime, invalid from filepaths as file, sample
+			where file.fileid = sample.fileid and file.dirid = ? and invalid is not null
+			order by path, sampletime`, dirid)
+		fatal(err)
+		for rows.Next() {
+			var path, reason string
+			var when, size, mtime int64
+			fatal(rows.Scan(&path, &when, &size, &mtime, &reason))
+			fmt.Fprintf(stdout, "%v\t%v\t%v\t%v\t%v\n", time.Unix(when, 0), size, time.Unix(mtime, 0), reason, path)
+		}
+		fatal(rows.Err())
+		rows.Close()
+
+		if *del {
+			res, err := cache.db.Exec(
+				`DELETE FROM sample WHERE invalid IS NOT NULL AND
+				fileid IN (SELECT fileid FROM file WHERE dirid = ?)`, dirid)
+			fatal(err)
+			cache.changed()
+			n, err := res.RowsAffected()
+			fatal(err)
+			fmt.Fprintf(stdout, "Deleted %d invalid samples from %s\n", n, cache.getDirPath(dirid))
+		}
+	}
+}
+
+func (fdb *fileDB) allDirIDs() (dirids []int64) {
+	rows, err := fdb.db.Query("SELECT dirid FROM dir WHERE "+forHost+" ORDER BY dirpath", forHostArgs()...)
+	fatal(err)
+	defer rows.Close()
+	for rows.Next() {
+		var dirid int64
+		fatal(rows.Scan(&dirid))
+		dirids = append(dirids, dirid)
+	}
+	fatal(rows.Err())
+	return
+}
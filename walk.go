@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A walker goes through the regular files and symlinks below a directory,
+// the same way for scans, agents and dry runs.  Any of its functions may
+// be nil.
+type walker struct {
+	// file is called for each regular file.
+	file func(path string, info os.FileInfo)
+	// link is called for each symlink.
+	link func(path string, info os.FileInfo)
+	// failed is called for each path that couldn't be read.
+	failed func(path string, err error)
+	// skipped is called for each directory left out, such as /proc.
+	skipped func(path string)
+	// enter is called for each directory below the root, and those it
+	// returns false for are left out too.
+	enter func(path string) bool
+	// empty is called at the end for each directory holding nothing but
+	// empty directories, other than those inside another.
+	empty func(path string)
+
+	// snapshots are the snapshot directories found so far with
+	// -snapshots mark.
+	snapshots []string
+}
+
+// An inode is a file's device and inode number.
+type inode struct {
+	dev, ino uint64
+}
+
+// walk walks root.  Failing to read root itself is the only error.
+// Directories seen before under another path, through a bind mount or a
+// loop of them, are skipped, so their files aren't recorded twice.
+func (w *walker) walk(root string) error {
+	skip := skipDirs(root)
+	seen := make(map[inode]string)
+	// dirs records whether anything other than directories was found
+	// below each directory.
+	dirs := make(map[string]bool)
+	full := func(path string) {
+		for dir := filepath.Dir(path); len(dir) >= len(root) && !dirs[dir]; dir = filepath.Dir(dir) {
+			dirs[dir] = true
+			if dir == root {
+				break
+			}
+		}
+	}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			if w.failed != nil {
+				w.failed(path, err)
+			}
+			// There's no telling what's in there.
+			full(path + "/x")
+			return nil
+		}
+
+		if info.IsDir() {
+			if skip[path] {
+				if w.skipped != nil {
+					w.skipped(path)
+				}
+				full(path + "/x")
+				return filepath.SkipDir
+			}
+			if scanHidden == hiddenSkip && path != root && strings.HasPrefix(info.Name(), ".") {
+				full(path + "/x")
+				return filepath.SkipDir
+			}
+			if scanSnapshots != "" && path != root && snapshotDir(path, info) {
+				if scanSnapshots == snapshotsSkip {
+					log.Printf("skipping %s, a snapshot", path)
+					if w.skipped != nil {
+						w.skipped(path)
+					}
+					full(path + "/x")
+					return filepath.SkipDir
+				}
+				w.snapshots = append(w.snapshots, path)
+			}
+			if w.enter != nil && path != root && !w.enter(path) {
+				full(path + "/x")
+				return filepath.SkipDir
+			}
+			if id, ok := fileIdentity(info); ok {
+				if first, dup := seen[id]; dup {
+					log.Printf("skipping %s, the same directory as %s", path, first)
+					if w.skipped != nil {
+						w.skipped(path)
+					}
+					full(path + "/x")
+					return filepath.SkipDir
+				}
+				seen[id] = path
+			}
+			if w.empty != nil {
+				if _, ok := dirs[path]; !ok {
+					dirs[path] = false
+				}
+			}
+			return nil
+		}
+
+		if scanHidden != "" && hiddenPath(treePath(root, path)) != (scanHidden == hiddenOnly) {
+			full(path)
+			return nil
+		}
+		if w.empty != nil {
+			full(path)
+		}
+		if info.Mode().IsRegular() && w.file != nil {
+			w.file(path, info)
+		}
+		if info.Mode()&os.ModeSymlink != 0 && w.link != nil {
+			w.link(path, info)
+		}
+		return nil
+	})
+	if err != nil || w.empty == nil {
+		return err
+	}
+
+	for dir, full := range dirs {
+		if !full && dir != root && dirs[filepath.Dir(dir)] {
+			w.empty(dir)
+		}
+	}
+	return nil
+}
+
+// dryRunSample is how many of the files a dry run would record it lists.
+const dryRunSample = 10
+
+// dryRun walks dir as a scan would, and says what the scan would record,
+// without touching the database.
+func dryRun(dir string) {
+	root := canonical(dir)
+
+	var files, bytes int64
+	var sample, skipped []string
+	var errs int
+	rng := rand.New(rand.NewSource(1))
+	w := &walker{
+		file: func(path string, info os.FileInfo) {
+			files++
+			bytes += info.Size()
+			// Keep an even sample of the paths seen so far.
+			if len(sample) < dryRunSample {
+				sample = append(sample, path)
+			} else if i := rng.Int63n(files); i < dryRunSample {
+				sample[i] = path
+			}
+		},
+		failed: func(path string, err error) {
+			log.Print(err)
+			errs++
+		},
+		skipped: func(path string) {
+			skipped = append(skipped, path)
+		},
+	}
+	if err := w.walk(root); err != nil {
+		log.Print(err)
+		return
+	}
+
+	fmt.Fprintf(stdout, "*** DRY RUN OF %s ***\n", root)
+	fmt.Fprintf(stdout, "Would record %d files, %sB", files, niceSize(bytes))
+	if errs > 0 {
+		fmt.Fprintf(stdout, ", with %d errors", errs)
+	}
+	fmt.Fprintln(stdout)
+	for _, p := range skipped {
+		fmt.Fprintf(stdout, "Would skip %s\n", p)
+	}
+	if len(sample) > 0 {
+		fmt.Fprintln(stdout, "Such as:")
+		for _, p := range sample {
+			fmt.Fprintf(stdout, "\t%s\n", p)
+		}
+	}
+	fmt.Fprintln(stdout)
+}
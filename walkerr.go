@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+func init() {
+	addCommand(&command{
+		name:     "errors",
+		synopsis: "<dir>",
+		help:     "List the paths the last scan of dir couldn't read, and why.",
+		run:      runErrors,
+		readOnly: true,
+	})
+}
+
+// errorMessage is the reason for a walk error, without the path, which is
+// recorded separately.
+func errorMessage(err error) string {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return pe.Err.Error()
+	}
+	return err.Error()
+}
+
+func runErrors(args []string) {
+	flags := commandFlags("errors")
+	parseFlags(flags, args)
+	needArgs(flags, 1)
+
+	dirid, path := cache.findDir(flags.Arg(0))
+	qargs := append([]interface{}{dirid, dirid}, underPathArgs(path)...)
+	rows, err := cache.ro.Query(
+		`SELECT path, message, sampletime FROM walkerror AS file
+		WHERE scanid = (SELECT rowid FROM scan WHERE dirid = ? AND finished IS NOT NULL ORDER BY started DESC LIMIT 1)
+			AND dirid = ? AND `+underPath+`
+		ORDER BY path`, qargs...)
+	fatal(err)
+	defer rows.Close()
+
+	w := newRowWriter(stdout)
+	w.Header([]string{"path", "error", "time"})
+	for rows.Next() {
+		var p, msg string
+		var when int64
+		fatal(rows.Scan(&p, &msg, &when))
+		w.Row([]interface{}{p, msg, time.Unix(when, 0).Format(time.RFC3339)})
+	}
+	fatal(rows.Err())
+	w.Flush()
+}
+
+// getUnreadable lists the paths the last scan of dirid was refused, with
+// how many scans have been refused them and since when, out of how many
+// scans there have been.
+func (fdb *fileDB) getUnreadable(dirid int64) (result []unreadableEnt, scans int64) {
+	err := fdb.ro.QueryRow("SELECT count(*) FROM scan WHERE dirid = ? AND finished IS NOT NULL", dirid).Scan(&scans)
+	fatal(err)
+
+	rows, err := fdb.ro.Query(
+		`SELECT path, (SELECT count(DISTINCT scanid) FROM walkerror AS old
+				WHERE old.dirid = e.dirid AND old.path = e.path AND old.message = e.message),
+			(SELECT min(sampletime) FROM walkerror AS old
+				WHERE old.dirid = e.dirid AND old.path = e.path AND old.message = e.message)
+		FROM walkerror AS e
+		WHERE dirid = ? AND message IN (?, ?) AND
+			scanid = (SELECT rowid FROM scan WHERE dirid = ? AND finished IS NOT NULL ORDER BY started DESC LIMIT 1)
+		ORDER BY path`,
+		dirid, syscall.EACCES.Error(), syscall.EPERM.Error(), dirid)
+	fatal(err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var u unreadableEnt
+		var since int64
+		fatal(rows.Scan(&u.path, &u.failures, &since))
+		u.since = time.Unix(since, 0)
+		result = append(result, u)
+	}
+	fatal(rows.Err())
+	return
+}
+
+type unreadableEnt struct {
+	path     string
+	failures int64
+	since    time.Time
+}
+
+// printUnreadable prints the -unreadable report.
+func printUnreadable(dirid int64) {
+	result, scans := cache.getUnreadable(dirid)
+	printTitle("UNREADABLE DIRECTORIES")
+	t := newTableWriter()
+	for _, u := range result {
+		t.File(u.path, fmt.Sprintf("%d of %d scans\tsince %s\t%s", u.failures, scans, u.since.Format("2006-01-02"), u.path), "")
+	}
+	t.Flush()
+	endReport()
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Watched files are sampled by the daemon every few minutes between
+// scans, for a close look at how they grow.  Their samples have the
+// source "watch".
+
+func init() {
+	addCommand(&command{
+		name:     "watch",
+		synopsis: "add [-every interval] <file>... | remove <file>... | list",
+		help:     "Keep a list of files for the daemon to sample on their own, every few minutes, whenever it isn't scanning.  The files must be in recorded directories.",
+		run:      runWatch,
+	})
+}
+
+// defaultWatchInterval is how often watched files are sampled unless
+// -every says otherwise.
+const defaultWatchInterval = 5 * time.Minute
+
+// watches adds the table of watched files.  Intervals are in seconds, and
+// lastsample is when the daemon last looked at the file.
+func watches(tx *sql.Tx) {
+	_, err := tx.Exec(`
+CREATE TABLE IF NOT EXISTS watch (
+        path text PRIMARY KEY,
+        interval integer,
+        lastsample integer
+);`)
+	fatal(err)
+}
+
+func runWatch(args []string) {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	fs := commandFlags("watch")
+	every := fs.Duration("every", defaultWatchInterval, "Sample the files this often.")
+	parseFlags(fs, args[1:])
+
+	switch args[0] {
+	case "add", "remove":
+		if fs.NArg() == 0 {
+			badUsage(fs)
+		}
+		if *every < time.Second {
+			usagef("-every must be at least 1s")
+		}
+		for _, p := range fs.Args() {
+			_, path := cache.findDir(p)
+			if args[0] == "remove" {
+				if !cache.removeWatch(path) {
+					fmt.Fprintf(os.Stderr, "%s isn't watched\n", path)
+				}
+				continue
+			}
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				fatal(fmt.Errorf("%s is a directory; only files can be watched", path))
+			}
+			cache.addWatch(path, *every)
+		}
+	case "list":
+		needArgs(fs, 0)
+		w := newRowWriter(stdout)
+		w.Header([]string{"path", "every", "last_sample"})
+		for _, wf := range cache.watched() {
+			last := ""
+			if wf.last > 0 {
+				last = time.Unix(wf.last, 0).Format(time.RFC3339)
+			}
+			w.Row([]interface{}{wf.path, wf.every.String(), last})
+		}
+		w.Flush()
+	default:
+		badUsage(fs)
+	}
+}
+
+func (fdb *fileDB) addWatch(path string, every time.Duration) {
+	_, err := fdb.db.Exec(
+		`INSERT INTO watch (path, interval) VALUES (?, ?)
+		ON CONFLICT (path) DO UPDATE SET interval = excluded.interval`, path, int64(every/time.Second))
+	fatal(err)
+}
+
+func (fdb *fileDB) removeWatch(path string) bool {
+	res, err := fdb.db.Exec("DELETE FROM watch WHERE path = ?", path)
+	fatal(err)
+	n, err := res.RowsAffected()
+	fatal(err)
+	return n > 0
+}
+
+type watchedFile struct {
+	path  string
+	every time.Duration
+	last  int64
+}
+
+// due returns when the file should next be sampled.
+func (wf *watchedFile) due() time.Time {
+	return time.Unix(wf.last, 0).Add(wf.every)
+}
+
+func (fdb *fileDB) watched() (result []watchedFile) {
+	rows, err := fdb.db.Query("SELECT path, interval, coalesce(lastsample, 0) FROM watch ORDER BY path")
+	fatal(err)
+	defer rows.Close()
+	for rows.Next() {
+		var wf watchedFile
+		var secs int64
+		fatal(rows.Scan(&wf.path, &secs, &wf.last))
+		wf.every = time.Duration(secs) * time.Second
+		result = append(result, wf)
+	}
+	fatal(rows.Err())
+	return
+}
+
+// sampleWatched samples the watched files that are due, and returns when
+// the next one will be, or the zero time if none are watched.
+func (fdb *fileDB) sampleWatched() (next time.Time) {
+	sampled := false
+	for _, wf := range fdb.watched() {
+		now := time.Now()
+		if !wf.due().After(now) {
+			sampled = fdb.sampleWatchedFile(wf.path, now) || sampled
+			_, err := fdb.db.Exec("UPDATE watch SET lastsample = ? WHERE path = ?", now.Unix(), wf.path)
+			fatal(err)
+			wf.last = now.Unix()
+		}
+		if next.IsZero() || wf.due().Before(next) {
+			next = wf.due()
+		}
+	}
+	if sampled {
+		fdb.changed()
+	}
+	return
+}
+
+// sampleWatchedFile adds a sample of the file at path, as a scan would but
+// without marking it found, so scans still decide which files are gone.
+func (fdb *fileDB) sampleWatchedFile(path string, now time.Time) bool {
+	info, err := os.Lstat(path)
+	if err != nil {
+		log.Printf("watch: %v", err)
+		return false
+	}
+	dirid, ok := fdb.lookupDir(localHost, path)
+	if !ok {
+		log.Printf("watch: %s is no longer in a recorded directory", path)
+		return false
+	}
+	root := fdb.getDirPath(dirid)
+
+	fdb.write(func(tx *batch) {
+		treeid := fdb.treeID(tx.Tx, dirid, treePath(root, filepath.Dir(path)))
+		var fileid int64
+		fatal(tx.Stmt(fdb.upsertFile).QueryRow(dirid, treeid, filepath.Base(path)).Scan(&fileid))
+
+		// A scan may have sampled the file this very second.
+		_, err := tx.Exec(
+			"INSERT OR IGNORE INTO sample (fileid, sampletime, mode, size, mtime, source) VALUES (?,?,?,?,?,?)",
+			fileid, now.Unix(), info.Mode(), info.Size(), info.ModTime().Unix(), sourceWatch)
+		fatal(err)
+	})
+	sink := getTSDB()
+	sink.samples(root, []*insertJob{{now: now, i: info, p: path, source: sourceWatch}})
+	sink.flush()
+	return true
+}
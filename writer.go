@@ -0,0 +1,53 @@
+package main
+
+// Samples can come from more than one goroutine at once: the walk of a
+// scan, watched files between scans, agents.  Rather than each holding a
+// transaction of its own, and waiting on the others' locks, they hand
+// their writes to a single writer goroutine, which runs them one at a time
+// in the order they came, each in its own transaction.  Other processes
+// writing to the same database still wait on SQLite's lock as before.
+
+// writeQueue is how many writes can wait for the writer before those
+// handing them over have to wait too.
+const writeQueue = 16
+
+type writeRequest struct {
+	fn   func(tx *batch)
+	done chan error
+}
+
+// startWriter starts the writer goroutine.  Closing fdb.writes stops it.
+func (fdb *fileDB) startWriter() {
+	fdb.writes = make(chan writeRequest, writeQueue)
+	go func() {
+		for req := range fdb.writes {
+			req.done <- fdb.runWrite(req.fn)
+		}
+	}()
+}
+
+func (fdb *fileDB) runWrite(fn func(tx *batch)) (err error) {
+	// Ids remembered during a batch rolled back may be of rows that
+	// were never committed.
+	defer func() {
+		if err != nil {
+			fdb.forgetIDs()
+		}
+	}()
+	defer catch(&err, "")
+
+	tx := fdb.beginBatch()
+	defer tx.Rollback()
+	fn(tx)
+	fatal(tx.Commit())
+	return nil
+}
+
+// write has the writer run fn in a transaction, and waits until it's
+// committed, or rolled back if fn fails, in which case the failure is
+// raised again here.  fn mustn't call write itself.
+func (fdb *fileDB) write(fn func(tx *batch)) {
+	done := make(chan error, 1)
+	fdb.writes <- writeRequest{fn, done}
+	fatal(<-done)
+}